@@ -11,10 +11,19 @@ import (
 )
 
 type Analyzer struct {
-	Buildpacks []GroupBuildpack
-	LayersDir  string
-	Logger     Logger
-	SkipLayers bool
+	Buildpacks         []GroupBuildpack
+	CacheInvalidations CacheInvalidations
+	LayersDir          string
+	Logger             Logger
+	RunImage           imgutil.Image // RunImage is the run image of the current build, compared with the previous run image when set
+	SkipLayers         bool
+
+	cacheStats cacheStatsRecorder
+}
+
+// CacheStats returns the number of cached layers that were hit, missed or stale during Analyze, in total and per buildpack.
+func (a *Analyzer) CacheStats() CacheStats {
+	return a.cacheStats.stats(a.Buildpacks)
 }
 
 // Analyze restores metadata for launch and cache layers into the layers directory.
@@ -45,13 +54,45 @@ func (a *Analyzer) Analyze(image imgutil.Image, cache Cache) (AnalyzedMetadata,
 		return AnalyzedMetadata{}, err
 	}
 
+	var drift *RunImageDrift
+	if imageID != nil {
+		drift, err = a.detectRunImageDrift(appMeta.RunImage)
+		if err != nil {
+			return AnalyzedMetadata{}, err
+		}
+	}
+
 	return AnalyzedMetadata{
 		Image:    imageID,
 		Metadata: appMeta,
+		RunImage: drift,
 	}, nil
 }
 
+func (a *Analyzer) detectRunImageDrift(previous RunImageMetadata) (*RunImageDrift, error) {
+	if a.RunImage == nil || previous.TopLayer == "" {
+		return nil, nil
+	}
+	if !a.RunImage.Found() {
+		a.Logger.Warnf("Run image %q not found, not checking for run image changes", a.RunImage.Name())
+		return nil, nil
+	}
+	drift, err := DetectRunImageDrift(previous, a.RunImage)
+	if err != nil {
+		return nil, errors.Wrap(err, "detecting run image changes")
+	}
+	if drift.Drifted {
+		a.Logger.Warnf("Run image has changed since the previous image: '%s' (top layer %s) -> '%s' (top layer %s)",
+			drift.Previous.Reference, TruncateSha(drift.Previous.TopLayer), drift.Current.Reference, TruncateSha(drift.Current.TopLayer))
+	} else {
+		a.Logger.Infof("Run image is unchanged since the previous image")
+	}
+	return &drift, nil
+}
+
 func (a *Analyzer) analyzeLayers(appMeta LayersMetadata, cache Cache) error {
+	a.cacheStats.reset()
+
 	// Create empty cache metadata in case a usable cache is not provided.
 	var cacheMeta CacheMetadata
 	if cache != nil {
@@ -101,6 +142,11 @@ func (a *Analyzer) analyzeLayers(appMeta LayersMetadata, cache Cache) error {
 				a.Logger.Debugf("Not restoring %q from cache, marked as cache=false", identifier)
 				continue
 			}
+			if a.CacheInvalidations.Invalidated(buildpack.ID, name) {
+				a.Logger.Infof("Not restoring %q from cache, invalidated by platform", identifier)
+				a.cacheStats.stale(buildpack)
+				continue
+			}
 			// If launch=true, the metadata was restored from the app image or the layer is stale.
 			if layer.Launch {
 				a.Logger.Debugf("Not restoring %q from cache, marked as launch=true", identifier)
@@ -110,6 +156,7 @@ func (a *Analyzer) analyzeLayers(appMeta LayersMetadata, cache Cache) error {
 			if err := a.writeLayerMetadata(buildpackDir, name, layer); err != nil {
 				return err
 			}
+			a.cacheStats.hit(buildpack)
 		}
 	}
 	return nil
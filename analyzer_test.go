@@ -297,6 +297,37 @@ func testAnalyzer(t *testing.T, when spec.G, it spec.S) {
 					h.AssertStringContains(t, string(got), want)
 				})
 
+				when("cache layers are invalidated", func() {
+					it("does not restore metadata for an invalidated layer", func() {
+						analyzer.CacheInvalidations = lifecycle.CacheInvalidations{Invalidate: []string{"metadata.buildpack:cache"}}
+						_, err := analyzer.Analyze(image, testCache)
+						h.AssertNil(t, err)
+
+						h.AssertPathDoesNotExist(t, filepath.Join(layerDir, "metadata.buildpack", "cache.toml"))
+						h.AssertPathDoesNotExist(t, filepath.Join(layerDir, "metadata.buildpack", "cache.sha"))
+						h.AssertPathExists(t, filepath.Join(layerDir, "escaped_buildpack_id", "escaped-bp-layer.toml"))
+					})
+
+					it("records invalidated layers as stale", func() {
+						analyzer.CacheInvalidations = lifecycle.CacheInvalidations{Invalidate: []string{"metadata.buildpack:cache"}}
+						_, err := analyzer.Analyze(image, testCache)
+						h.AssertNil(t, err)
+
+						stats := analyzer.CacheStats()
+						h.AssertEq(t, stats.Stale, 1)
+						h.AssertEq(t, stats.Hit > 0, true)
+					})
+
+					it("does not restore cache metadata for an invalidated buildpack", func() {
+						analyzer.CacheInvalidations = lifecycle.CacheInvalidations{Invalidate: []string{"escaped/buildpack/id"}}
+						_, err := analyzer.Analyze(image, testCache)
+						h.AssertNil(t, err)
+
+						h.AssertPathDoesNotExist(t, filepath.Join(layerDir, "escaped_buildpack_id", "escaped-bp-layer.toml"))
+						h.AssertPathExists(t, filepath.Join(layerDir, "metadata.buildpack", "cache.toml"))
+					})
+				})
+
 				when("subset of buildpacks are detected", func() {
 					it.Before(func() {
 						analyzer.Buildpacks = []lifecycle.GroupBuildpack{{ID: "no.group.buildpack"}}
@@ -322,6 +353,48 @@ func testAnalyzer(t *testing.T, when spec.G, it spec.S) {
 				})
 			})
 
+			when("run image is provided", func() {
+				var runImage *fakes.Image
+
+				it.Before(func() {
+					appImageMetadata.RunImage = lifecycle.RunImageMetadata{
+						TopLayer:  "sha256:previous-top-layer",
+						Reference: "some-run-image@sha256:previous-digest",
+					}
+					metadata, err := json.Marshal(appImageMetadata)
+					h.AssertNil(t, err)
+					h.AssertNil(t, image.SetLabel("io.buildpacks.lifecycle.metadata", string(metadata)))
+				})
+
+				it.After(func() {
+					h.AssertNil(t, runImage.Cleanup())
+				})
+
+				it("reports when the run image has changed", func() {
+					runImage = fakes.NewImage("some-run-image", "sha256:current-top-layer", local.IDIdentifier{ImageID: "some-run-image@sha256:current-digest"})
+					analyzer.RunImage = runImage
+
+					md, err := analyzer.Analyze(image, testCache)
+					h.AssertNil(t, err)
+
+					h.AssertEq(t, md.RunImage, &lifecycle.RunImageDrift{
+						Previous: lifecycle.RunImageMetadata{TopLayer: "sha256:previous-top-layer", Reference: "some-run-image@sha256:previous-digest"},
+						Current:  lifecycle.RunImageMetadata{TopLayer: "sha256:current-top-layer", Reference: "some-run-image@sha256:current-digest"},
+						Drifted:  true,
+					})
+				})
+
+				it("does not report a mirror with the same digest as a change", func() {
+					runImage = fakes.NewImage("some-mirror", "sha256:previous-top-layer", local.IDIdentifier{ImageID: "some-mirror@sha256:previous-digest"})
+					analyzer.RunImage = runImage
+
+					md, err := analyzer.Analyze(image, testCache)
+					h.AssertNil(t, err)
+
+					h.AssertEq(t, md.RunImage.Drifted, false)
+				})
+			})
+
 			when("skip-layers is true", func() {
 				it.Before(func() {
 					analyzer.SkipLayers = true
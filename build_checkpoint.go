@@ -0,0 +1,163 @@
+package lifecycle
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/BurntSushi/toml"
+	"github.com/pkg/errors"
+
+	"github.com/buildpacks/lifecycle/launch"
+	"github.com/buildpacks/lifecycle/layers"
+)
+
+// BuildCheckpoint records the buildpacks of the group that have built successfully, so that a failed build
+// can be resumed from the buildpack that failed.
+type BuildCheckpoint struct {
+	Buildpacks []BuildpackCheckpoint `toml:"buildpacks"`
+}
+
+type BuildpackCheckpoint struct {
+	ID          string           `toml:"id"`
+	Version     string           `toml:"version"`
+	BOM         []BOMEntry       `toml:"bom"`
+	BuildBOM    []BOMEntry       `toml:"build-bom"`
+	Labels      []Label          `toml:"labels"`
+	MetRequires []string         `toml:"met-requires"`
+	Processes   []launch.Process `toml:"processes"`
+	Slices      []layers.Slice   `toml:"slices"`
+	// Layers are the layers the buildpack left in its layers directory, which must be present to resume.
+	Layers []string `toml:"layers"`
+}
+
+func (c BuildpackCheckpoint) result() BuildResult {
+	return BuildResult{
+		BOM:         c.BOM,
+		BuildBOM:    c.BuildBOM,
+		Labels:      c.Labels,
+		MetRequires: c.MetRequires,
+		Processes:   c.Processes,
+		Slices:      c.Slices,
+	}
+}
+
+func ReadBuildCheckpoint(path string) (BuildCheckpoint, error) {
+	var checkpoint BuildCheckpoint
+	_, err := toml.DecodeFile(path, &checkpoint)
+	return checkpoint, err
+}
+
+// envRestorer is implemented by buildpacks that can add the build layers of a previous build to the build env.
+type envRestorer interface {
+	restoreEnv(config BuildConfig) error
+}
+
+func (b *BuildpackTOML) restoreEnv(config BuildConfig) error {
+	return b.setupEnv(config.Env, filepath.Join(config.LayersDir, launch.EscapeID(b.Buildpack.ID)))
+}
+
+// checkpoint records that bp built br, and writes the checkpoint to the builder's CheckpointPath.
+func (b *Builder) checkpoint(checkpoint *BuildCheckpoint, config BuildConfig, bp GroupBuildpack, br BuildResult) error {
+	layerNames, err := bpLayerNames(filepath.Join(config.LayersDir, launch.EscapeID(bp.ID)))
+	if err != nil {
+		return err
+	}
+	checkpoint.Buildpacks = append(checkpoint.Buildpacks, BuildpackCheckpoint{
+		ID:          bp.ID,
+		Version:     bp.Version,
+		BOM:         br.BOM,
+		BuildBOM:    br.BuildBOM,
+		Labels:      br.Labels,
+		MetRequires: br.MetRequires,
+		Processes:   br.Processes,
+		Slices:      br.Slices,
+		Layers:      layerNames,
+	})
+	return errors.Wrap(WriteTOML(b.CheckpointPath, checkpoint), "write build checkpoint")
+}
+
+// removeCheckpoint removes the checkpoint once the build succeeds, as there is nothing left to resume.
+func (b *Builder) removeCheckpoint() error {
+	if err := os.Remove(b.CheckpointPath); err != nil && !os.IsNotExist(err) {
+		return errors.Wrap(err, "remove build checkpoint")
+	}
+	return nil
+}
+
+// resume returns the checkpoints of the buildpacks before ResumeFrom, after verifying that their layers are present.
+func (b *Builder) resume(config BuildConfig) ([]BuildpackCheckpoint, error) {
+	checkpoint, err := ReadBuildCheckpoint(b.CheckpointPath)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, errors.Errorf("cannot resume from buildpack '%s': no build checkpoint found", b.ResumeFrom)
+		}
+		return nil, errors.Wrap(err, "read build checkpoint")
+	}
+
+	start := -1
+	for i, bp := range b.Group.Group {
+		if bp.ID == b.ResumeFrom {
+			start = i
+			break
+		}
+	}
+	if start < 0 {
+		return nil, errors.Errorf("cannot resume from buildpack '%s': buildpack is not in the group", b.ResumeFrom)
+	}
+
+	for i, bp := range b.Group.Group[:start] {
+		if i >= len(checkpoint.Buildpacks) || checkpoint.Buildpacks[i].ID != bp.ID || checkpoint.Buildpacks[i].Version != bp.Version {
+			return nil, errors.Errorf("cannot resume from buildpack '%s': buildpack '%s' did not complete before the checkpoint", b.ResumeFrom, bp)
+		}
+		bpLayersDir := filepath.Join(config.LayersDir, launch.EscapeID(bp.ID))
+		for _, name := range checkpoint.Buildpacks[i].Layers {
+			if !layerPresent(filepath.Join(bpLayersDir, name)) {
+				return nil, errors.Errorf("cannot resume from buildpack '%s': layer '%s' of buildpack '%s' is missing", b.ResumeFrom, name, bp)
+			}
+		}
+	}
+	return checkpoint.Buildpacks[:start], nil
+}
+
+// layerPresent returns true if the layer at path has layer metadata and, if it is a build or cache layer,
+// its contents, which later buildpacks and the exporter rely on.
+func layerPresent(path string) bool {
+	var layerTOML struct {
+		Build bool `toml:"build"`
+		Cache bool `toml:"cache"`
+	}
+	if _, err := toml.DecodeFile(path+".toml", &layerTOML); err != nil {
+		return false
+	}
+	if !layerTOML.Build && !layerTOML.Cache {
+		return true
+	}
+	fi, err := os.Stat(path)
+	return err == nil && fi.IsDir()
+}
+
+// bpLayerNames returns the names of the layers with layer metadata in bpLayersDir.
+func bpLayerNames(bpLayersDir string) ([]string, error) {
+	fis, err := ioutil.ReadDir(bpLayersDir)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	var names []string
+	for _, fi := range fis {
+		name := fi.Name()
+		if fi.IsDir() || filepath.Ext(name) != ".toml" {
+			continue
+		}
+		switch name {
+		case "launch.toml", "build.toml", "store.toml":
+			continue
+		}
+		names = append(names, strings.TrimSuffix(name, ".toml"))
+	}
+	return names, nil
+}
@@ -0,0 +1,109 @@
+package lifecycle
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/buildpacks/lifecycle/launch"
+)
+
+const outputTimeLayout = "2006-01-02T15:04:05.000Z07:00"
+
+// BuildOutputPath returns the path of the captured build output of the buildpack with bpID within logsDir.
+func BuildOutputPath(logsDir, bpID string) string {
+	return filepath.Join(logsDir, launch.EscapeID(bpID)+".log")
+}
+
+// buildOutput returns the stdout and stderr of the build of the buildpack with bpID.
+// The returned func must be called after the build to flush any partial line and close the captured output.
+func (c BuildConfig) buildOutput(bpID string) (io.Writer, io.Writer, func() error, error) {
+	stdout, stderr := c.Out, c.Err
+	var closers []func() error
+
+	if c.PrefixOutput {
+		prefixedOut, prefixedErr := newPrefixWriter(stdout, bpID), newPrefixWriter(stderr, bpID)
+		stdout, stderr = prefixedOut, prefixedErr
+		closers = append(closers, prefixedOut.Flush, prefixedErr.Flush)
+	}
+
+	if c.LogsDir != "" {
+		if err := os.MkdirAll(c.LogsDir, 0777); err != nil {
+			return nil, nil, nil, err
+		}
+		f, err := os.Create(BuildOutputPath(c.LogsDir, bpID))
+		if err != nil {
+			return nil, nil, nil, err
+		}
+		log := &lockedWriter{w: f}
+		stdout, stderr = io.MultiWriter(log, stdout), io.MultiWriter(log, stderr)
+		closers = append(closers, f.Close)
+	}
+
+	return stdout, stderr, func() error {
+		var firstErr error
+		for _, fn := range closers {
+			if err := fn(); err != nil && firstErr == nil {
+				firstErr = err
+			}
+		}
+		return firstErr
+	}, nil
+}
+
+// prefixWriter writes each line prefixed by the buildpack ID and the time the line was written.
+type prefixWriter struct {
+	w    io.Writer
+	bpID string
+	buf  []byte
+}
+
+func newPrefixWriter(w io.Writer, bpID string) *prefixWriter {
+	return &prefixWriter{w: w, bpID: bpID}
+}
+
+func (p *prefixWriter) Write(b []byte) (int, error) {
+	p.buf = append(p.buf, b...)
+	for {
+		i := bytes.IndexByte(p.buf, '\n')
+		if i < 0 {
+			break
+		}
+		if err := p.writeLine(p.buf[:i+1]); err != nil {
+			return 0, err
+		}
+		p.buf = p.buf[i+1:]
+	}
+	return len(b), nil
+}
+
+// Flush writes any partial line.
+func (p *prefixWriter) Flush() error {
+	if len(p.buf) == 0 {
+		return nil
+	}
+	line := append(p.buf, '\n')
+	p.buf = nil
+	return p.writeLine(line)
+}
+
+func (p *prefixWriter) writeLine(line []byte) error {
+	_, err := fmt.Fprintf(p.w, "[%s] %s %s", p.bpID, time.Now().UTC().Format(outputTimeLayout), line)
+	return err
+}
+
+// lockedWriter allows stdout and stderr to be written to the same file.
+type lockedWriter struct {
+	mu sync.Mutex
+	w  io.Writer
+}
+
+func (l *lockedWriter) Write(b []byte) (int, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.w.Write(b)
+}
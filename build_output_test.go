@@ -0,0 +1,130 @@
+package lifecycle_test
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"regexp"
+	"runtime"
+	"strings"
+	"testing"
+
+	"github.com/sclevine/spec"
+	"github.com/sclevine/spec/report"
+
+	"github.com/buildpacks/lifecycle"
+	"github.com/buildpacks/lifecycle/api"
+	"github.com/buildpacks/lifecycle/env"
+	h "github.com/buildpacks/lifecycle/testhelpers"
+)
+
+func TestBuildOutput(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("buildpack executables are shell scripts")
+	}
+	spec.Run(t, "BuildOutput", testBuildOutput, spec.Report(report.Terminal{}))
+}
+
+func testBuildOutput(t *testing.T, when spec.G, it spec.S) {
+	var (
+		bpTOML         *lifecycle.BuildpackTOML
+		config         lifecycle.BuildConfig
+		tmpDir         string
+		stdout, stderr *bytes.Buffer
+	)
+
+	it.Before(func() {
+		var err error
+		tmpDir, err = ioutil.TempDir("", "build-output")
+		h.AssertNil(t, err)
+		appDir := filepath.Join(tmpDir, "app")
+		platformDir := filepath.Join(tmpDir, "platform")
+		bpDir := filepath.Join(tmpDir, "buildpack")
+		h.Mkdir(t, appDir, filepath.Join(platformDir, "env"), filepath.Join(bpDir, "bin"))
+		script := "#!/usr/bin/env bash\necho out line\necho err line >&2\nprintf partial\n"
+		h.AssertNil(t, ioutil.WriteFile(filepath.Join(bpDir, "bin", "build"), []byte(script), 0755))
+
+		bpTOML = &lifecycle.BuildpackTOML{
+			API:       api.Buildpack.Latest().String(),
+			Buildpack: lifecycle.BuildpackInfo{ID: "some/buildpack", Version: "v1"},
+			Dir:       bpDir,
+		}
+		stdout, stderr = &bytes.Buffer{}, &bytes.Buffer{}
+		config = lifecycle.BuildConfig{
+			Env:         env.NewBuildEnv(os.Environ()),
+			AppDir:      appDir,
+			PlatformDir: platformDir,
+			LayersDir:   filepath.Join(tmpDir, "layers"),
+			Out:         stdout,
+			Err:         stderr,
+		}
+	})
+
+	it.After(func() {
+		os.RemoveAll(tmpDir)
+	})
+
+	it("writes output unchanged by default", func() {
+		_, err := bpTOML.Build(lifecycle.BuildpackPlan{}, config)
+		h.AssertNil(t, err)
+
+		h.AssertEq(t, stdout.String(), "out line\npartial")
+		h.AssertEq(t, stderr.String(), "err line\n")
+	})
+
+	when("output is prefixed", func() {
+		it.Before(func() {
+			config.PrefixOutput = true
+		})
+
+		it("prefixes each line with the buildpack ID and a timestamp", func() {
+			_, err := bpTOML.Build(lifecycle.BuildpackPlan{}, config)
+			h.AssertNil(t, err)
+
+			prefix := `\[some/buildpack\] \d{4}-\d{2}-\d{2}T\d{2}:\d{2}:\d{2}\.\d{3}Z `
+			assertMatches(t, stdout.String(), "^"+prefix+"out line\n"+prefix+"partial\n$")
+			assertMatches(t, stderr.String(), "^"+prefix+"err line\n$")
+		})
+	})
+
+	when("output is captured", func() {
+		var logsDir string
+
+		it.Before(func() {
+			logsDir = filepath.Join(tmpDir, "layers", "+logs")
+			config.LogsDir = logsDir
+		})
+
+		it("saves stdout and stderr of each buildpack to a file", func() {
+			_, err := bpTOML.Build(lifecycle.BuildpackPlan{}, config)
+			h.AssertNil(t, err)
+
+			path := lifecycle.BuildOutputPath(logsDir, "some/buildpack")
+			h.AssertEq(t, path, filepath.Join(logsDir, "some_buildpack.log"))
+			contents := h.Rdfile(t, path)
+			for _, line := range []string{"out line\n", "err line\n", "partial"} {
+				if !strings.Contains(contents, line) {
+					t.Fatalf("Expected captured output to contain %q, got:\n%s", line, contents)
+				}
+			}
+			h.AssertEq(t, stdout.String(), "out line\npartial")
+		})
+
+		it("saves the output when the build fails", func() {
+			h.AssertNil(t, ioutil.WriteFile(filepath.Join(bpTOML.Dir, "bin", "build"), []byte("#!/usr/bin/env bash\necho failing\nexit 1\n"), 0755))
+
+			_, err := bpTOML.Build(lifecycle.BuildpackPlan{}, config)
+			h.AssertNotNil(t, err)
+
+			h.AssertEq(t, h.Rdfile(t, lifecycle.BuildOutputPath(logsDir, "some/buildpack")), "failing\n")
+		})
+	})
+}
+
+func assertMatches(t *testing.T, actual, pattern string) {
+	t.Helper()
+	if !regexp.MustCompile(pattern).MatchString(actual) {
+		t.Fatalf("Expected %q to match %q", actual, pattern)
+	}
+}
@@ -34,10 +34,20 @@ type BuildConfig struct {
 	LayersDir   string
 	Out         io.Writer
 	Err         io.Writer
+	Limits      ExecLimits
+	// PrefixOutput prefixes each line of build output with the buildpack ID and a timestamp.
+	PrefixOutput bool
+	// LogsDir, when set, is where the output of each buildpack is saved.
+	LogsDir string
+	// DeprecationMode decides whether unknown keys in files written by buildpacks are errors or warnings.
+	// Unknown keys are ignored when it is empty.
+	DeprecationMode string
+	Logger          Logger
 }
 
 type BuildResult struct {
 	BOM         []BOMEntry
+	BuildBOM    []BOMEntry
 	Labels      []Label
 	MetRequires []string
 	Processes   []launch.Process
@@ -68,6 +78,15 @@ type Builder struct {
 	Plan           BuildPlan
 	Out, Err       io.Writer
 	BuildpackStore BuildpackStore
+	Limits         ExecLimits
+	PrefixOutput   bool
+	LogsDir        string
+	// CheckpointPath, when set, is where progress is recorded after each buildpack. It is removed once the build succeeds.
+	CheckpointPath string
+	// ResumeFrom is the ID of the buildpack to resume a failed build from, using the checkpoint at CheckpointPath.
+	ResumeFrom      string
+	DeprecationMode string
+	Logger          Logger
 }
 
 func (b *Builder) Build() (*BuildMetadata, error) {
@@ -78,37 +97,73 @@ func (b *Builder) Build() (*BuildMetadata, error) {
 
 	procMap := processMap{}
 	plan := b.Plan
-	var bom []BOMEntry
+	var bom, buildBOM []BOMEntry
 	var slices []layers.Slice
 	var labels []Label
+	add := func(br BuildResult) {
+		bom = append(bom, br.BOM...)
+		buildBOM = append(buildBOM, br.BuildBOM...)
+		labels = append(labels, br.Labels...)
+		plan = plan.filter(br.MetRequires)
+		procMap.add(br.Processes)
+		slices = append(slices, br.Slices...)
+	}
 
-	for _, bp := range b.Group.Group {
+	var checkpoint BuildCheckpoint
+	if b.ResumeFrom != "" {
+		if checkpoint.Buildpacks, err = b.resume(config); err != nil {
+			return nil, err
+		}
+	}
+
+	for i, bp := range b.Group.Group {
 		bpTOML, err := b.BuildpackStore.Lookup(bp.ID, bp.Version)
 		if err != nil {
 			return nil, err
 		}
 
+		if i < len(checkpoint.Buildpacks) {
+			if r, ok := bpTOML.(envRestorer); ok {
+				if err := r.restoreEnv(config); err != nil {
+					return nil, err
+				}
+			}
+			add(checkpoint.Buildpacks[i].result())
+			continue
+		}
+
 		bpPlan := plan.find(bp.ID)
 		br, err := bpTOML.Build(bpPlan, config)
 		if err != nil {
 			return nil, err
 		}
+		add(br)
 
-		bom = append(bom, br.BOM...)
-		labels = append(labels, br.Labels...)
-		plan = plan.filter(br.MetRequires)
-		procMap.add(br.Processes)
-		slices = append(slices, br.Slices...)
+		if b.CheckpointPath != "" {
+			if err := b.checkpoint(&checkpoint, config, bp, br); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	if b.CheckpointPath != "" {
+		if err := b.removeCheckpoint(); err != nil {
+			return nil, err
+		}
 	}
 
 	if b.PlatformAPI.Compare(api.MustParse("0.4")) < 0 { // PlatformAPI <= 0.3
 		for i := range bom {
 			bom[i].convertMetadataToVersion()
 		}
+		for i := range buildBOM {
+			buildBOM[i].convertMetadataToVersion()
+		}
 	}
 
 	return &BuildMetadata{
 		BOM:        bom,
+		BuildBOM:   buildBOM,
 		Buildpacks: b.Group.Group,
 		Labels:     labels,
 		Processes:  procMap.list(),
@@ -131,12 +186,17 @@ func (b *Builder) BuildConfig() (BuildConfig, error) {
 	}
 
 	return BuildConfig{
-		Env:         b.Env,
-		AppDir:      appDir,
-		PlatformDir: platformDir,
-		LayersDir:   layersDir,
-		Out:         b.Out,
-		Err:         b.Err,
+		Env:             b.Env,
+		AppDir:          appDir,
+		PlatformDir:     platformDir,
+		LayersDir:       layersDir,
+		Out:             b.Out,
+		Err:             b.Err,
+		Limits:          b.Limits,
+		PrefixOutput:    b.PrefixOutput,
+		LogsDir:         b.LogsDir,
+		DeprecationMode: b.DeprecationMode,
+		Logger:          b.Logger,
 	}, nil
 }
 
@@ -204,6 +204,42 @@ func testBuilder(t *testing.T, when spec.G, it spec.S) {
 							t.Fatalf("Unexpected:\n%s\n", s)
 						}
 					})
+
+					it("should keep the build BOM separate from the launch BOM", func() {
+						bpA := testmock.NewMockBuildpack(mockCtrl)
+						buildpackStore.EXPECT().Lookup("A", "v1").Return(bpA, nil)
+						bpA.EXPECT().Build(gomock.Any(), config).Return(lifecycle.BuildResult{
+							BOM: []lifecycle.BOMEntry{
+								{Require: lifecycle.Require{Name: "runtime"}, Buildpack: lifecycle.GroupBuildpack{ID: "A", Version: "v1"}},
+							},
+							BuildBOM: []lifecycle.BOMEntry{
+								{Require: lifecycle.Require{Name: "compiler"}, Buildpack: lifecycle.GroupBuildpack{ID: "A", Version: "v1"}},
+							},
+						}, nil)
+						bpB := testmock.NewMockBuildpack(mockCtrl)
+						buildpackStore.EXPECT().Lookup("B", "v2").Return(bpB, nil)
+						bpB.EXPECT().Build(gomock.Any(), config).Return(lifecycle.BuildResult{
+							BuildBOM: []lifecycle.BOMEntry{
+								{Require: lifecycle.Require{Name: "linker"}, Buildpack: lifecycle.GroupBuildpack{ID: "B", Version: "v2"}},
+							},
+						}, nil)
+
+						metadata, err := builder.Build()
+						if err != nil {
+							t.Fatalf("Unexpected error:\n%s\n", err)
+						}
+						if s := cmp.Diff(metadata.BOM, []lifecycle.BOMEntry{
+							{Require: lifecycle.Require{Name: "runtime"}, Buildpack: lifecycle.GroupBuildpack{ID: "A", Version: "v1"}},
+						}); s != "" {
+							t.Fatalf("Unexpected:\n%s\n", s)
+						}
+						if s := cmp.Diff(metadata.BuildBOM, []lifecycle.BOMEntry{
+							{Require: lifecycle.Require{Name: "compiler"}, Buildpack: lifecycle.GroupBuildpack{ID: "A", Version: "v1"}},
+							{Require: lifecycle.Require{Name: "linker"}, Buildpack: lifecycle.GroupBuildpack{ID: "B", Version: "v2"}},
+						}); s != "" {
+							t.Fatalf("Unexpected:\n%s\n", s)
+						}
+					})
 				})
 
 				when("buildpacks", func() {
@@ -408,6 +444,134 @@ func testBuilder(t *testing.T, when spec.G, it spec.S) {
 			})
 		})
 
+		when("checkpointing", func() {
+			var checkpointPath string
+
+			it.Before(func() {
+				checkpointPath = filepath.Join(layersDir, "build-checkpoint.toml")
+				builder.CheckpointPath = checkpointPath
+				builder.Plan = lifecycle.BuildPlan{
+					Entries: []lifecycle.BuildPlanEntry{
+						{
+							Providers: []lifecycle.GroupBuildpack{{ID: "A", Version: "v1"}, {ID: "B", Version: "v2"}},
+							Requires:  []lifecycle.Require{{Name: "some-dep"}},
+						},
+						{
+							Providers: []lifecycle.GroupBuildpack{{ID: "A", Version: "v1"}, {ID: "B", Version: "v2"}},
+							Requires:  []lifecycle.Require{{Name: "other-dep"}},
+						},
+					},
+				}
+				h.Mkdir(t, filepath.Join(layersDir, "A"))
+				h.Mkfile(t, "", filepath.Join(layersDir, "A", "launch.toml"), filepath.Join(layersDir, "A", "some-layer.toml"))
+			})
+
+			it("should record each buildpack that completes", func() {
+				bpA := testmock.NewMockBuildpack(mockCtrl)
+				buildpackStore.EXPECT().Lookup("A", "v1").Return(bpA, nil)
+				bpA.EXPECT().Build(gomock.Any(), config).Return(lifecycle.BuildResult{
+					MetRequires: []string{"some-dep"},
+					Processes:   []launch.Process{{Type: "web", Command: "some-command", BuildpackID: "A"}},
+				}, nil)
+				bpB := testmock.NewMockBuildpack(mockCtrl)
+				buildpackStore.EXPECT().Lookup("B", "v2").Return(bpB, nil)
+				bpB.EXPECT().Build(gomock.Any(), config).Return(lifecycle.BuildResult{}, errors.New("some error"))
+
+				_, err := builder.Build()
+				h.AssertError(t, err, "some error")
+
+				checkpoint, err := lifecycle.ReadBuildCheckpoint(checkpointPath)
+				h.AssertNil(t, err)
+				h.AssertEq(t, len(checkpoint.Buildpacks), 1)
+				h.AssertEq(t, checkpoint.Buildpacks[0].ID, "A")
+				h.AssertEq(t, checkpoint.Buildpacks[0].Version, "v1")
+				h.AssertEq(t, checkpoint.Buildpacks[0].MetRequires, []string{"some-dep"})
+				h.AssertEq(t, checkpoint.Buildpacks[0].Layers, []string{"some-layer"})
+				h.AssertEq(t, checkpoint.Buildpacks[0].Processes[0].Command, "some-command")
+			})
+
+			it("should remove the checkpoint when the build succeeds", func() {
+				bpA := testmock.NewMockBuildpack(mockCtrl)
+				buildpackStore.EXPECT().Lookup("A", "v1").Return(bpA, nil)
+				bpA.EXPECT().Build(gomock.Any(), config).Return(lifecycle.BuildResult{}, nil)
+				bpB := testmock.NewMockBuildpack(mockCtrl)
+				buildpackStore.EXPECT().Lookup("B", "v2").Return(bpB, nil)
+				bpB.EXPECT().Build(gomock.Any(), config).Return(lifecycle.BuildResult{}, nil)
+
+				_, err := builder.Build()
+				h.AssertNil(t, err)
+
+				h.AssertPathDoesNotExist(t, checkpointPath)
+			})
+
+			when("resuming", func() {
+				it.Before(func() {
+					h.AssertNil(t, lifecycle.WriteTOML(checkpointPath, lifecycle.BuildCheckpoint{
+						Buildpacks: []lifecycle.BuildpackCheckpoint{{
+							ID:          "A",
+							Version:     "v1",
+							MetRequires: []string{"some-dep"},
+							Processes:   []launch.Process{{Type: "web", Command: "some-command", BuildpackID: "A"}},
+							Layers:      []string{"some-layer"},
+						}},
+					}))
+					builder.ResumeFrom = "B"
+				})
+
+				it("should only build from the named buildpack", func() {
+					bpA := testmock.NewMockBuildpack(mockCtrl)
+					buildpackStore.EXPECT().Lookup("A", "v1").Return(bpA, nil)
+					bpB := testmock.NewMockBuildpack(mockCtrl)
+					buildpackStore.EXPECT().Lookup("B", "v2").Return(bpB, nil)
+					bpB.EXPECT().Build(lifecycle.BuildpackPlan{Entries: []lifecycle.Require{{Name: "other-dep"}}}, config).Return(lifecycle.BuildResult{
+						Processes: []launch.Process{{Type: "worker", Command: "other-command", BuildpackID: "B"}},
+					}, nil)
+
+					metadata, err := builder.Build()
+					h.AssertNil(t, err)
+					h.AssertEq(t, metadata.Processes, []launch.Process{
+						{Type: "web", Command: "some-command", BuildpackID: "A"},
+						{Type: "worker", Command: "other-command", BuildpackID: "B"},
+					})
+				})
+
+				it("should fail when a layer of an earlier buildpack is missing", func() {
+					h.AssertNil(t, os.Remove(filepath.Join(layersDir, "A", "some-layer.toml")))
+
+					_, err := builder.Build()
+					h.AssertError(t, err, "cannot resume from buildpack 'B': layer 'some-layer' of buildpack 'A@v1' is missing")
+				})
+
+				it("should fail when the contents of a build layer of an earlier buildpack are missing", func() {
+					h.Mkfile(t, "build = true", filepath.Join(layersDir, "A", "some-layer.toml"))
+
+					_, err := builder.Build()
+					h.AssertError(t, err, "cannot resume from buildpack 'B': layer 'some-layer' of buildpack 'A@v1' is missing")
+				})
+
+				it("should fail when an earlier buildpack did not complete", func() {
+					builder.Group.Group = append([]lifecycle.GroupBuildpack{{ID: "C", Version: "v1"}}, builder.Group.Group...)
+
+					_, err := builder.Build()
+					h.AssertError(t, err, "cannot resume from buildpack 'B': buildpack 'C@v1' did not complete before the checkpoint")
+				})
+
+				it("should fail when the buildpack is not in the group", func() {
+					builder.ResumeFrom = "D"
+
+					_, err := builder.Build()
+					h.AssertError(t, err, "cannot resume from buildpack 'D': buildpack is not in the group")
+				})
+
+				it("should fail when there is no checkpoint", func() {
+					h.AssertNil(t, os.Remove(checkpointPath))
+
+					_, err := builder.Build()
+					h.AssertError(t, err, "cannot resume from buildpack 'B': no build checkpoint found")
+				})
+			})
+		})
+
 		when("platform api < 0.4", func() {
 			it.Before(func() {
 				builder.PlatformAPI = api.MustParse("0.3")
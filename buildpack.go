@@ -55,4 +55,7 @@ type BuildpackInfo struct {
 	Name     string `toml:"name"`
 	ClearEnv bool   `toml:"clear-env,omitempty"`
 	Homepage string `toml:"homepage,omitempty"`
+	// DetectInputs are patterns of the app files inspected by bin/detect, used to key cached detect results.
+	// When empty, the whole app dir is an input.
+	DetectInputs []string `toml:"detect-inputs,omitempty"`
 }
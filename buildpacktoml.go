@@ -11,6 +11,7 @@ import (
 	"github.com/BurntSushi/toml"
 
 	"github.com/buildpacks/lifecycle/api"
+	"github.com/buildpacks/lifecycle/cmd"
 	"github.com/buildpacks/lifecycle/env"
 	"github.com/buildpacks/lifecycle/launch"
 	"github.com/buildpacks/lifecycle/layers"
@@ -80,6 +81,10 @@ func (b *BuildpackTOML) Build(bpPlan BuildpackPlan, config BuildConfig) (BuildRe
 		return BuildResult{}, err
 	}
 
+	if err := b.validateOutputFiles(bpLayersDir, config); err != nil {
+		return BuildResult{}, err
+	}
+
 	if err := b.setupEnv(config.Env, bpLayersDir); err != nil {
 		return BuildResult{}, err
 	}
@@ -113,8 +118,6 @@ func (b *BuildpackTOML) runBuildCmd(bpLayersDir, bpPlanPath string, config Build
 		bpPlanPath,
 	)
 	cmd.Dir = config.AppDir
-	cmd.Stdout = config.Out
-	cmd.Stderr = config.Err
 
 	var err error
 	if b.Buildpack.ClearEnv {
@@ -127,7 +130,21 @@ func (b *BuildpackTOML) runBuildCmd(bpLayersDir, bpPlanPath string, config Build
 	}
 	cmd.Env = append(cmd.Env, EnvBuildpackDir+"="+b.Dir)
 
-	if err := cmd.Run(); err != nil {
+	stdout, stderr, closeOutput, err := config.buildOutput(b.Buildpack.ID)
+	if err != nil {
+		return err
+	}
+	cmd.Stdout = stdout
+	cmd.Stderr = stderr
+
+	err = config.Limits.run(cmd, b.Buildpack.ID+"@"+b.Buildpack.Version, "build")
+	if closeErr := closeOutput(); closeErr != nil && err == nil {
+		return fmt.Errorf("closing build output: %s", closeErr)
+	}
+	if err != nil {
+		if _, ok := err.(*TimeoutError); ok {
+			return NewLifecycleError(err, ErrTypeBuildpackTimeout)
+		}
 		return NewLifecycleError(err, ErrTypeBuildpack)
 	}
 	return nil
@@ -181,6 +198,60 @@ func isBuild(path string) bool {
 	return err == nil && layerTOML.Build
 }
 
+// validateOutputFiles checks the TOML files written by the buildpack against the schemas of its buildpack API.
+// Values of the wrong type in launch.toml and build.toml always fail the build, as readOutputFiles cannot decode them.
+// Other issues fail or warn according to the deprecation mode.
+func (b *BuildpackTOML) validateOutputFiles(bpLayersDir string, config BuildConfig) error {
+	bp := GroupBuildpack{ID: b.Buildpack.ID, Version: b.Buildpack.Version}.String()
+	var (
+		issues SchemaIssues
+		fatal  bool
+	)
+	check := func(path string, v interface{}, decoded bool, excluded ...string) error {
+		found, err := checkTOMLSchema(path, bp, v, excluded...)
+		issues = append(issues, found...)
+		fatal = fatal || decoded && found.hasMismatch()
+		return err
+	}
+
+	var err error
+	if api.MustParse(b.API).Compare(api.MustParse("0.5")) < 0 { // buildpack API <= 0.4
+		err = check(filepath.Join(bpLayersDir, "launch.toml"), LaunchTOML{}, true, "bom")
+	} else {
+		if err = check(filepath.Join(bpLayersDir, "build.toml"), BuildTOML{}, true); err == nil {
+			err = check(filepath.Join(bpLayersDir, "launch.toml"), LaunchTOML{}, true)
+		}
+	}
+	if err != nil {
+		return err
+	}
+	if err := check(filepath.Join(bpLayersDir, "store.toml"), StoreTOML{}, false); err != nil {
+		return err
+	}
+	layerNames, err := bpLayerNames(bpLayersDir)
+	if err != nil {
+		return err
+	}
+	for _, name := range layerNames {
+		if err := check(filepath.Join(bpLayersDir, name+".toml"), BuildpackLayerMetadataFile{}, false); err != nil {
+			return err
+		}
+	}
+
+	if len(issues) == 0 {
+		return nil
+	}
+	if fatal || config.DeprecationMode == cmd.DeprecationModeError {
+		return NewLifecycleError(issues, ErrTypeBuildpack)
+	}
+	if config.DeprecationMode == cmd.DeprecationModeWarn && config.Logger != nil {
+		for _, issue := range issues {
+			config.Logger.Warn(issue.Error())
+		}
+	}
+	return nil
+}
+
 func (b *BuildpackTOML) readOutputFiles(bpLayersDir, bpPlanPath string, bpPlanIn BuildpackPlan) (BuildResult, error) {
 	br := BuildResult{}
 	bpFromBpInfo := GroupBuildpack{ID: b.Buildpack.ID, Version: b.Buildpack.Version}
@@ -222,6 +293,7 @@ func (b *BuildpackTOML) readOutputFiles(bpLayersDir, bpPlanPath string, bpPlanIn
 		if err := validateBOM(bpBuild.BOM, b.API); err != nil {
 			return BuildResult{}, err
 		}
+		br.BuildBOM = withBuildpack(bpFromBpInfo, bpBuild.BOM)
 
 		// set MetRequires
 		if err := validateUnmet(bpBuild.Unmet, bpPlanIn); err != nil {
@@ -256,6 +256,46 @@ func testBuildpackTOML(t *testing.T, when spec.G, it spec.S) {
 					}
 				})
 
+				it("should get build bom entries from build.toml", func() {
+					h.Mkfile(t,
+						"[[bom]]\n"+
+							`name = "some-runtime"`+"\n",
+						filepath.Join(appDir, "launch-A-v1.toml"),
+					)
+					h.Mkfile(t,
+						"[[bom]]\n"+
+							`name = "some-compiler"`+"\n"+
+							"[bom.metadata]\n"+
+							`version = "v1"`+"\n",
+						filepath.Join(appDir, "build-A-v1.toml"),
+					)
+
+					br, err := bpTOML.Build(lifecycle.BuildpackPlan{}, config)
+					if err != nil {
+						t.Fatalf("Unexpected error:\n%s\n", err)
+					}
+
+					if s := cmp.Diff(br.BOM, []lifecycle.BOMEntry{
+						{
+							Require:   lifecycle.Require{Name: "some-runtime"},
+							Buildpack: lifecycle.GroupBuildpack{ID: "A", Version: "v1"},
+						},
+					}); s != "" {
+						t.Fatalf("Unexpected:\n%s\n", s)
+					}
+					if s := cmp.Diff(br.BuildBOM, []lifecycle.BOMEntry{
+						{
+							Require: lifecycle.Require{
+								Name:     "some-compiler",
+								Metadata: map[string]interface{}{"version": "v1"},
+							},
+							Buildpack: lifecycle.GroupBuildpack{ID: "A", Version: "v1"},
+						},
+					}); s != "" {
+						t.Fatalf("Unexpected:\n%s\n", s)
+					}
+				})
+
 				it("should include labels", func() {
 					h.Mkfile(t,
 						"[[labels]]\n"+
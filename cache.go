@@ -1,9 +1,29 @@
 package lifecycle
 
 import (
+	"os"
+	"runtime"
+	"sync"
+
 	"github.com/pkg/errors"
+
+	"github.com/buildpacks/lifecycle/layers"
 )
 
+// cacheLayer is a buildpack layer being written to the cache.
+type cacheLayer struct {
+	bpIndex     int
+	buildpack   GroupBuildpack
+	name        string
+	dir         layerDir
+	metadata    BuildpackLayerMetadata
+	previousSHA string
+
+	done  chan struct{} // done is closed once the layer is created, and written when the cache allows concurrent writes
+	layer layers.Layer
+	err   error
+}
+
 func (e *Exporter) Cache(layersDir string, cacheStore Cache) error {
 	var err error
 	if !cacheStore.Exists() {
@@ -14,20 +34,37 @@ func (e *Exporter) Cache(layersDir string, cacheStore Cache) error {
 		return errors.Wrap(err, "metadata for previous cache")
 	}
 	meta := CacheMetadata{}
+	e.cacheStats.reset()
 
-	for _, bp := range e.Buildpacks {
+	var pending []*cacheLayer
+	for i, bp := range e.Buildpacks {
 		bpDir, err := readBuildpackLayersDir(layersDir, bp)
 		if err != nil {
 			return errors.Wrapf(err, "reading layers for buildpack '%s'", bp.ID)
 		}
 
-		bpMD := BuildpackLayersMetadata{
+		meta.Buildpacks = append(meta.Buildpacks, BuildpackLayersMetadata{
 			ID:      bp.ID,
 			Version: bp.Version,
 			Layers:  map[string]BuildpackLayerMetadata{},
-		}
+		})
 		for _, layer := range bpDir.findLayers(forCached) {
 			layer := layer
+			if marker, ok := layer.notRestored(); ok {
+				if err := e.reuseUnrestoredCacheLayer(cacheStore, &layer, marker, origMeta.MetadataForBuildpack(bp.ID).Layers[layer.name()].SHA); err != nil {
+					e.Logger.Warnf("Failed to cache layer '%s': %s", layer.Identifier(), err)
+					continue
+				}
+				lmd, err := layer.read()
+				if err != nil {
+					e.Logger.Warnf("Failed to cache layer '%s' because of error reading metadata: %s", layer.Identifier(), err)
+					continue
+				}
+				lmd.SHA = marker.SHA
+				meta.Buildpacks[i].Layers[layer.name()] = lmd
+				e.cacheStats.hit(bp)
+				continue
+			}
 			if !layer.hasLocalContents() {
 				e.Logger.Warnf("Failed to cache layer '%s' because it has no contents", layer.Identifier())
 				continue
@@ -37,14 +74,47 @@ func (e *Exporter) Cache(layersDir string, cacheStore Cache) error {
 				e.Logger.Warnf("Failed to cache layer '%s' because of error reading metadata: %s", layer.Identifier(), err)
 				continue
 			}
-			origLayerMetadata := origMeta.MetadataForBuildpack(bp.ID).Layers[layer.name()]
-			if lmd.SHA, err = e.addOrReuseCacheLayer(cacheStore, &layer, origLayerMetadata.SHA); err != nil {
-				e.Logger.Warnf("Failed to cache layer '%s': %s", layer.Identifier(), err)
-				continue
+			pending = append(pending, &cacheLayer{
+				bpIndex:     i,
+				buildpack:   bp,
+				name:        layer.name(),
+				dir:         &layer,
+				metadata:    lmd,
+				previousSHA: origMeta.MetadataForBuildpack(bp.ID).Layers[layer.name()].SHA,
+				done:        make(chan struct{}),
+			})
+		}
+	}
+
+	e.writeCacheLayers(cacheStore, pending)
+
+	// Results are reported in buildpack order so that the logs and metadata do not depend on scheduling.
+	for _, l := range pending {
+		if l.err != nil {
+			e.Logger.Warnf("Failed to cache layer '%s': %s", l.dir.Identifier(), l.err)
+			continue
+		}
+		if l.layer.Digest == l.previousSHA {
+			e.Logger.Infof("Reusing cache layer '%s'\n", l.layer.ID)
+			e.cacheStats.hit(l.buildpack)
+		} else {
+			e.Logger.Infof("Adding cache layer '%s'\n", l.layer.ID)
+			size := int64(0)
+			if fi, err := os.Stat(l.layer.TarPath); err == nil {
+				size = fi.Size()
 			}
-			bpMD.Layers[layer.name()] = lmd
+			e.cacheStats.record(l.buildpack, func(s *BuildpackCacheStats) {
+				if l.previousSHA == "" {
+					s.Miss++
+				} else {
+					s.Stale++
+				}
+				s.BytesUploaded += size
+			})
 		}
-		meta.Buildpacks = append(meta.Buildpacks, bpMD)
+		e.Logger.Debugf("Layer '%s' SHA: %s\n", l.layer.ID, l.layer.Digest)
+		l.metadata.SHA = l.layer.Digest
+		meta.Buildpacks[l.bpIndex].Layers[l.name] = l.metadata
 	}
 
 	if err := cacheStore.SetMetadata(meta); err != nil {
@@ -53,21 +123,85 @@ func (e *Exporter) Cache(layersDir string, cacheStore Cache) error {
 	if err := cacheStore.Commit(); err != nil {
 		return errors.Wrap(err, "committing cache")
 	}
+	if tc, ok := cacheStore.(TransferStatsCache); ok {
+		stats := tc.TransferStats()
+		e.Logger.Infof("Cache transfer: uploaded %d blob(s) (%s), mounted %d, skipped %d unchanged",
+			stats.BlobsUploaded, humanSize(stats.BytesUploaded), stats.BlobsMounted, stats.BlobsSkipped)
+	}
 
 	return nil
 }
 
-func (e *Exporter) addOrReuseCacheLayer(cache Cache, layerDir layerDir, previousSHA string) (string, error) {
-	layer, err := e.LayerFactory.DirLayer(layerDir.Identifier(), layerDir.Path())
-	if err != nil {
-		return "", errors.Wrapf(err, "creating layer '%s'", layerDir.Identifier())
+// writeCacheLayers creates the layer tarballs with at most CacheConcurrency workers.
+// Caches that allow concurrent writes receive each layer from the worker that created it,
+// other caches receive the layers one at a time, in order, as they become available.
+func (e *Exporter) writeCacheLayers(cacheStore Cache, pending []*cacheLayer) {
+	concurrent := false
+	if cc, ok := cacheStore.(ConcurrentCache); ok {
+		concurrent = cc.ConcurrentWrites()
 	}
-	if layer.Digest == previousSHA {
-		e.Logger.Infof("Reusing cache layer '%s'\n", layer.ID)
-		e.Logger.Debugf("Layer '%s' SHA: %s\n", layer.ID, layer.Digest)
-		return layer.Digest, cache.ReuseLayer(previousSHA)
+
+	var wg sync.WaitGroup
+	if !concurrent {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for _, l := range pending {
+				<-l.done
+				if l.err == nil {
+					l.err = writeCacheLayer(cacheStore, l)
+				}
+			}
+		}()
+	}
+
+	sem := make(chan struct{}, e.cacheConcurrency())
+	for _, l := range pending {
+		l := l
+		sem <- struct{}{}
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			defer close(l.done)
+			defer func() { <-sem }()
+			l.layer, l.err = e.LayerFactory.DirLayer(l.dir.Identifier(), l.dir.Path())
+			if l.err != nil {
+				l.err = errors.Wrapf(l.err, "creating layer '%s'", l.dir.Identifier())
+				return
+			}
+			if concurrent {
+				l.err = writeCacheLayer(cacheStore, l)
+			}
+		}()
+	}
+	wg.Wait()
+}
+
+// CacheStats returns the layers reused and added by Cache.
+// Added layers are a miss when the previous cache had no data for them, and stale when it had out of date data.
+func (e *Exporter) CacheStats() CacheStats {
+	return e.cacheStats.stats(e.Buildpacks)
+}
+
+// reuseUnrestoredCacheLayer keeps the cached data of a layer that was never restored, since it cannot have changed.
+func (e *Exporter) reuseUnrestoredCacheLayer(cacheStore Cache, layer layerDir, marker LazyRestoreMarker, previousSHA string) error {
+	if marker.SHA != previousSHA {
+		return errors.New("layer was not restored and is no longer in the cache")
+	}
+	e.Logger.Infof("Reusing cache layer '%s', not restored\n", layer.Identifier())
+	return cacheStore.ReuseLayer(marker.SHA)
+}
+
+func writeCacheLayer(cacheStore Cache, l *cacheLayer) error {
+	if l.layer.Digest == l.previousSHA {
+		return cacheStore.ReuseLayer(l.previousSHA)
+	}
+	return cacheStore.AddLayerFile(l.layer.TarPath, l.layer.Digest)
+}
+
+func (e *Exporter) cacheConcurrency() int {
+	if e.CacheConcurrency > 0 {
+		return e.CacheConcurrency
 	}
-	e.Logger.Infof("Adding cache layer '%s'\n", layer.ID)
-	e.Logger.Debugf("Layer '%s' SHA: %s\n", layer.ID, layer.Digest)
-	return layer.Digest, cache.AddLayerFile(layer.TarPath, layer.Digest)
+	return runtime.NumCPU()
 }
@@ -0,0 +1,369 @@
+package cache
+
+import (
+	"archive/tar"
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/buildpacks/imgutil"
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+	"github.com/google/go-containerregistry/pkg/v1/types"
+	"github.com/pkg/errors"
+
+	"github.com/buildpacks/lifecycle"
+)
+
+const (
+	ociLayoutFile     = "oci-layout"
+	ociIndexFile      = "index.json"
+	ociBlobsDir       = "blobs/sha256"
+	ociLayoutVersion  = `{"imageLayoutVersion":"1.0.0"}`
+	ociRefAnnotation  = "org.opencontainers.image.ref.name"
+	archiveRefName    = "cache"
+	archiveMaxMetaLen = 64 << 20
+)
+
+// Export writes the committed contents of the cache to w as a tarball of an OCI image layout.
+// The metadata is stored in the image config under MetadataLabel, as it is for an ImageCache.
+func Export(c lifecycle.Cache, w io.Writer) error {
+	tw := tar.NewWriter(w)
+	if err := exportArchive(c, &tarArchiveWriter{tw: tw}); err != nil {
+		return err
+	}
+	return tw.Close()
+}
+
+// ExportLayout writes the committed contents of the cache to dir as an OCI image layout.
+func ExportLayout(c lifecycle.Cache, dir string) error {
+	return exportArchive(c, &dirArchiveWriter{dir: dir})
+}
+
+// Import loads an archive written by Export or ExportLayout into the cache and commits it.
+// path may be a tarball or a layout directory. Every blob is verified against its digest before it is added.
+func Import(c lifecycle.Cache, path string) error {
+	fi, err := os.Stat(path)
+	if err != nil {
+		return errors.Wrap(err, "reading archive")
+	}
+	if fi.IsDir() {
+		return importLayout(c, path)
+	}
+	tmpDir, err := ioutil.TempDir("", "lifecycle.cache.import")
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(tmpDir)
+	if err := extractArchive(path, tmpDir); err != nil {
+		return errors.Wrap(err, "extracting archive")
+	}
+	return importLayout(c, tmpDir)
+}
+
+type archiveWriter interface {
+	writeFile(name string, r io.Reader, size int64) error
+}
+
+type tarArchiveWriter struct {
+	tw *tar.Writer
+}
+
+func (a *tarArchiveWriter) writeFile(name string, r io.Reader, size int64) error {
+	if err := a.tw.WriteHeader(&tar.Header{
+		Typeflag: tar.TypeReg,
+		Name:     name,
+		Size:     size,
+		Mode:     0644,
+		ModTime:  imgutil.NormalizedDateTime,
+	}); err != nil {
+		return err
+	}
+	_, err := io.Copy(a.tw, r)
+	return err
+}
+
+type dirArchiveWriter struct {
+	dir string
+}
+
+func (a *dirArchiveWriter) writeFile(name string, r io.Reader, _ int64) error {
+	path := filepath.Join(a.dir, filepath.FromSlash(name))
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	_, err = io.Copy(f, r)
+	return err
+}
+
+func exportArchive(c lifecycle.Cache, w archiveWriter) error {
+	meta, err := c.RetrieveMetadata()
+	if err != nil {
+		return errors.Wrap(err, "retrieving cache metadata")
+	}
+	metaJSON, err := json.Marshal(meta)
+	if err != nil {
+		return errors.Wrap(err, "marshalling cache metadata")
+	}
+
+	config := v1.ConfigFile{
+		OS:     "linux",
+		RootFS: v1.RootFS{Type: "layers"},
+		Config: v1.Config{Labels: map[string]string{MetadataLabel: string(metaJSON)}},
+	}
+	manifest := v1.Manifest{
+		SchemaVersion: 2,
+		MediaType:     types.OCIManifestSchema1,
+	}
+	for _, diffID := range cachedLayers(meta) {
+		desc, err := exportLayer(c, w, diffID)
+		if err != nil {
+			return err
+		}
+		config.RootFS.DiffIDs = append(config.RootFS.DiffIDs, desc.Digest)
+		manifest.Layers = append(manifest.Layers, desc)
+	}
+
+	configDesc, err := writeJSONBlob(w, config, types.OCIConfigJSON)
+	if err != nil {
+		return errors.Wrap(err, "writing config")
+	}
+	manifest.Config = configDesc
+	manifestDesc, err := writeJSONBlob(w, manifest, types.OCIManifestSchema1)
+	if err != nil {
+		return errors.Wrap(err, "writing manifest")
+	}
+	manifestDesc.Annotations = map[string]string{ociRefAnnotation: archiveRefName}
+
+	index, err := json.Marshal(v1.IndexManifest{
+		SchemaVersion: 2,
+		MediaType:     types.OCIImageIndex,
+		Manifests:     []v1.Descriptor{manifestDesc},
+	})
+	if err != nil {
+		return err
+	}
+	if err := w.writeFile(ociLayoutFile, strings.NewReader(ociLayoutVersion), int64(len(ociLayoutVersion))); err != nil {
+		return errors.Wrap(err, "writing layout")
+	}
+	if err := w.writeFile(ociIndexFile, bytes.NewReader(index), int64(len(index))); err != nil {
+		return errors.Wrap(err, "writing index")
+	}
+	return nil
+}
+
+// exportLayer copies a cached layer into the archive, verifying that its contents match the diffID.
+// Cached layers are uncompressed so the blob digest is the diffID.
+func exportLayer(c lifecycle.Cache, w archiveWriter, diffID string) (v1.Descriptor, error) {
+	rc, err := c.RetrieveLayer(diffID)
+	if err != nil {
+		return v1.Descriptor{}, err
+	}
+	defer rc.Close()
+	tmp, err := ioutil.TempFile("", "lifecycle.cache.layer")
+	if err != nil {
+		return v1.Descriptor{}, err
+	}
+	defer os.Remove(tmp.Name())
+	defer tmp.Close()
+
+	digest, size, err := copyWithDigest(tmp, rc)
+	if err != nil {
+		return v1.Descriptor{}, errors.Wrapf(err, "reading layer (%s)", diffID)
+	}
+	if digest != diffID {
+		return v1.Descriptor{}, fmt.Errorf("cached layer (%s) has digest '%s'", diffID, digest)
+	}
+	if _, err := tmp.Seek(0, io.SeekStart); err != nil {
+		return v1.Descriptor{}, err
+	}
+	hash, err := v1.NewHash(digest)
+	if err != nil {
+		return v1.Descriptor{}, err
+	}
+	if err := w.writeFile(blobPath(hash), tmp, size); err != nil {
+		return v1.Descriptor{}, errors.Wrapf(err, "writing layer (%s)", diffID)
+	}
+	return v1.Descriptor{MediaType: types.OCIUncompressedLayer, Size: size, Digest: hash}, nil
+}
+
+func writeJSONBlob(w archiveWriter, v interface{}, mediaType types.MediaType) (v1.Descriptor, error) {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return v1.Descriptor{}, err
+	}
+	hash, size, err := v1.SHA256(bytes.NewReader(data))
+	if err != nil {
+		return v1.Descriptor{}, err
+	}
+	if err := w.writeFile(blobPath(hash), bytes.NewReader(data), size); err != nil {
+		return v1.Descriptor{}, err
+	}
+	return v1.Descriptor{MediaType: mediaType, Size: size, Digest: hash}, nil
+}
+
+func importLayout(c lifecycle.Cache, dir string) error {
+	var index v1.IndexManifest
+	if err := readJSONFile(filepath.Join(dir, ociIndexFile), &index); err != nil {
+		return errors.Wrap(err, "reading index")
+	}
+	if len(index.Manifests) != 1 {
+		return fmt.Errorf("expected archive to contain 1 manifest, found %d", len(index.Manifests))
+	}
+
+	var manifest v1.Manifest
+	if err := readJSONBlob(dir, index.Manifests[0], &manifest); err != nil {
+		return errors.Wrap(err, "reading manifest")
+	}
+	var config v1.ConfigFile
+	if err := readJSONBlob(dir, manifest.Config, &config); err != nil {
+		return errors.Wrap(err, "reading config")
+	}
+	var meta lifecycle.CacheMetadata
+	if err := json.Unmarshal([]byte(config.Config.Labels[MetadataLabel]), &meta); err != nil {
+		return errors.Wrap(err, "reading cache metadata")
+	}
+	if len(manifest.Layers) != len(config.RootFS.DiffIDs) {
+		return fmt.Errorf("manifest has %d layers but config has %d diff IDs", len(manifest.Layers), len(config.RootFS.DiffIDs))
+	}
+
+	imported := map[string]bool{}
+	for i, desc := range manifest.Layers {
+		if desc.Digest != config.RootFS.DiffIDs[i] {
+			return fmt.Errorf("layer '%s' does not match diff ID '%s'", desc.Digest, config.RootFS.DiffIDs[i])
+		}
+		if err := verifyBlob(dir, desc); err != nil {
+			return err
+		}
+		if err := c.AddLayerFile(filepath.Join(dir, filepath.FromSlash(blobPath(desc.Digest))), desc.Digest.String()); err != nil {
+			return errors.Wrapf(err, "adding layer (%s)", desc.Digest)
+		}
+		imported[desc.Digest.String()] = true
+	}
+	for _, diffID := range cachedLayers(meta) {
+		if !imported[diffID] {
+			return fmt.Errorf("archive is missing layer (%s)", diffID)
+		}
+	}
+
+	if err := c.SetMetadata(meta); err != nil {
+		return errors.Wrap(err, "setting cache metadata")
+	}
+	return errors.Wrap(c.Commit(), "committing cache")
+}
+
+func readJSONBlob(dir string, desc v1.Descriptor, v interface{}) error {
+	if desc.Size > archiveMaxMetaLen {
+		return fmt.Errorf("blob '%s' is too large", desc.Digest)
+	}
+	if err := verifyBlob(dir, desc); err != nil {
+		return err
+	}
+	return readJSONFile(filepath.Join(dir, filepath.FromSlash(blobPath(desc.Digest))), v)
+}
+
+func readJSONFile(path string, v interface{}) error {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(data, v)
+}
+
+func verifyBlob(dir string, desc v1.Descriptor) error {
+	if desc.Digest.Algorithm != "sha256" {
+		return fmt.Errorf("unsupported digest algorithm '%s'", desc.Digest.Algorithm)
+	}
+	f, err := os.Open(filepath.Join(dir, filepath.FromSlash(blobPath(desc.Digest))))
+	if err != nil {
+		return errors.Wrapf(err, "opening blob '%s'", desc.Digest)
+	}
+	defer f.Close()
+	digest, size, err := copyWithDigest(ioutil.Discard, f)
+	if err != nil {
+		return errors.Wrapf(err, "reading blob '%s'", desc.Digest)
+	}
+	if digest != desc.Digest.String() || size != desc.Size {
+		return fmt.Errorf("blob '%s' failed verification: found digest '%s' and size %d", desc.Digest, digest, size)
+	}
+	return nil
+}
+
+func extractArchive(path, dir string) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	tr := tar.NewReader(f)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if hdr.Typeflag != tar.TypeReg {
+			continue
+		}
+		name := filepath.Clean(filepath.FromSlash(hdr.Name))
+		if filepath.IsAbs(name) || name == ".." || strings.HasPrefix(name, ".."+string(filepath.Separator)) {
+			return fmt.Errorf("invalid path '%s' in archive", hdr.Name)
+		}
+		if err := (&dirArchiveWriter{dir: dir}).writeFile(name, tr, hdr.Size); err != nil {
+			return err
+		}
+	}
+}
+
+// cachedLayers returns the distinct diffIDs referenced by the metadata, in metadata order.
+func cachedLayers(meta lifecycle.CacheMetadata) []string {
+	var diffIDs []string
+	seen := map[string]bool{}
+	for _, bp := range meta.Buildpacks {
+		for _, name := range sortedLayerNames(bp.Layers) {
+			sha := bp.Layers[name].SHA
+			if sha == "" || seen[sha] {
+				continue
+			}
+			seen[sha] = true
+			diffIDs = append(diffIDs, sha)
+		}
+	}
+	return diffIDs
+}
+
+func sortedLayerNames(layers map[string]lifecycle.BuildpackLayerMetadata) []string {
+	var names []string
+	for name := range layers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+func blobPath(hash v1.Hash) string {
+	return ociBlobsDir + "/" + hash.Hex
+}
+
+func copyWithDigest(w io.Writer, r io.Reader) (string, int64, error) {
+	h := sha256.New()
+	size, err := io.Copy(io.MultiWriter(w, h), r)
+	if err != nil {
+		return "", 0, err
+	}
+	return "sha256:" + hex.EncodeToString(h.Sum(nil)), size, nil
+}
@@ -0,0 +1,145 @@
+package cache_test
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/sclevine/spec"
+	"github.com/sclevine/spec/report"
+
+	"github.com/buildpacks/lifecycle"
+	"github.com/buildpacks/lifecycle/cache"
+	h "github.com/buildpacks/lifecycle/testhelpers"
+)
+
+func TestArchive(t *testing.T) {
+	spec.Run(t, "Archive", testArchive, spec.Parallel(), spec.Report(report.Terminal{}))
+}
+
+func testArchive(t *testing.T, when spec.G, it spec.S) {
+	var (
+		tmpDir    string
+		srcCache  *cache.VolumeCache
+		destCache *cache.VolumeCache
+		layerSHA  string
+	)
+
+	it.Before(func() {
+		var err error
+
+		tmpDir, err = ioutil.TempDir("", "lifecycle.cache.archive")
+		h.AssertNil(t, err)
+
+		for _, name := range []string{"src", "dest"} {
+			h.AssertNil(t, os.MkdirAll(filepath.Join(tmpDir, name), 0755))
+		}
+		srcCache, err = cache.NewVolumeCache(filepath.Join(tmpDir, "src"))
+		h.AssertNil(t, err)
+		destCache, err = cache.NewVolumeCache(filepath.Join(tmpDir, "dest"))
+		h.AssertNil(t, err)
+
+		layerPath := filepath.Join(tmpDir, "some-layer.tar")
+		h.AssertNil(t, ioutil.WriteFile(layerPath, []byte("some layer data"), 0600))
+		sum := sha256.Sum256([]byte("some layer data"))
+		layerSHA = "sha256:" + hex.EncodeToString(sum[:])
+
+		h.AssertNil(t, srcCache.AddLayerFile(layerPath, layerSHA))
+		h.AssertNil(t, srcCache.SetMetadata(lifecycle.CacheMetadata{
+			Buildpacks: []lifecycle.BuildpackLayersMetadata{{
+				ID:      "some.buildpack.id",
+				Version: "1.2.3",
+				Layers: map[string]lifecycle.BuildpackLayerMetadata{
+					"some-layer":       {LayerMetadata: lifecycle.LayerMetadata{SHA: layerSHA}},
+					"some-other-layer": {LayerMetadata: lifecycle.LayerMetadata{SHA: layerSHA}},
+				},
+			}},
+		}))
+		h.AssertNil(t, srcCache.Commit())
+		srcCache, err = cache.NewVolumeCache(filepath.Join(tmpDir, "src"))
+		h.AssertNil(t, err)
+	})
+
+	it.After(func() {
+		os.RemoveAll(tmpDir)
+	})
+
+	assertImported := func() {
+		t.Helper()
+		meta, err := destCache.RetrieveMetadata()
+		h.AssertNil(t, err)
+		h.AssertEq(t, meta.Buildpacks[0].Layers["some-layer"].SHA, layerSHA)
+
+		rc, err := destCache.RetrieveLayer(layerSHA)
+		h.AssertNil(t, err)
+		defer rc.Close()
+		data, err := ioutil.ReadAll(rc)
+		h.AssertNil(t, err)
+		h.AssertEq(t, string(data), "some layer data")
+	}
+
+	when("the archive is a tarball", func() {
+		it("round trips the cache", func() {
+			archivePath := filepath.Join(tmpDir, "cache.tar")
+			f, err := os.Create(archivePath)
+			h.AssertNil(t, err)
+			h.AssertNil(t, cache.Export(srcCache, f))
+			h.AssertNil(t, f.Close())
+
+			h.AssertNil(t, cache.Import(destCache, archivePath))
+			assertImported()
+		})
+
+		it("is reproducible", func() {
+			var first, second bytes.Buffer
+			h.AssertNil(t, cache.Export(srcCache, &first))
+			h.AssertNil(t, cache.Export(srcCache, &second))
+			h.AssertEq(t, first.Bytes(), second.Bytes())
+		})
+	})
+
+	when("the archive is an OCI layout", func() {
+		var layoutDir string
+
+		it.Before(func() {
+			layoutDir = filepath.Join(tmpDir, "layout")
+			h.AssertNil(t, cache.ExportLayout(srcCache, layoutDir))
+		})
+
+		it("round trips the cache", func() {
+			h.AssertNil(t, cache.Import(destCache, layoutDir))
+			assertImported()
+		})
+
+		it("writes an OCI layout", func() {
+			data, err := ioutil.ReadFile(filepath.Join(layoutDir, "oci-layout"))
+			h.AssertNil(t, err)
+			h.AssertEq(t, string(data), `{"imageLayoutVersion":"1.0.0"}`)
+			_, err = os.Stat(filepath.Join(layoutDir, "blobs", "sha256", strings.TrimPrefix(layerSHA, "sha256:")))
+			h.AssertNil(t, err)
+		})
+
+		it("fails when a layer does not match its digest", func() {
+			blob := filepath.Join(layoutDir, "blobs", "sha256", strings.TrimPrefix(layerSHA, "sha256:"))
+			h.AssertNil(t, ioutil.WriteFile(blob, []byte("some tampered data"), 0600))
+
+			err := cache.Import(destCache, layoutDir)
+			h.AssertError(t, err, "failed verification")
+			meta, err := destCache.RetrieveMetadata()
+			h.AssertNil(t, err)
+			h.AssertEq(t, len(meta.Buildpacks), 0)
+		})
+
+		it("fails when a layer is missing", func() {
+			h.AssertNil(t, os.Remove(filepath.Join(layoutDir, "blobs", "sha256", strings.TrimPrefix(layerSHA, "sha256:"))))
+
+			err := cache.Import(destCache, layoutDir)
+			h.AssertError(t, err, "opening blob '"+layerSHA+"'")
+		})
+	})
+}
@@ -0,0 +1,89 @@
+package cache
+
+import (
+	"fmt"
+	"net/url"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/buildpacks/lifecycle"
+)
+
+// BackendFactory creates a cache from a parsed cache URL.
+type BackendFactory func(u *url.URL) (lifecycle.Cache, error)
+
+var (
+	backendsMu sync.RWMutex
+	backends   = map[string]BackendFactory{}
+)
+
+func init() {
+	RegisterBackend("s3", func(u *url.URL) (lifecycle.Cache, error) {
+		store, err := NewS3StoreFromURL(u)
+		if err != nil {
+			return nil, err
+		}
+		return NewBlobCache(store), nil
+	})
+	RegisterBackend("file", func(u *url.URL) (lifecycle.Cache, error) {
+		return NewVolumeCache(u.Path)
+	})
+}
+
+// RegisterBackend makes a cache backend available to NewFromURL for URLs with the given scheme.
+// Registering a scheme twice replaces the previous factory.
+func RegisterBackend(scheme string, factory BackendFactory) {
+	backendsMu.Lock()
+	defer backendsMu.Unlock()
+	backends[strings.ToLower(scheme)] = factory
+}
+
+// NewFromURL creates a cache from a URL such as s3://bucket/prefix or file:///cache using the backend registered for its scheme.
+func NewFromURL(cacheURL string) (lifecycle.Cache, error) {
+	u, err := url.Parse(cacheURL)
+	if err != nil {
+		return nil, fmt.Errorf("parsing cache URL '%s': %s", cacheURL, err)
+	}
+	backendsMu.RLock()
+	factory, ok := backends[strings.ToLower(u.Scheme)]
+	backendsMu.RUnlock()
+	if !ok {
+		return nil, fmt.Errorf("unsupported cache URL scheme '%s', must be one of: %s", u.Scheme, strings.Join(registeredSchemes(), ", "))
+	}
+	return factory(u)
+}
+
+// FileURL returns the file:// URL of the volume cache in dir.
+func FileURL(dir string) (string, error) {
+	abs, err := filepath.Abs(dir)
+	if err != nil {
+		return "", err
+	}
+	return (&url.URL{Scheme: "file", Path: filepath.ToSlash(abs)}).String(), nil
+}
+
+// NewReadOnlyFromURL creates a cache from a URL like NewFromURL, for reading only. A file:// cache is opened with
+// NewReadOnlyVolumeCache so that the staging and backup directories of a build using the same cache are left alone.
+func NewReadOnlyFromURL(cacheURL string) (lifecycle.Cache, error) {
+	u, err := url.Parse(cacheURL)
+	if err != nil {
+		return nil, fmt.Errorf("parsing cache URL '%s': %s", cacheURL, err)
+	}
+	if strings.ToLower(u.Scheme) == "file" {
+		return NewReadOnlyVolumeCache(u.Path)
+	}
+	return NewFromURL(cacheURL)
+}
+
+func registeredSchemes() []string {
+	backendsMu.RLock()
+	defer backendsMu.RUnlock()
+	var schemes []string
+	for s := range backends {
+		schemes = append(schemes, s)
+	}
+	sort.Strings(schemes)
+	return schemes
+}
@@ -0,0 +1,167 @@
+package cache
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"sync"
+
+	"github.com/pkg/errors"
+
+	"github.com/buildpacks/lifecycle"
+)
+
+const (
+	blobMetadataKey  = "metadata.json"
+	blobLayersPrefix = "layers/"
+)
+
+// BlobCache is a cache stored in a BlobStore.
+// Layers are content addressed so they are written as they are added; Commit writes the metadata
+// and deletes the layers that were neither added nor reused.
+type BlobCache struct {
+	committed bool
+	store     BlobStore
+	metadata  *lifecycle.CacheMetadata
+	keep      map[string]struct{}
+	existing  map[string]struct{}
+	mu        sync.Mutex // mu guards keep and existing, layers may be added concurrently
+}
+
+func NewBlobCache(store BlobStore) *BlobCache {
+	return &BlobCache{
+		store: store,
+		keep:  map[string]struct{}{},
+	}
+}
+
+func (c *BlobCache) Exists() bool {
+	rc, err := c.store.Get(blobMetadataKey)
+	if err != nil {
+		return false
+	}
+	rc.Close()
+	return true
+}
+
+func (c *BlobCache) Name() string {
+	return c.store.Name()
+}
+
+func (c *BlobCache) SetMetadata(metadata lifecycle.CacheMetadata) error {
+	if c.committed {
+		return errCacheCommitted
+	}
+	c.metadata = &metadata
+	return nil
+}
+
+func (c *BlobCache) RetrieveMetadata() (lifecycle.CacheMetadata, error) {
+	rc, err := c.store.Get(blobMetadataKey)
+	if err != nil {
+		if err == ErrBlobNotFound {
+			return lifecycle.CacheMetadata{}, nil
+		}
+		return lifecycle.CacheMetadata{}, errors.Wrapf(err, "retrieving metadata from '%s'", c.Name())
+	}
+	defer rc.Close()
+
+	metadata := lifecycle.CacheMetadata{}
+	if json.NewDecoder(rc).Decode(&metadata) != nil {
+		return lifecycle.CacheMetadata{}, nil
+	}
+	return metadata, nil
+}
+
+// ConcurrentWrites returns true, layers are stored under their own keys.
+func (c *BlobCache) ConcurrentWrites() bool {
+	return true
+}
+
+func (c *BlobCache) AddLayerFile(tarPath string, diffID string) error {
+	if c.committed {
+		return errCacheCommitted
+	}
+	f, err := os.Open(tarPath)
+	if err != nil {
+		return errors.Wrapf(err, "opening layer file (%s)", diffID)
+	}
+	defer f.Close()
+	if err := c.store.Put(blobLayerKey(diffID), f); err != nil {
+		return errors.Wrapf(err, "caching layer (%s)", diffID)
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.keep[diffID] = struct{}{}
+	return nil
+}
+
+func (c *BlobCache) ReuseLayer(diffID string) error {
+	if c.committed {
+		return errCacheCommitted
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.existing == nil {
+		keys, err := c.store.List(blobLayersPrefix)
+		if err != nil {
+			return errors.Wrap(err, "listing cached layers")
+		}
+		c.existing = map[string]struct{}{}
+		for _, key := range keys {
+			c.existing[key] = struct{}{}
+		}
+	}
+	if _, ok := c.existing[blobLayerKey(diffID)]; !ok {
+		return fmt.Errorf("reusing layer (%s): layer not found in cache", diffID)
+	}
+	c.keep[diffID] = struct{}{}
+	return nil
+}
+
+func (c *BlobCache) RetrieveLayer(diffID string) (io.ReadCloser, error) {
+	rc, err := c.store.Get(blobLayerKey(diffID))
+	if err != nil {
+		return nil, errors.Wrapf(err, "layer with SHA '%s' not found", diffID)
+	}
+	return rc, nil
+}
+
+func (c *BlobCache) Commit() error {
+	if c.committed {
+		return errCacheCommitted
+	}
+	c.committed = true
+
+	if c.metadata != nil {
+		data, err := json.Marshal(c.metadata)
+		if err != nil {
+			return errors.Wrap(err, "marshalling metadata")
+		}
+		if err := c.store.Put(blobMetadataKey, bytes.NewReader(data)); err != nil {
+			return errors.Wrap(err, "writing metadata")
+		}
+	}
+
+	keys, err := c.store.List(blobLayersPrefix)
+	if err != nil {
+		return errors.Wrap(err, "listing cached layers")
+	}
+	for _, key := range keys {
+		diffID := strings.TrimSuffix(strings.TrimPrefix(key, blobLayersPrefix), ".tar")
+		if _, ok := c.keep[diffID]; ok {
+			continue
+		}
+		if err := c.store.Delete(key); err != nil {
+			return errors.Wrapf(err, "deleting stale layer (%s)", diffID)
+		}
+	}
+	return nil
+}
+
+func blobLayerKey(diffID string) string {
+	return blobLayersPrefix + diffID + ".tar"
+}
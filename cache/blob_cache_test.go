@@ -0,0 +1,437 @@
+package cache_test
+
+import (
+	"encoding/xml"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/sclevine/spec"
+	"github.com/sclevine/spec/report"
+
+	"github.com/buildpacks/lifecycle"
+	"github.com/buildpacks/lifecycle/cache"
+	h "github.com/buildpacks/lifecycle/testhelpers"
+)
+
+func TestBlobCache(t *testing.T) {
+	spec.Run(t, "BlobCache", testBlobCache, spec.Parallel(), spec.Report(report.Terminal{}))
+}
+
+func testBlobCache(t *testing.T, when spec.G, it spec.S) {
+	var (
+		tmpDir  string
+		server  *fakeS3
+		subject lifecycle.Cache
+	)
+
+	it.Before(func() {
+		var err error
+
+		tmpDir, err = ioutil.TempDir("", "lifecycle.cache.blob_cache")
+		h.AssertNil(t, err)
+
+		server = newFakeS3("some-bucket")
+		subject, err = cache.NewFromURL("s3://some-bucket/some/prefix?endpoint=" + server.URL)
+		h.AssertNil(t, err)
+	})
+
+	it.After(func() {
+		server.Close()
+		os.RemoveAll(tmpDir)
+	})
+
+	when("#NewFromURL", func() {
+		it("returns an error for an unsupported scheme", func() {
+			_, err := cache.NewFromURL("gopher://some-host/some-path")
+			h.AssertError(t, err, "unsupported cache URL scheme 'gopher', must be one of: file, s3")
+		})
+
+		it("returns an error when the bucket is missing", func() {
+			_, err := cache.NewFromURL("s3:///some-prefix")
+			h.AssertError(t, err, "missing bucket in cache URL")
+		})
+
+		it("supports registered backends", func() {
+			cache.RegisterBackend("test-scheme", func(u *url.URL) (lifecycle.Cache, error) {
+				return cache.NewBlobCache(&cache.S3Store{Endpoint: server.URL, Bucket: u.Host}), nil
+			})
+			c, err := cache.NewFromURL("test-scheme://some-bucket")
+			h.AssertNil(t, err)
+			h.AssertEq(t, c.Name(), "s3://some-bucket")
+		})
+	})
+
+	when("#Name", func() {
+		it("returns the bucket and prefix", func() {
+			h.AssertEq(t, subject.Name(), "s3://some-bucket/some/prefix")
+		})
+	})
+
+	when("#RetrieveMetadata", func() {
+		when("the cache is empty", func() {
+			it("returns empty metadata", func() {
+				h.AssertEq(t, subject.Exists(), false)
+				meta, err := subject.RetrieveMetadata()
+				h.AssertNil(t, err)
+				h.AssertEq(t, len(meta.Buildpacks), 0)
+			})
+		})
+
+		when("metadata has been committed", func() {
+			it("returns the metadata", func() {
+				h.AssertNil(t, subject.SetMetadata(lifecycle.CacheMetadata{
+					Buildpacks: []lifecycle.BuildpackLayersMetadata{{ID: "some.buildpack.id", Version: "1.2.3"}},
+				}))
+				h.AssertNil(t, subject.Commit())
+
+				h.AssertEq(t, subject.Exists(), true)
+				meta, err := subject.RetrieveMetadata()
+				h.AssertNil(t, err)
+				h.AssertEq(t, meta.Buildpacks[0].ID, "some.buildpack.id")
+				h.AssertContains(t, server.keys(), "some/prefix/metadata.json")
+			})
+		})
+	})
+
+	when("#AddLayerFile", func() {
+		it("stores the layer so that it can be retrieved", func() {
+			layerPath := filepath.Join(tmpDir, "some-layer.tar")
+			h.AssertNil(t, ioutil.WriteFile(layerPath, []byte("some data"), 0600))
+
+			h.AssertNil(t, subject.AddLayerFile(layerPath, "some_sha"))
+
+			rc, err := subject.RetrieveLayer("some_sha")
+			h.AssertNil(t, err)
+			defer rc.Close()
+			data, err := ioutil.ReadAll(rc)
+			h.AssertNil(t, err)
+			h.AssertEq(t, string(data), "some data")
+		})
+	})
+
+	when("#RetrieveLayer", func() {
+		it("returns an error when the layer does not exist", func() {
+			_, err := subject.RetrieveLayer("some_nonexistent_sha")
+			h.AssertError(t, err, "layer with SHA 'some_nonexistent_sha' not found")
+		})
+	})
+
+	when("#ReuseLayer", func() {
+		it("returns an error when the layer does not exist", func() {
+			err := subject.ReuseLayer("some_nonexistent_sha")
+			h.AssertError(t, err, "reusing layer (some_nonexistent_sha): layer not found in cache")
+		})
+	})
+
+	when("#Commit", func() {
+		it.Before(func() {
+			server.put("some/prefix/layers/reused_sha.tar", "reused data")
+			server.put("some/prefix/layers/stale_sha.tar", "stale data")
+			server.put("some/prefix/layers/other_stale_sha.tar", "stale data")
+			server.put("other/prefix/layers/unrelated_sha.tar", "unrelated data")
+		})
+
+		it("deletes layers that were neither added nor reused", func() {
+			layerPath := filepath.Join(tmpDir, "some-layer.tar")
+			h.AssertNil(t, ioutil.WriteFile(layerPath, []byte("some data"), 0600))
+
+			h.AssertNil(t, subject.AddLayerFile(layerPath, "new_sha"))
+			h.AssertNil(t, subject.ReuseLayer("reused_sha"))
+			h.AssertNil(t, subject.Commit())
+
+			h.AssertEq(t, server.keys(), []string{
+				"other/prefix/layers/unrelated_sha.tar",
+				"some/prefix/layers/new_sha.tar",
+				"some/prefix/layers/reused_sha.tar",
+			})
+		})
+
+		it("returns errors once committed", func() {
+			h.AssertNil(t, subject.Commit())
+
+			h.AssertError(t, subject.Commit(), "cache cannot be modified after commit")
+			h.AssertError(t, subject.SetMetadata(lifecycle.CacheMetadata{}), "cache cannot be modified after commit")
+			h.AssertError(t, subject.ReuseLayer("reused_sha"), "cache cannot be modified after commit")
+		})
+	})
+
+	when("the store has credentials", func() {
+		it("signs requests", func() {
+			store := &cache.S3Store{
+				Endpoint:    server.URL,
+				Region:      "some-region",
+				Bucket:      "some-bucket",
+				Credentials: cache.S3Credentials{AccessKeyID: "some-key-id", SecretAccessKey: "some-secret", SessionToken: "some-token"},
+			}
+			h.AssertNil(t, store.Put("some key+with/special chars", strings.NewReader("some data")))
+
+			auth := server.lastAuthorization()
+			if !strings.HasPrefix(auth, "AWS4-HMAC-SHA256 Credential=some-key-id/") || !strings.Contains(auth, "/some-region/s3/aws4_request") {
+				t.Fatalf("unexpected authorization header: %s", auth)
+			}
+			if !strings.Contains(auth, "SignedHeaders=host;x-amz-content-sha256;x-amz-date;x-amz-security-token") {
+				t.Fatalf("unexpected signed headers: %s", auth)
+			}
+			h.AssertContains(t, server.keys(), "some key+with/special chars")
+		})
+	})
+
+	when("an object is larger than a part", func() {
+		var store *cache.S3Store
+
+		it.Before(func() {
+			store = &cache.S3Store{Endpoint: server.URL, Bucket: "some-bucket", PartSize: 4}
+		})
+
+		it("uploads the object in parts", func() {
+			h.AssertNil(t, store.Put("some-key", strings.NewReader("some data")))
+
+			rc, err := store.Get("some-key")
+			h.AssertNil(t, err)
+			defer rc.Close()
+			data, err := ioutil.ReadAll(rc)
+			h.AssertNil(t, err)
+			h.AssertEq(t, string(data), "some data")
+			h.AssertEq(t, server.postCount(), 2)
+			h.AssertEq(t, server.pendingUploads(), 0)
+		})
+
+		it("does not upload an empty part when the object is a multiple of the part size", func() {
+			h.AssertNil(t, store.Put("some-key", strings.NewReader("somedata")))
+
+			rc, err := store.Get("some-key")
+			h.AssertNil(t, err)
+			defer rc.Close()
+			data, err := ioutil.ReadAll(rc)
+			h.AssertNil(t, err)
+			h.AssertEq(t, string(data), "somedata")
+			h.AssertEq(t, server.pendingUploads(), 0)
+		})
+
+		it("uploads an object smaller than a part with a single request", func() {
+			h.AssertNil(t, store.Put("some-key", strings.NewReader("som")))
+
+			h.AssertEq(t, server.postCount(), 0)
+			h.AssertContains(t, server.keys(), "some-key")
+		})
+
+		it("aborts the upload when a part fails", func() {
+			err := store.Put("some-key", strings.NewReader("somefail"))
+			h.AssertError(t, err, "unexpected status 500")
+
+			h.AssertEq(t, server.pendingUploads(), 0)
+			h.AssertEq(t, len(server.keys()), 0)
+		})
+	})
+
+	when("the bucket listing is paginated", func() {
+		it("lists every key", func() {
+			store := &cache.S3Store{Endpoint: server.URL, Bucket: "some-bucket"}
+			for i := 0; i < 5; i++ {
+				server.put(fmt.Sprintf("layers/sha_%d.tar", i), "some data")
+			}
+
+			keys, err := store.List("layers/")
+			h.AssertNil(t, err)
+			h.AssertEq(t, len(keys), 5)
+		})
+	})
+}
+
+// fakeS3 is a minimal in-memory stand-in for the S3 API with path-style addressing.
+type fakeS3 struct {
+	*httptest.Server
+	bucket string
+
+	mu      sync.Mutex
+	objects map[string][]byte
+	uploads map[string][][]byte // uploads are the parts of each multipart upload in progress
+	auth    string
+	posts   int
+}
+
+func newFakeS3(bucket string) *fakeS3 {
+	f := &fakeS3{bucket: bucket, objects: map[string][]byte{}, uploads: map[string][][]byte{}}
+	f.Server = httptest.NewServer(http.HandlerFunc(f.serveHTTP))
+	return f
+}
+
+func (f *fakeS3) put(key, data string) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.objects[key] = []byte(data)
+}
+
+func (f *fakeS3) keys() []string {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	var keys []string
+	for k := range f.objects {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+func (f *fakeS3) postCount() int {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.posts
+}
+
+func (f *fakeS3) pendingUploads() int {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return len(f.uploads)
+}
+
+func (f *fakeS3) lastAuthorization() string {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.auth
+}
+
+const fakeS3PageSize = 2
+
+func (f *fakeS3) serveHTTP(w http.ResponseWriter, r *http.Request) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.auth = r.Header.Get("Authorization")
+
+	path := strings.TrimPrefix(r.URL.Path, "/")
+	if path != f.bucket && !strings.HasPrefix(path, f.bucket+"/") {
+		http.Error(w, "NoSuchBucket", http.StatusNotFound)
+		return
+	}
+	key := strings.TrimPrefix(strings.TrimPrefix(path, f.bucket), "/")
+
+	query := r.URL.Query()
+	switch {
+	case key == "" && r.Method == http.MethodGet:
+		f.list(w, r)
+	case r.Method == http.MethodPost:
+		f.posts++
+		f.multipart(w, r, key)
+	case r.Method == http.MethodPut && query.Get("uploadId") != "":
+		parts, ok := f.uploads[query.Get("uploadId")]
+		if !ok {
+			http.Error(w, "NoSuchUpload", http.StatusNotFound)
+			return
+		}
+		data, err := ioutil.ReadAll(r.Body)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		if string(data) == "fail" {
+			http.Error(w, "InternalError", http.StatusInternalServerError)
+			return
+		}
+		f.uploads[query.Get("uploadId")] = append(parts, data)
+		w.Header().Set("ETag", fmt.Sprintf(`"etag-%s"`, query.Get("partNumber")))
+	case r.Method == http.MethodDelete && query.Get("uploadId") != "":
+		delete(f.uploads, query.Get("uploadId"))
+		w.WriteHeader(http.StatusNoContent)
+	case r.Method == http.MethodPut:
+		data, err := ioutil.ReadAll(r.Body)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		f.objects[key] = data
+	case r.Method == http.MethodGet:
+		data, ok := f.objects[key]
+		if !ok {
+			http.Error(w, "NoSuchKey", http.StatusNotFound)
+			return
+		}
+		w.Write(data)
+	case r.Method == http.MethodDelete:
+		delete(f.objects, key)
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		http.Error(w, "MethodNotAllowed", http.StatusMethodNotAllowed)
+	}
+}
+
+func (f *fakeS3) multipart(w http.ResponseWriter, r *http.Request, key string) {
+	query := r.URL.Query()
+	if _, ok := query["uploads"]; ok {
+		uploadID := strconv.Itoa(len(f.uploads) + 1)
+		f.uploads[uploadID] = nil
+		fmt.Fprintf(w, "<InitiateMultipartUploadResult><UploadId>%s</UploadId></InitiateMultipartUploadResult>", uploadID)
+		return
+	}
+	parts, ok := f.uploads[query.Get("uploadId")]
+	if !ok {
+		http.Error(w, "NoSuchUpload", http.StatusNotFound)
+		return
+	}
+	var completed struct {
+		Parts []struct {
+			PartNumber int    `xml:"PartNumber"`
+			ETag       string `xml:"ETag"`
+		} `xml:"Part"`
+	}
+	if err := xml.NewDecoder(r.Body).Decode(&completed); err != nil || len(completed.Parts) != len(parts) {
+		http.Error(w, "InvalidPart", http.StatusBadRequest)
+		return
+	}
+	var data []byte
+	for i, part := range completed.Parts {
+		if part.PartNumber != i+1 || part.ETag != fmt.Sprintf(`"etag-%d"`, i+1) {
+			http.Error(w, "InvalidPart", http.StatusBadRequest)
+			return
+		}
+		data = append(data, parts[i]...)
+	}
+	f.objects[key] = data
+	delete(f.uploads, query.Get("uploadId"))
+	fmt.Fprint(w, "<CompleteMultipartUploadResult></CompleteMultipartUploadResult>")
+}
+
+func (f *fakeS3) list(w http.ResponseWriter, r *http.Request) {
+	prefix := r.URL.Query().Get("prefix")
+	var keys []string
+	for k := range f.objects {
+		if strings.HasPrefix(k, prefix) {
+			keys = append(keys, k)
+		}
+	}
+	sort.Strings(keys)
+
+	start := 0
+	if token := r.URL.Query().Get("continuation-token"); token != "" {
+		start, _ = strconv.Atoi(token)
+	}
+	end := start + fakeS3PageSize
+	type content struct {
+		Key string `xml:"Key"`
+	}
+	result := struct {
+		XMLName               xml.Name  `xml:"ListBucketResult"`
+		Contents              []content `xml:"Contents"`
+		IsTruncated           bool      `xml:"IsTruncated"`
+		NextContinuationToken string    `xml:"NextContinuationToken,omitempty"`
+	}{}
+	if end < len(keys) {
+		result.IsTruncated = true
+		result.NextContinuationToken = strconv.Itoa(end)
+	} else {
+		end = len(keys)
+	}
+	for _, k := range keys[start:end] {
+		result.Contents = append(result.Contents, content{Key: k})
+	}
+	xml.NewEncoder(w).Encode(result)
+}
@@ -0,0 +1,23 @@
+package cache
+
+import (
+	"errors"
+	"io"
+)
+
+var ErrBlobNotFound = errors.New("blob not found")
+
+// BlobStore is a flat key-value store of blobs that a BlobCache can be backed by.
+// Stores must be safe for concurrent use, since layers may be written in parallel.
+type BlobStore interface {
+	// Name returns a human readable location of the store.
+	Name() string
+	// Put writes the contents of r to key, replacing any existing blob.
+	Put(key string, r io.Reader) error
+	// Get returns the contents of the blob at key, or ErrBlobNotFound.
+	Get(key string) (io.ReadCloser, error)
+	// List returns the keys of all blobs starting with prefix.
+	List(prefix string) ([]string, error)
+	// Delete removes the blob at key. Deleting a missing blob is not an error.
+	Delete(key string) error
+}
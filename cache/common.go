@@ -4,4 +4,7 @@ import (
 	"errors"
 )
 
-var errCacheCommitted = errors.New("cache cannot be modified after commit")
+var (
+	errCacheCommitted = errors.New("cache cannot be modified after commit")
+	errCacheReadOnly  = errors.New("cache is read-only")
+)
@@ -6,12 +6,9 @@ import (
 	"io"
 
 	"github.com/buildpacks/imgutil"
-	"github.com/buildpacks/imgutil/remote"
 	"github.com/pkg/errors"
 
 	"github.com/buildpacks/lifecycle"
-
-	"github.com/google/go-containerregistry/pkg/authn"
 )
 
 const MetadataLabel = "io.buildpacks.lifecycle.cache.metadata"
@@ -29,26 +26,6 @@ func NewImageCache(origImage imgutil.Image, newImage imgutil.Image) *ImageCache
 	}
 }
 
-func NewImageCacheFromName(name string, keychain authn.Keychain) (*ImageCache, error) {
-	origImage, err := remote.NewImage(
-		name,
-		keychain,
-		remote.FromBaseImage(name),
-	)
-	if err != nil {
-		return nil, fmt.Errorf("accessing cache image %q: %v", name, err)
-	}
-	emptyImage, err := remote.NewImage(
-		name,
-		keychain,
-		remote.WithPreviousImage(name),
-	)
-	if err != nil {
-		return nil, fmt.Errorf("creating new cache image %q: %v", name, err)
-	}
-	return NewImageCache(origImage, emptyImage), nil
-}
-
 func (c *ImageCache) Exists() bool {
 	return c.origImage.Found()
 }
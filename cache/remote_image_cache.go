@@ -0,0 +1,311 @@
+package cache
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"sync"
+
+	"github.com/buildpacks/imgutil"
+	"github.com/google/go-containerregistry/pkg/authn"
+	"github.com/google/go-containerregistry/pkg/name"
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+	"github.com/google/go-containerregistry/pkg/v1/empty"
+	"github.com/google/go-containerregistry/pkg/v1/mutate"
+	"github.com/google/go-containerregistry/pkg/v1/remote"
+	"github.com/google/go-containerregistry/pkg/v1/remote/transport"
+	"github.com/google/go-containerregistry/pkg/v1/tarball"
+	"github.com/pkg/errors"
+
+	"github.com/buildpacks/lifecycle"
+)
+
+// RemoteImageCache is a cache stored as an image in a registry.
+// Unlike ImageCache it pushes the image itself so that blobs already present in the cache repository are skipped,
+// blobs present in a mount source repository on the same registry are mounted instead of uploaded,
+// and the data transferred is reported by TransferStats.
+type RemoteImageCache struct {
+	committed bool
+	ref       name.Reference
+	options   []remote.Option
+	transport *statsTransport
+	mountFrom name.Reference
+	logger    lifecycle.Logger
+
+	origImage v1.Image // origImage is nil when the cache image does not exist
+	labels    map[string]string
+	layers    []v1.Layer
+}
+
+type RemoteImageCacheOption func(*RemoteImageCache) error
+
+// WithMountSource makes layers added to the cache mountable from the given image, e.g. the app image,
+// when it is in the same registry as the cache image.
+func WithMountSource(imageName string) RemoteImageCacheOption {
+	return func(c *RemoteImageCache) error {
+		if imageName == "" {
+			return nil
+		}
+		ref, err := name.ParseReference(imageName, name.WeakValidation)
+		if err != nil {
+			return errors.Wrapf(err, "parsing mount source '%s'", imageName)
+		}
+		c.mountFrom = ref
+		return nil
+	}
+}
+
+// WithLogger sets the logger used to report problems that do not fail the operation, e.g. cleaning up the previous cache image.
+func WithLogger(logger lifecycle.Logger) RemoteImageCacheOption {
+	return func(c *RemoteImageCache) error {
+		c.logger = logger
+		return nil
+	}
+}
+
+// WithRemoteTransport sets the transport used to reach the registry, http.DefaultTransport by default.
+func WithRemoteTransport(t http.RoundTripper) RemoteImageCacheOption {
+	return func(c *RemoteImageCache) error {
+		c.transport.base = t
+		return nil
+	}
+}
+
+func NewRemoteImageCache(imageName string, keychain authn.Keychain, opts ...RemoteImageCacheOption) (*RemoteImageCache, error) {
+	ref, err := name.ParseReference(imageName, name.WeakValidation)
+	if err != nil {
+		return nil, errors.Wrapf(err, "parsing cache image name '%s'", imageName)
+	}
+	c := &RemoteImageCache{
+		ref:       ref,
+		transport: &statsTransport{base: http.DefaultTransport},
+		labels:    map[string]string{},
+	}
+	for _, opt := range opts {
+		if err := opt(c); err != nil {
+			return nil, err
+		}
+	}
+	c.options = []remote.Option{remote.WithAuthFromKeychain(keychain), remote.WithTransport(c.transport)}
+
+	c.origImage, err = remote.Image(ref, c.options...)
+	if err != nil {
+		if transportErr, ok := err.(*transport.Error); ok {
+			switch transportErr.StatusCode {
+			case http.StatusNotFound, http.StatusUnauthorized:
+				c.origImage = nil
+				return c, nil
+			}
+		}
+		return nil, fmt.Errorf("accessing cache image %q: %v", imageName, err)
+	}
+	return c, nil
+}
+
+func (c *RemoteImageCache) Exists() bool {
+	return c.origImage != nil
+}
+
+func (c *RemoteImageCache) Name() string {
+	return c.ref.Name()
+}
+
+func (c *RemoteImageCache) SetMetadata(metadata lifecycle.CacheMetadata) error {
+	if c.committed {
+		return errCacheCommitted
+	}
+	data, err := json.Marshal(metadata)
+	if err != nil {
+		return errors.Wrap(err, "serializing metadata")
+	}
+	c.labels[MetadataLabel] = string(data)
+	return nil
+}
+
+func (c *RemoteImageCache) RetrieveMetadata() (lifecycle.CacheMetadata, error) {
+	if c.origImage == nil {
+		return lifecycle.CacheMetadata{}, nil
+	}
+	cfg, err := c.origImage.ConfigFile()
+	if err != nil {
+		return lifecycle.CacheMetadata{}, nil
+	}
+	var meta lifecycle.CacheMetadata
+	if err := json.Unmarshal([]byte(cfg.Config.Labels[MetadataLabel]), &meta); err != nil {
+		return lifecycle.CacheMetadata{}, nil
+	}
+	return meta, nil
+}
+
+func (c *RemoteImageCache) AddLayerFile(tarPath string, diffID string) error {
+	if c.committed {
+		return errCacheCommitted
+	}
+	layer, err := tarball.LayerFromFile(tarPath)
+	if err != nil {
+		return errors.Wrapf(err, "reading layer (%s)", diffID)
+	}
+	if c.mountFrom != nil && c.mountFrom.Context().RegistryStr() == c.ref.Context().RegistryStr() {
+		layer = &remote.MountableLayer{Layer: layer, Reference: c.mountFrom}
+	}
+	c.layers = append(c.layers, layer)
+	return nil
+}
+
+func (c *RemoteImageCache) ReuseLayer(diffID string) error {
+	if c.committed {
+		return errCacheCommitted
+	}
+	layer, err := c.origLayer(diffID)
+	if err != nil {
+		return errors.Wrapf(err, "reusing layer (%s)", diffID)
+	}
+	c.layers = append(c.layers, layer)
+	return nil
+}
+
+func (c *RemoteImageCache) RetrieveLayer(diffID string) (io.ReadCloser, error) {
+	layer, err := c.origLayer(diffID)
+	if err != nil {
+		return nil, errors.Wrapf(err, "layer with SHA '%s' not found", diffID)
+	}
+	return layer.Uncompressed()
+}
+
+func (c *RemoteImageCache) origLayer(diffID string) (v1.Layer, error) {
+	if c.origImage == nil {
+		return nil, errors.New("cache image does not exist")
+	}
+	hash, err := v1.NewHash(diffID)
+	if err != nil {
+		return nil, err
+	}
+	return c.origImage.LayerByDiffID(hash)
+}
+
+func (c *RemoteImageCache) Commit() error {
+	if c.committed {
+		return errCacheCommitted
+	}
+
+	image, err := mutate.AppendLayers(empty.Image, c.layers...)
+	if err != nil {
+		return errors.Wrap(err, "appending layers")
+	}
+	cfg, err := image.ConfigFile()
+	if err != nil {
+		return errors.Wrap(err, "getting image config")
+	}
+	cfg = cfg.DeepCopy()
+	cfg.OS = "linux"
+	cfg.Architecture = "amd64"
+	cfg.Config.Labels = c.labels
+	image, err = mutate.ConfigFile(image, cfg)
+	if err != nil {
+		return errors.Wrap(err, "setting image config")
+	}
+	image, err = mutate.CreatedAt(image, v1.Time{Time: imgutil.NormalizedDateTime})
+	if err != nil {
+		return errors.Wrap(err, "setting creation time")
+	}
+
+	if err := remote.Write(c.ref, image, c.options...); err != nil {
+		return errors.Wrapf(err, "saving image '%s'", c.ref.Name())
+	}
+	c.committed = true
+
+	if c.origImage != nil {
+		// Deleting the original image is for cleanup only and should not fail the commit.
+		if err := c.deleteOrigImage(image); err != nil && c.logger != nil {
+			c.logger.Warnf("Unable to delete previous cache image: %v", err)
+		}
+	}
+	c.origImage = image
+	return nil
+}
+
+func (c *RemoteImageCache) deleteOrigImage(newImage v1.Image) error {
+	origDigest, err := c.origImage.Digest()
+	if err != nil {
+		return errors.Wrap(err, "getting digest for original image")
+	}
+	newDigest, err := newImage.Digest()
+	if err != nil {
+		return errors.Wrap(err, "getting digest for new image")
+	}
+	if origDigest == newDigest {
+		return nil
+	}
+	return remote.Delete(c.ref.Context().Digest(origDigest.String()), c.options...)
+}
+
+func (c *RemoteImageCache) TransferStats() lifecycle.CacheTransferStats {
+	return c.transport.stats()
+}
+
+// statsTransport counts the blobs transferred by the registry client.
+// It recognizes the requests of the distribution API:
+// an existence check (HEAD) that finds the blob, a mount (POST with mount) that is accepted,
+// a completed upload (PUT with digest), and blob downloads (GET, including redirects to external storage).
+type statsTransport struct {
+	base http.RoundTripper
+
+	mu sync.Mutex
+	s  lifecycle.CacheTransferStats
+}
+
+func (t *statsTransport) stats() lifecycle.CacheTransferStats {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.s
+}
+
+func (t *statsTransport) add(f func(s *lifecycle.CacheTransferStats)) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	f(&t.s)
+}
+
+func (t *statsTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	isBlob := strings.Contains(req.URL.Path, "/blobs/")
+	isUpload := strings.Contains(req.URL.Path, "/blobs/uploads/")
+	redirected := req.Response != nil && strings.Contains(req.Response.Request.URL.Path, "/blobs/")
+
+	if req.Body != nil && isUpload && (req.Method == http.MethodPatch || req.Method == http.MethodPut) {
+		req.Body = &countingReadCloser{ReadCloser: req.Body, count: func(n int64) {
+			t.add(func(s *lifecycle.CacheTransferStats) { s.BytesUploaded += n })
+		}}
+	}
+
+	resp, err := t.base.RoundTrip(req)
+	if err != nil {
+		return resp, err
+	}
+
+	switch {
+	case req.Method == http.MethodHead && isBlob && resp.StatusCode == http.StatusOK:
+		t.add(func(s *lifecycle.CacheTransferStats) { s.BlobsSkipped++ })
+	case req.Method == http.MethodPost && isUpload && req.URL.Query().Get("mount") != "" && resp.StatusCode == http.StatusCreated:
+		t.add(func(s *lifecycle.CacheTransferStats) { s.BlobsMounted++ })
+	case req.Method == http.MethodPut && isUpload && req.URL.Query().Get("digest") != "" && resp.StatusCode == http.StatusCreated:
+		t.add(func(s *lifecycle.CacheTransferStats) { s.BlobsUploaded++ })
+	case req.Method == http.MethodGet && (isBlob || redirected) && resp.StatusCode == http.StatusOK:
+		resp.Body = &countingReadCloser{ReadCloser: resp.Body, count: func(n int64) {
+			t.add(func(s *lifecycle.CacheTransferStats) { s.BytesDownloaded += n })
+		}}
+	}
+	return resp, nil
+}
+
+type countingReadCloser struct {
+	io.ReadCloser
+	count func(n int64)
+}
+
+func (c *countingReadCloser) Read(p []byte) (int, error) {
+	n, err := c.ReadCloser.Read(p)
+	c.count(int64(n))
+	return n, err
+}
@@ -0,0 +1,191 @@
+package cache_test
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/apex/log"
+	"github.com/apex/log/handlers/memory"
+	"github.com/google/go-containerregistry/pkg/authn"
+	"github.com/google/go-containerregistry/pkg/registry"
+	"github.com/sclevine/spec"
+	"github.com/sclevine/spec/report"
+
+	"github.com/buildpacks/lifecycle"
+	"github.com/buildpacks/lifecycle/cache"
+	h "github.com/buildpacks/lifecycle/testhelpers"
+)
+
+func TestRemoteImageCache(t *testing.T) {
+	spec.Run(t, "RemoteImageCache", testRemoteImageCache, spec.Parallel(), spec.Report(report.Terminal{}))
+}
+
+func testRemoteImageCache(t *testing.T, when spec.G, it spec.S) {
+	var (
+		tmpDir    string
+		server    *httptest.Server
+		imageName string
+		subject   *cache.RemoteImageCache
+	)
+
+	writeLayer := func(contents string) (string, string) {
+		t.Helper()
+		path := filepath.Join(tmpDir, contents+".tar")
+		h.AssertNil(t, ioutil.WriteFile(path, []byte(contents), 0600))
+		sum := sha256.Sum256([]byte(contents))
+		return path, "sha256:" + hex.EncodeToString(sum[:])
+	}
+
+	it.Before(func() {
+		var err error
+
+		tmpDir, err = ioutil.TempDir("", "lifecycle.cache.remote_image_cache")
+		h.AssertNil(t, err)
+
+		server = httptest.NewServer(registry.New())
+		u, err := url.Parse(server.URL)
+		h.AssertNil(t, err)
+		imageName = fmt.Sprintf("%s/some/cache:latest", u.Host)
+
+		subject, err = cache.NewRemoteImageCache(imageName, authn.DefaultKeychain)
+		h.AssertNil(t, err)
+	})
+
+	it.After(func() {
+		server.Close()
+		os.RemoveAll(tmpDir)
+	})
+
+	when("the cache image does not exist", func() {
+		it("returns empty metadata", func() {
+			h.AssertEq(t, subject.Exists(), false)
+			meta, err := subject.RetrieveMetadata()
+			h.AssertNil(t, err)
+			h.AssertEq(t, len(meta.Buildpacks), 0)
+		})
+
+		it("returns an error when reusing a layer", func() {
+			h.AssertError(t, subject.ReuseLayer("sha256:"+fmt.Sprintf("%064d", 0)), "cache image does not exist")
+		})
+	})
+
+	when("#Commit", func() {
+		var layerPath, layerSHA string
+
+		it.Before(func() {
+			layerPath, layerSHA = writeLayer("some layer data")
+			h.AssertNil(t, subject.AddLayerFile(layerPath, layerSHA))
+			h.AssertNil(t, subject.SetMetadata(lifecycle.CacheMetadata{
+				Buildpacks: []lifecycle.BuildpackLayersMetadata{{ID: "some.buildpack.id"}},
+			}))
+			h.AssertNil(t, subject.Commit())
+		})
+
+		it("saves the metadata and layers", func() {
+			reopened, err := cache.NewRemoteImageCache(imageName, authn.DefaultKeychain)
+			h.AssertNil(t, err)
+			h.AssertEq(t, reopened.Exists(), true)
+
+			meta, err := reopened.RetrieveMetadata()
+			h.AssertNil(t, err)
+			h.AssertEq(t, meta.Buildpacks[0].ID, "some.buildpack.id")
+
+			rc, err := reopened.RetrieveLayer(layerSHA)
+			h.AssertNil(t, err)
+			defer rc.Close()
+			data, err := ioutil.ReadAll(rc)
+			h.AssertNil(t, err)
+			h.AssertEq(t, string(data), "some layer data")
+			h.AssertEq(t, reopened.TransferStats().BytesDownloaded > 0, true)
+		})
+
+		it("reports the uploaded blobs", func() {
+			stats := subject.TransferStats()
+			h.AssertEq(t, stats.BlobsUploaded, 2) // layer and config
+			h.AssertEq(t, stats.BlobsSkipped, 0)
+			h.AssertEq(t, stats.BytesUploaded > 0, true)
+		})
+
+		it("returns errors once committed", func() {
+			h.AssertError(t, subject.Commit(), "cache cannot be modified after commit")
+			h.AssertError(t, subject.AddLayerFile(layerPath, layerSHA), "cache cannot be modified after commit")
+		})
+
+		when("the next cache reuses a layer", func() {
+			it("skips the unchanged blob", func() {
+				next, err := cache.NewRemoteImageCache(imageName, authn.DefaultKeychain)
+				h.AssertNil(t, err)
+				otherPath, otherSHA := writeLayer("some other layer data")
+
+				h.AssertNil(t, next.ReuseLayer(layerSHA))
+				h.AssertNil(t, next.AddLayerFile(otherPath, otherSHA))
+				h.AssertNil(t, next.Commit())
+
+				stats := next.TransferStats()
+				h.AssertEq(t, stats.BlobsSkipped, 1)
+				h.AssertEq(t, stats.BlobsUploaded, 2) // new layer and config
+			})
+		})
+
+		when("the previous cache image cannot be deleted", func() {
+			it("logs a warning and commits", func() {
+				logHandler := memory.New()
+				next, err := cache.NewRemoteImageCache(
+					imageName,
+					authn.DefaultKeychain,
+					cache.WithLogger(&log.Logger{Handler: logHandler}),
+					cache.WithRemoteTransport(rejectDeletes{http.DefaultTransport}),
+				)
+				h.AssertNil(t, err)
+				otherPath, otherSHA := writeLayer("some other layer data")
+				h.AssertNil(t, next.AddLayerFile(otherPath, otherSHA))
+
+				h.AssertNil(t, next.Commit())
+
+				h.AssertEq(t, len(logHandler.Entries), 1)
+				if !strings.HasPrefix(logHandler.Entries[0].Message, "Unable to delete previous cache image:") {
+					t.Fatalf("unexpected log message: %s", logHandler.Entries[0].Message)
+				}
+			})
+		})
+
+		when("a layer is already in the registry", func() {
+			it("skips uploading it", func() {
+				other, err := cache.NewRemoteImageCache(
+					imageName+"-other",
+					authn.DefaultKeychain,
+					cache.WithMountSource(imageName),
+				)
+				h.AssertNil(t, err)
+				h.AssertNil(t, other.AddLayerFile(layerPath, layerSHA))
+				h.AssertNil(t, other.Commit())
+
+				stats := other.TransferStats()
+				// the in-memory registry shares blobs between repositories, so the existence check finds it
+				h.AssertEq(t, stats.BlobsSkipped+stats.BlobsMounted, 1)
+			})
+		})
+	})
+}
+
+// rejectDeletes fails every DELETE request sent to the registry.
+type rejectDeletes struct {
+	base http.RoundTripper
+}
+
+func (t rejectDeletes) RoundTrip(req *http.Request) (*http.Response, error) {
+	if req.Method == http.MethodDelete {
+		return nil, errors.New("deletes are not allowed")
+	}
+	return t.base.RoundTrip(req)
+}
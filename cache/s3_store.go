@@ -0,0 +1,476 @@
+package cache
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+const (
+	EnvAWSAccessKeyID     = "AWS_ACCESS_KEY_ID"
+	EnvAWSSecretAccessKey = "AWS_SECRET_ACCESS_KEY"
+	EnvAWSSessionToken    = "AWS_SESSION_TOKEN"
+	EnvAWSRegion          = "AWS_REGION"
+
+	defaultS3Region   = "us-east-1"
+	defaultS3PartSize = 64 << 20
+	unsignedPayload   = "UNSIGNED-PAYLOAD"
+)
+
+// defaultS3Client fails requests to a server that stops responding, without limiting the time taken to transfer a blob.
+var defaultS3Client = &http.Client{
+	Transport: &http.Transport{
+		Proxy: http.ProxyFromEnvironment,
+		DialContext: (&net.Dialer{
+			Timeout:   30 * time.Second,
+			KeepAlive: 30 * time.Second,
+		}).DialContext,
+		TLSHandshakeTimeout:   10 * time.Second,
+		ResponseHeaderTimeout: time.Minute,
+		ExpectContinueTimeout: time.Second,
+		IdleConnTimeout:       90 * time.Second,
+		MaxIdleConns:          100,
+	},
+}
+
+// S3Store is a BlobStore backed by a bucket of an S3 compatible API.
+// Objects are addressed path-style so that any endpoint, e.g. a local stand-in server, can be used.
+// Requests are signed with AWS Signature Version 4 when credentials are provided.
+type S3Store struct {
+	Endpoint    string // Endpoint is the base URL of the API, e.g. https://s3.us-east-1.amazonaws.com
+	Region      string
+	Bucket      string
+	Prefix      string // Prefix is prepended to every key
+	Credentials S3Credentials
+	Client      *http.Client // Client defaults to a client that times out when the server stops responding
+	PartSize    int64        // PartSize is the size of each part of a multipart upload, defaults to 64 MiB
+
+	now func() time.Time
+}
+
+type S3Credentials struct {
+	AccessKeyID     string
+	SecretAccessKey string
+	SessionToken    string
+}
+
+// NewS3StoreFromURL creates a store from a URL of the form s3://bucket/prefix?region=region&endpoint=url.
+// The region defaults to $AWS_REGION and credentials are read from the standard AWS environment variables.
+func NewS3StoreFromURL(u *url.URL) (*S3Store, error) {
+	if u.Host == "" {
+		return nil, fmt.Errorf("missing bucket in cache URL '%s'", u.String())
+	}
+	region := u.Query().Get("region")
+	if region == "" {
+		region = os.Getenv(EnvAWSRegion)
+	}
+	if region == "" {
+		region = defaultS3Region
+	}
+	endpoint := u.Query().Get("endpoint")
+	if endpoint == "" {
+		endpoint = fmt.Sprintf("https://s3.%s.amazonaws.com", region)
+	}
+	return &S3Store{
+		Endpoint: strings.TrimSuffix(endpoint, "/"),
+		Region:   region,
+		Bucket:   u.Host,
+		Prefix:   strings.Trim(u.Path, "/"),
+		Credentials: S3Credentials{
+			AccessKeyID:     os.Getenv(EnvAWSAccessKeyID),
+			SecretAccessKey: os.Getenv(EnvAWSSecretAccessKey),
+			SessionToken:    os.Getenv(EnvAWSSessionToken),
+		},
+	}, nil
+}
+
+func (s *S3Store) Name() string {
+	return "s3://" + strings.TrimSuffix(s.Bucket+"/"+s.Prefix, "/")
+}
+
+// Put uploads r with a single request when it is smaller than a part, and as a multipart upload otherwise.
+// At most one part is held in memory, and only as much of it as r provides.
+func (s *S3Store) Put(key string, r io.Reader) error {
+	var part bytes.Buffer
+	if _, err := io.Copy(&part, io.LimitReader(r, s.partSize())); err != nil {
+		return err
+	}
+	if int64(part.Len()) < s.partSize() {
+		return s.putObject(key, part.Bytes())
+	}
+
+	uploadID, err := s.createMultipartUpload(key)
+	if err != nil {
+		return err
+	}
+	if err := s.putParts(key, uploadID, r, &part); err != nil {
+		if abortErr := s.abortMultipartUpload(key, uploadID); abortErr != nil {
+			return errors.Wrapf(err, "abort multipart upload failed: %s", abortErr)
+		}
+		return err
+	}
+	return nil
+}
+
+func (s *S3Store) putObject(key string, data []byte) error {
+	req, err := s.newRequest(http.MethodPut, s.objectPath(key), nil, bytes.NewReader(data))
+	if err != nil {
+		return err
+	}
+	resp, err := s.do(req)
+	if err != nil {
+		return err
+	}
+	return resp.Body.Close()
+}
+
+// putParts uploads the full part followed by the rest of r, and completes the upload
+func (s *S3Store) putParts(key, uploadID string, r io.Reader, part *bytes.Buffer) error {
+	var completed completeMultipartUpload
+	for number := 1; ; number++ {
+		etag, err := s.uploadPart(key, uploadID, number, part.Bytes())
+		if err != nil {
+			return err
+		}
+		completed.Parts = append(completed.Parts, completedPart{PartNumber: number, ETag: etag})
+
+		part.Reset()
+		n, err := io.CopyN(part, r, s.partSize())
+		if err != nil && err != io.EOF {
+			return err
+		}
+		if n == 0 {
+			break
+		}
+	}
+	return s.completeMultipartUpload(key, uploadID, completed)
+}
+
+func (s *S3Store) createMultipartUpload(key string) (string, error) {
+	req, err := s.newRequest(http.MethodPost, s.objectPath(key), url.Values{"uploads": {""}}, nil)
+	if err != nil {
+		return "", err
+	}
+	resp, err := s.do(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+	var result struct {
+		UploadID string `xml:"UploadId"`
+	}
+	if err := xml.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return "", errors.Wrap(err, "decoding multipart upload")
+	}
+	return result.UploadID, nil
+}
+
+func (s *S3Store) uploadPart(key, uploadID string, number int, data []byte) (string, error) {
+	query := url.Values{"partNumber": {strconv.Itoa(number)}, "uploadId": {uploadID}}
+	req, err := s.newRequest(http.MethodPut, s.objectPath(key), query, bytes.NewReader(data))
+	if err != nil {
+		return "", err
+	}
+	resp, err := s.do(req)
+	if err != nil {
+		return "", err
+	}
+	etag := resp.Header.Get("ETag")
+	return etag, resp.Body.Close()
+}
+
+func (s *S3Store) completeMultipartUpload(key, uploadID string, completed completeMultipartUpload) error {
+	body, err := xml.Marshal(completed)
+	if err != nil {
+		return err
+	}
+	req, err := s.newRequest(http.MethodPost, s.objectPath(key), url.Values{"uploadId": {uploadID}}, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	resp, err := s.do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	// the upload can fail after the response status has been sent, in which case the body is an error document
+	var result struct {
+		XMLName xml.Name
+		Message string `xml:"Message"`
+	}
+	if err := xml.NewDecoder(resp.Body).Decode(&result); err != nil && err != io.EOF {
+		return errors.Wrap(err, "decoding completed multipart upload")
+	}
+	if result.XMLName.Local == "Error" {
+		return fmt.Errorf("%s %s: %s", req.Method, req.URL.Path, result.Message)
+	}
+	return nil
+}
+
+func (s *S3Store) abortMultipartUpload(key, uploadID string) error {
+	req, err := s.newRequest(http.MethodDelete, s.objectPath(key), url.Values{"uploadId": {uploadID}}, nil)
+	if err != nil {
+		return err
+	}
+	resp, err := s.do(req)
+	if err == ErrBlobNotFound {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	return resp.Body.Close()
+}
+
+func (s *S3Store) partSize() int64 {
+	if s.PartSize > 0 {
+		return s.PartSize
+	}
+	return defaultS3PartSize
+}
+
+func (s *S3Store) Get(key string) (io.ReadCloser, error) {
+	req, err := s.newRequest(http.MethodGet, s.objectPath(key), nil, nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := s.do(req)
+	if err != nil {
+		return nil, err
+	}
+	return resp.Body, nil
+}
+
+func (s *S3Store) List(prefix string) ([]string, error) {
+	var (
+		keys  []string
+		token string
+	)
+	fullPrefix := s.objectKey(prefix)
+	for {
+		query := url.Values{"list-type": {"2"}, "prefix": {fullPrefix}}
+		if token != "" {
+			query.Set("continuation-token", token)
+		}
+		req, err := s.newRequest(http.MethodGet, "/"+s.Bucket, query, nil)
+		if err != nil {
+			return nil, err
+		}
+		resp, err := s.do(req)
+		if err != nil {
+			return nil, err
+		}
+		var result listBucketResult
+		err = xml.NewDecoder(resp.Body).Decode(&result)
+		resp.Body.Close()
+		if err != nil {
+			return nil, errors.Wrap(err, "decoding bucket listing")
+		}
+		for _, c := range result.Contents {
+			keys = append(keys, strings.TrimPrefix(c.Key, s.objectKey("")))
+		}
+		if !result.IsTruncated || result.NextContinuationToken == "" {
+			return keys, nil
+		}
+		token = result.NextContinuationToken
+	}
+}
+
+func (s *S3Store) Delete(key string) error {
+	req, err := s.newRequest(http.MethodDelete, s.objectPath(key), nil, nil)
+	if err != nil {
+		return err
+	}
+	resp, err := s.do(req)
+	if err == ErrBlobNotFound {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	return resp.Body.Close()
+}
+
+type completeMultipartUpload struct {
+	XMLName xml.Name        `xml:"CompleteMultipartUpload"`
+	Parts   []completedPart `xml:"Part"`
+}
+
+type completedPart struct {
+	PartNumber int    `xml:"PartNumber"`
+	ETag       string `xml:"ETag"`
+}
+
+type listBucketResult struct {
+	Contents []struct {
+		Key string `xml:"Key"`
+	} `xml:"Contents"`
+	IsTruncated           bool   `xml:"IsTruncated"`
+	NextContinuationToken string `xml:"NextContinuationToken"`
+}
+
+func (s *S3Store) objectKey(key string) string {
+	if s.Prefix == "" {
+		return key
+	}
+	return s.Prefix + "/" + key
+}
+
+func (s *S3Store) objectPath(key string) string {
+	return "/" + s.Bucket + "/" + s.objectKey(key)
+}
+
+func (s *S3Store) newRequest(method, path string, query url.Values, body io.Reader) (*http.Request, error) {
+	u, err := url.Parse(s.Endpoint)
+	if err != nil {
+		return nil, errors.Wrapf(err, "parsing endpoint '%s'", s.Endpoint)
+	}
+	u.Path = strings.TrimSuffix(u.Path, "/") + path
+	u.RawPath = awsURIEncode(u.Path, false)
+	u.RawQuery = canonicalQuery(query)
+	req, err := http.NewRequest(method, u.String(), body)
+	if err != nil {
+		return nil, err
+	}
+	if s.Credentials.AccessKeyID != "" {
+		s.sign(req)
+	}
+	return req, nil
+}
+
+func (s *S3Store) do(req *http.Request) (*http.Response, error) {
+	client := s.Client
+	if client == nil {
+		client = defaultS3Client
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, errors.Wrapf(err, "%s %s", req.Method, req.URL.Path)
+	}
+	if resp.StatusCode == http.StatusNotFound {
+		resp.Body.Close()
+		return nil, ErrBlobNotFound
+	}
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		msg, _ := ioutil.ReadAll(io.LimitReader(resp.Body, 1024))
+		resp.Body.Close()
+		return nil, fmt.Errorf("%s %s: unexpected status %d: %s", req.Method, req.URL.Path, resp.StatusCode, strings.TrimSpace(string(msg)))
+	}
+	return resp, nil
+}
+
+// sign adds AWS Signature Version 4 headers to the request, see https://docs.aws.amazon.com/general/latest/gr/sigv4_signing.html
+// The payload is not included in the signature so that layer tarballs can be streamed.
+func (s *S3Store) sign(req *http.Request) {
+	now := time.Now
+	if s.now != nil {
+		now = s.now
+	}
+	t := now().UTC()
+	amzDate := t.Format("20060102T150405Z")
+	date := t.Format("20060102")
+
+	req.Header.Set("X-Amz-Date", amzDate)
+	req.Header.Set("X-Amz-Content-Sha256", unsignedPayload)
+	if s.Credentials.SessionToken != "" {
+		req.Header.Set("X-Amz-Security-Token", s.Credentials.SessionToken)
+	}
+
+	headers := map[string]string{"host": req.URL.Host}
+	for k := range req.Header {
+		lk := strings.ToLower(k)
+		if strings.HasPrefix(lk, "x-amz-") {
+			headers[lk] = strings.TrimSpace(req.Header.Get(k))
+		}
+	}
+	var names []string
+	for k := range headers {
+		names = append(names, k)
+	}
+	sort.Strings(names)
+	var canonicalHeaders strings.Builder
+	for _, k := range names {
+		canonicalHeaders.WriteString(k + ":" + headers[k] + "\n")
+	}
+	signedHeaders := strings.Join(names, ";")
+
+	canonicalRequest := strings.Join([]string{
+		req.Method,
+		req.URL.EscapedPath(),
+		req.URL.RawQuery,
+		canonicalHeaders.String(),
+		signedHeaders,
+		unsignedPayload,
+	}, "\n")
+	scope := strings.Join([]string{date, s.Region, "s3", "aws4_request"}, "/")
+	stringToSign := strings.Join([]string{"AWS4-HMAC-SHA256", amzDate, scope, hexSHA256([]byte(canonicalRequest))}, "\n")
+
+	key := hmacSHA256([]byte("AWS4"+s.Credentials.SecretAccessKey), date)
+	key = hmacSHA256(key, s.Region)
+	key = hmacSHA256(key, "s3")
+	key = hmacSHA256(key, "aws4_request")
+	signature := hex.EncodeToString(hmacSHA256(key, stringToSign))
+
+	req.Header.Set("Authorization", fmt.Sprintf(
+		"AWS4-HMAC-SHA256 Credential=%s/%s, SignedHeaders=%s, Signature=%s",
+		s.Credentials.AccessKeyID, scope, signedHeaders, signature,
+	))
+}
+
+func canonicalQuery(query url.Values) string {
+	var keys []string
+	for k := range query {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	var parts []string
+	for _, k := range keys {
+		for _, v := range query[k] {
+			parts = append(parts, awsURIEncode(k, true)+"="+awsURIEncode(v, true))
+		}
+	}
+	return strings.Join(parts, "&")
+}
+
+// awsURIEncode escapes every byte except unreserved characters, and '/' unless encodeSlash is set
+func awsURIEncode(s string, encodeSlash bool) string {
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		switch {
+		case 'A' <= c && c <= 'Z', 'a' <= c && c <= 'z', '0' <= c && c <= '9', c == '-', c == '_', c == '.', c == '~':
+			b.WriteByte(c)
+		case c == '/' && !encodeSlash:
+			b.WriteByte(c)
+		default:
+			fmt.Fprintf(&b, "%%%02X", c)
+		}
+	}
+	return b.String()
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	h := hmac.New(sha256.New, key)
+	h.Write([]byte(data))
+	return h.Sum(nil)
+}
+
+func hexSHA256(data []byte) string {
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
@@ -3,6 +3,7 @@ package cache
 import (
 	"encoding/json"
 	"io"
+	"io/ioutil"
 	"os"
 	"path/filepath"
 	"runtime"
@@ -15,6 +16,7 @@ import (
 
 type VolumeCache struct {
 	committed    bool
+	readOnly     bool
 	dir          string
 	backupDir    string
 	stagingDir   string
@@ -48,6 +50,23 @@ func NewVolumeCache(dir string) (*VolumeCache, error) {
 	return c, nil
 }
 
+// NewReadOnlyVolumeCache opens the committed cache in dir for reading. Unlike NewVolumeCache it leaves the staging
+// and backup directories alone, so it is safe to use while another process is writing to the cache.
+func NewReadOnlyVolumeCache(dir string) (*VolumeCache, error) {
+	c := &VolumeCache{
+		readOnly:     true,
+		dir:          dir,
+		committedDir: filepath.Join(dir, "committed"),
+	}
+	if _, err := os.Stat(c.committedDir); err != nil {
+		if os.IsNotExist(err) {
+			return nil, errors.Errorf("cache directory '%s' does not exist", dir)
+		}
+		return nil, errors.Wrapf(err, "reading cache directory '%s'", dir)
+	}
+	return c, nil
+}
+
 func (c *VolumeCache) Exists() bool {
 	if _, err := os.Stat(filepath.Join(c.committedDir)); err != nil {
 		return false
@@ -60,8 +79,8 @@ func (c *VolumeCache) Name() string {
 }
 
 func (c *VolumeCache) SetMetadata(metadata lifecycle.CacheMetadata) error {
-	if c.committed {
-		return errCacheCommitted
+	if err := c.checkWritable(); err != nil {
+		return err
 	}
 	metadataPath := filepath.Join(c.stagingDir, MetadataLabel)
 	file, err := os.Create(metadataPath)
@@ -95,9 +114,14 @@ func (c *VolumeCache) RetrieveMetadata() (lifecycle.CacheMetadata, error) {
 	return metadata, nil
 }
 
+// ConcurrentWrites returns true, each layer is written to its own file.
+func (c *VolumeCache) ConcurrentWrites() bool {
+	return true
+}
+
 func (c *VolumeCache) AddLayerFile(tarPath string, diffID string) error {
-	if c.committed {
-		return errCacheCommitted
+	if err := c.checkWritable(); err != nil {
+		return err
 	}
 	layerTar := diffIDPath(c.stagingDir, diffID)
 	if _, err := os.Stat(layerTar); err == nil {
@@ -112,8 +136,8 @@ func (c *VolumeCache) AddLayerFile(tarPath string, diffID string) error {
 }
 
 func (c *VolumeCache) AddLayer(rc io.ReadCloser, diffID string) error {
-	if c.committed {
-		return errCacheCommitted
+	if err := c.checkWritable(); err != nil {
+		return err
 	}
 
 	fh, err := os.Create(diffIDPath(c.stagingDir, diffID))
@@ -129,8 +153,8 @@ func (c *VolumeCache) AddLayer(rc io.ReadCloser, diffID string) error {
 }
 
 func (c *VolumeCache) ReuseLayer(diffID string) error {
-	if c.committed {
-		return errCacheCommitted
+	if err := c.checkWritable(); err != nil {
+		return err
 	}
 	if err := os.Link(diffIDPath(c.committedDir, diffID), diffIDPath(c.stagingDir, diffID)); err != nil && !os.IsExist(err) {
 		return errors.Wrapf(err, "reusing layer (%s)", diffID)
@@ -172,8 +196,8 @@ func (c *VolumeCache) RetrieveLayerFile(diffID string) (string, error) {
 }
 
 func (c *VolumeCache) Commit() error {
-	if c.committed {
-		return errCacheCommitted
+	if err := c.checkWritable(); err != nil {
+		return err
 	}
 	c.committed = true
 	if err := os.Rename(c.committedDir, c.backupDir); err != nil {
@@ -199,6 +223,16 @@ func diffIDPath(basePath, diffID string) string {
 	return filepath.Join(basePath, diffID+".tar")
 }
 
+func (c *VolumeCache) checkWritable() error {
+	if c.readOnly {
+		return errCacheReadOnly
+	}
+	if c.committed {
+		return errCacheCommitted
+	}
+	return nil
+}
+
 func (c *VolumeCache) setupStagingDir() error {
 	if err := os.RemoveAll(c.stagingDir); err != nil {
 		return err
@@ -213,13 +247,19 @@ func copyFile(from, to string) error {
 	}
 	defer in.Close()
 
-	out, err := os.Create(to)
+	// Write to a temporary file so that concurrent writers of the same layer never observe a partial copy.
+	out, err := ioutil.TempFile(filepath.Dir(to), filepath.Base(to)+".tmp")
 	if err != nil {
 		return err
 	}
-	defer out.Close()
+	defer os.Remove(out.Name())
 
-	_, err = io.Copy(out, in)
-
-	return err
+	if _, err := io.Copy(out, in); err != nil {
+		out.Close()
+		return err
+	}
+	if err := out.Close(); err != nil {
+		return err
+	}
+	return os.Rename(out.Name(), to)
 }
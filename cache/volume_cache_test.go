@@ -123,6 +123,38 @@ func testVolumeCache(t *testing.T, when spec.G, it spec.S) {
 		})
 	})
 
+	when("#NewReadOnlyVolumeCache", func() {
+		it.Before(func() {
+			h.AssertNil(t, os.MkdirAll(committedDir, 0777))
+			h.AssertNil(t, os.MkdirAll(stagingDir, 0777))
+			h.AssertNil(t, os.MkdirAll(backupDir, 0777))
+			h.AssertNil(t, ioutil.WriteFile(filepath.Join(stagingDir, "some-layer.tar"), []byte("some data"), 0666))
+			h.AssertNil(t, ioutil.WriteFile(filepath.Join(backupDir, "some-layer.tar"), []byte("some data"), 0666))
+		})
+
+		it("leaves the staging and backup dirs alone", func() {
+			_, err := cache.NewReadOnlyVolumeCache(volumeDir)
+			h.AssertNil(t, err)
+
+			h.AssertPathExists(t, filepath.Join(stagingDir, "some-layer.tar"))
+			h.AssertPathExists(t, filepath.Join(backupDir, "some-layer.tar"))
+		})
+
+		it("returns an error when the cache does not exist", func() {
+			_, err := cache.NewReadOnlyVolumeCache(filepath.Join(tmpDir, "does_not_exist"))
+			h.AssertError(t, err, "does_not_exist' does not exist")
+		})
+
+		it("cannot be modified", func() {
+			readOnly, err := cache.NewReadOnlyVolumeCache(volumeDir)
+			h.AssertNil(t, err)
+
+			h.AssertError(t, readOnly.SetMetadata(lifecycle.CacheMetadata{}), "cache is read-only")
+			h.AssertError(t, readOnly.ReuseLayer("some_sha"), "cache is read-only")
+			h.AssertError(t, readOnly.Commit(), "cache is read-only")
+		})
+	})
+
 	when("VolumeCache", func() {
 		it.Before(func() {
 			var err error
@@ -0,0 +1,101 @@
+package lifecycle
+
+import (
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/BurntSushi/toml"
+	"github.com/pkg/errors"
+)
+
+// CacheInvalidations lists cached layers that should be treated as cache misses.
+// Each entry is either a buildpack ID, invalidating all of the buildpack's layers, or a <buildpack ID>:<layer name> pair.
+type CacheInvalidations struct {
+	Invalidate []string `toml:"invalidate"`
+}
+
+// ReadCacheInvalidations reads the invalidations at path. A missing file invalidates nothing.
+func ReadCacheInvalidations(path string) (CacheInvalidations, error) {
+	var inv CacheInvalidations
+	if _, err := toml.DecodeFile(path, &inv); err != nil {
+		if os.IsNotExist(err) {
+			return CacheInvalidations{}, nil
+		}
+		return CacheInvalidations{}, err
+	}
+	return inv, inv.validate()
+}
+
+func (c CacheInvalidations) validate() error {
+	for _, entry := range c.Invalidate {
+		id, layer, hasLayer := splitInvalidation(entry)
+		if id == "" || (hasLayer && layer == "") {
+			return fmt.Errorf("invalid cache invalidation '%s', must be <buildpack ID> or <buildpack ID>:<layer name>", entry)
+		}
+	}
+	return nil
+}
+
+// Invalidated returns true if the cached layer of the buildpack should be treated as a cache miss.
+func (c CacheInvalidations) Invalidated(buildpackID, layerName string) bool {
+	for _, entry := range c.Invalidate {
+		id, layer, hasLayer := splitInvalidation(entry)
+		if id == buildpackID && (!hasLayer || layer == layerName) {
+			return true
+		}
+	}
+	return false
+}
+
+func splitInvalidation(entry string) (id, layer string, hasLayer bool) {
+	parts := strings.SplitN(entry, ":", 2)
+	if len(parts) == 1 {
+		return parts[0], "", false
+	}
+	return parts[0], parts[1], true
+}
+
+// PruneCache removes the invalidated layers from the cache and commits it.
+// Buildpacks left without any layers are removed from the cache metadata.
+func PruneCache(cache Cache, inv CacheInvalidations, logger Logger) error {
+	if err := inv.validate(); err != nil {
+		return err
+	}
+	origMeta, err := cache.RetrieveMetadata()
+	if err != nil {
+		return errors.Wrap(err, "retrieving cache metadata")
+	}
+
+	meta := CacheMetadata{}
+	for _, bp := range origMeta.Buildpacks {
+		bpMD := BuildpackLayersMetadata{
+			ID:      bp.ID,
+			Version: bp.Version,
+			Layers:  map[string]BuildpackLayerMetadata{},
+		}
+		for name, layer := range bp.Layers {
+			identifier := fmt.Sprintf("%s:%s", bp.ID, name)
+			if inv.Invalidated(bp.ID, name) {
+				logger.Infof("Pruning %q", identifier)
+				continue
+			}
+			if err := cache.ReuseLayer(layer.SHA); err != nil {
+				logger.Warnf("Failed to keep layer '%s': %s", identifier, err)
+				continue
+			}
+			bpMD.Layers[name] = layer
+		}
+		if len(bpMD.Layers) > 0 {
+			meta.Buildpacks = append(meta.Buildpacks, bpMD)
+		}
+	}
+
+	if err := cache.SetMetadata(meta); err != nil {
+		return errors.Wrap(err, "setting cache metadata")
+	}
+	if err := cache.Commit(); err != nil {
+		return errors.Wrap(err, "committing cache")
+	}
+	return nil
+}
@@ -0,0 +1,129 @@
+package lifecycle_test
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/apex/log"
+	"github.com/apex/log/handlers/memory"
+	"github.com/sclevine/spec"
+	"github.com/sclevine/spec/report"
+
+	"github.com/buildpacks/lifecycle"
+	"github.com/buildpacks/lifecycle/cache"
+	h "github.com/buildpacks/lifecycle/testhelpers"
+)
+
+func TestCacheInvalidations(t *testing.T) {
+	spec.Run(t, "CacheInvalidations", testCacheInvalidations, spec.Report(report.Terminal{}))
+}
+
+func testCacheInvalidations(t *testing.T, when spec.G, it spec.S) {
+	var tmpDir string
+
+	it.Before(func() {
+		var err error
+		tmpDir, err = ioutil.TempDir("", "lifecycle.cache-invalidations")
+		h.AssertNil(t, err)
+	})
+
+	it.After(func() {
+		h.AssertNil(t, os.RemoveAll(tmpDir))
+	})
+
+	when("#ReadCacheInvalidations", func() {
+		it("reads the invalidations", func() {
+			path := filepath.Join(tmpDir, "cache-invalidations.toml")
+			h.Mkfile(t, `invalidate = ["some.buildpack", "other.buildpack:some-layer"]`, path)
+
+			inv, err := lifecycle.ReadCacheInvalidations(path)
+			h.AssertNil(t, err)
+			h.AssertEq(t, inv.Invalidate, []string{"some.buildpack", "other.buildpack:some-layer"})
+		})
+
+		it("invalidates nothing when the file is missing", func() {
+			inv, err := lifecycle.ReadCacheInvalidations(filepath.Join(tmpDir, "missing.toml"))
+			h.AssertNil(t, err)
+			h.AssertEq(t, len(inv.Invalidate), 0)
+		})
+
+		it("fails on an invalid entry", func() {
+			path := filepath.Join(tmpDir, "cache-invalidations.toml")
+			h.Mkfile(t, `invalidate = ["some.buildpack:"]`, path)
+
+			_, err := lifecycle.ReadCacheInvalidations(path)
+			h.AssertError(t, err, "invalid cache invalidation 'some.buildpack:'")
+		})
+	})
+
+	when("#Invalidated", func() {
+		it("matches buildpack IDs and layers", func() {
+			inv := lifecycle.CacheInvalidations{Invalidate: []string{"some.buildpack", "other.buildpack:some-layer"}}
+
+			h.AssertEq(t, inv.Invalidated("some.buildpack", "any-layer"), true)
+			h.AssertEq(t, inv.Invalidated("other.buildpack", "some-layer"), true)
+			h.AssertEq(t, inv.Invalidated("other.buildpack", "other-layer"), false)
+			h.AssertEq(t, inv.Invalidated("third.buildpack", "some-layer"), false)
+		})
+	})
+
+	when("#PruneCache", func() {
+		var (
+			volumeCache *cache.VolumeCache
+			logHandler  *memory.Handler
+		)
+
+		it.Before(func() {
+			var err error
+			cacheDir := filepath.Join(tmpDir, "cache")
+			h.AssertNil(t, os.Mkdir(cacheDir, 0755))
+			volumeCache, err = cache.NewVolumeCache(cacheDir)
+			h.AssertNil(t, err)
+
+			for _, sha := range []string{"sha-a", "sha-b", "sha-c"} {
+				layerPath := filepath.Join(tmpDir, sha+".tar")
+				h.Mkfile(t, sha, layerPath)
+				h.AssertNil(t, volumeCache.AddLayerFile(layerPath, sha))
+			}
+			h.AssertNil(t, volumeCache.SetMetadata(lifecycle.CacheMetadata{
+				Buildpacks: []lifecycle.BuildpackLayersMetadata{
+					{ID: "some.buildpack", Version: "1.0", Layers: map[string]lifecycle.BuildpackLayerMetadata{
+						"layer-a": {LayerMetadata: lifecycle.LayerMetadata{SHA: "sha-a"}},
+						"layer-b": {LayerMetadata: lifecycle.LayerMetadata{SHA: "sha-b"}},
+					}},
+					{ID: "other.buildpack", Version: "2.0", Layers: map[string]lifecycle.BuildpackLayerMetadata{
+						"layer-c": {LayerMetadata: lifecycle.LayerMetadata{SHA: "sha-c"}},
+					}},
+				},
+			}))
+			h.AssertNil(t, volumeCache.Commit())
+
+			volumeCache, err = cache.NewVolumeCache(cacheDir)
+			h.AssertNil(t, err)
+			logHandler = memory.New()
+		})
+
+		it("removes invalidated layers and keeps the rest", func() {
+			inv := lifecycle.CacheInvalidations{Invalidate: []string{"some.buildpack:layer-a", "other.buildpack"}}
+			h.AssertNil(t, lifecycle.PruneCache(volumeCache, inv, &log.Logger{Handler: logHandler}))
+
+			meta, err := volumeCache.RetrieveMetadata()
+			h.AssertNil(t, err)
+			h.AssertEq(t, len(meta.Buildpacks), 1)
+			h.AssertEq(t, meta.Buildpacks[0].ID, "some.buildpack")
+			h.AssertEq(t, meta.Buildpacks[0].Layers["layer-b"].SHA, "sha-b")
+			_, ok := meta.Buildpacks[0].Layers["layer-a"]
+			h.AssertEq(t, ok, false)
+
+			_, err = volumeCache.RetrieveLayer("sha-a")
+			h.AssertNotNil(t, err)
+			_, err = volumeCache.RetrieveLayer("sha-c")
+			h.AssertNotNil(t, err)
+			rc, err := volumeCache.RetrieveLayer("sha-b")
+			h.AssertNil(t, err)
+			rc.Close()
+		})
+	})
+}
@@ -0,0 +1,119 @@
+package lifecycle
+
+import (
+	"os"
+	"sync"
+
+	"github.com/BurntSushi/toml"
+	"github.com/pkg/errors"
+)
+
+// CacheStatsReport holds the cache statistics recorded by each phase.
+type CacheStatsReport struct {
+	Analyzer *CacheStats `toml:"analyzer,omitempty"`
+	Restorer *CacheStats `toml:"restorer,omitempty"`
+	Exporter *CacheStats `toml:"exporter,omitempty"`
+}
+
+// CacheStats summarizes how well a phase was served by the cache.
+type CacheStats struct {
+	Hit           int                   `toml:"hit"`
+	Miss          int                   `toml:"miss"`
+	Stale         int                   `toml:"stale"`
+	BytesRestored int64                 `toml:"bytes-restored"`
+	BytesUploaded int64                 `toml:"bytes-uploaded"`
+	Buildpacks    []BuildpackCacheStats `toml:"buildpacks"`
+}
+
+// BuildpackCacheStats counts the cached layers of a buildpack.
+// A layer is a hit when the cached data is used, a miss when the cache has no data for it,
+// and stale when the cache has data that is out of date or was invalidated by the platform.
+type BuildpackCacheStats struct {
+	ID            string `toml:"id"`
+	Version       string `toml:"version"`
+	Hit           int    `toml:"hit"`
+	Miss          int    `toml:"miss"`
+	Stale         int    `toml:"stale"`
+	BytesRestored int64  `toml:"bytes-restored"`
+	BytesUploaded int64  `toml:"bytes-uploaded"`
+}
+
+// WriteCacheStats records the statistics of the phase in the report at path, keeping the statistics of other phases.
+func WriteCacheStats(path, phase string, stats CacheStats) error {
+	var report CacheStatsReport
+	if _, err := toml.DecodeFile(path, &report); err != nil && !os.IsNotExist(err) {
+		return errors.Wrapf(err, "reading cache stats '%s'", path)
+	}
+	switch phase {
+	case "analyzer":
+		report.Analyzer = &stats
+	case "restorer":
+		report.Restorer = &stats
+	case "exporter":
+		report.Exporter = &stats
+	default:
+		return errors.Errorf("unknown phase '%s'", phase)
+	}
+	return WriteTOML(path, &report)
+}
+
+// cacheStatsRecorder accumulates cache statistics per buildpack. It is safe for concurrent use.
+type cacheStatsRecorder struct {
+	mu         sync.Mutex
+	buildpacks []BuildpackCacheStats
+}
+
+func (r *cacheStatsRecorder) reset() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.buildpacks = nil
+}
+
+func (r *cacheStatsRecorder) record(bp GroupBuildpack, f func(s *BuildpackCacheStats)) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for i := range r.buildpacks {
+		if r.buildpacks[i].ID == bp.ID {
+			f(&r.buildpacks[i])
+			return
+		}
+	}
+	r.buildpacks = append(r.buildpacks, BuildpackCacheStats{ID: bp.ID, Version: bp.Version})
+	f(&r.buildpacks[len(r.buildpacks)-1])
+}
+
+func (r *cacheStatsRecorder) hit(bp GroupBuildpack) {
+	r.record(bp, func(s *BuildpackCacheStats) { s.Hit++ })
+}
+
+func (r *cacheStatsRecorder) miss(bp GroupBuildpack) {
+	r.record(bp, func(s *BuildpackCacheStats) { s.Miss++ })
+}
+
+func (r *cacheStatsRecorder) stale(bp GroupBuildpack) {
+	r.record(bp, func(s *BuildpackCacheStats) { s.Stale++ })
+}
+
+// stats returns the statistics of the given buildpacks, in order, with their totals.
+func (r *cacheStatsRecorder) stats(buildpacks []GroupBuildpack) CacheStats {
+	for _, bp := range buildpacks {
+		r.record(bp, func(s *BuildpackCacheStats) {})
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	stats := CacheStats{}
+	for _, bp := range buildpacks {
+		for _, s := range r.buildpacks {
+			if s.ID != bp.ID {
+				continue
+			}
+			stats.Hit += s.Hit
+			stats.Miss += s.Miss
+			stats.Stale += s.Stale
+			stats.BytesRestored += s.BytesRestored
+			stats.BytesUploaded += s.BytesUploaded
+			stats.Buildpacks = append(stats.Buildpacks, s)
+		}
+	}
+	return stats
+}
@@ -0,0 +1,60 @@
+package lifecycle_test
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/BurntSushi/toml"
+	"github.com/sclevine/spec"
+	"github.com/sclevine/spec/report"
+
+	"github.com/buildpacks/lifecycle"
+	h "github.com/buildpacks/lifecycle/testhelpers"
+)
+
+func TestCacheStats(t *testing.T) {
+	spec.Run(t, "CacheStats", testCacheStats, spec.Report(report.Terminal{}))
+}
+
+func testCacheStats(t *testing.T, when spec.G, it spec.S) {
+	var tmpDir string
+
+	it.Before(func() {
+		var err error
+		tmpDir, err = ioutil.TempDir("", "lifecycle.cache-stats")
+		h.AssertNil(t, err)
+	})
+
+	it.After(func() {
+		h.AssertNil(t, os.RemoveAll(tmpDir))
+	})
+
+	when("#WriteCacheStats", func() {
+		it("keeps the stats of other phases", func() {
+			path := filepath.Join(tmpDir, "cache-stats.toml")
+			h.AssertNil(t, lifecycle.WriteCacheStats(path, "restorer", lifecycle.CacheStats{
+				Hit:        1,
+				Buildpacks: []lifecycle.BuildpackCacheStats{{ID: "some.buildpack", Hit: 1, BytesRestored: 10}},
+			}))
+			h.AssertNil(t, lifecycle.WriteCacheStats(path, "exporter", lifecycle.CacheStats{
+				Stale:      1,
+				Buildpacks: []lifecycle.BuildpackCacheStats{{ID: "some.buildpack", Stale: 1, BytesUploaded: 20}},
+			}))
+
+			var report lifecycle.CacheStatsReport
+			_, err := toml.DecodeFile(path, &report)
+			h.AssertNil(t, err)
+			h.AssertNil(t, report.Analyzer)
+			h.AssertEq(t, report.Restorer.Buildpacks[0].BytesRestored, int64(10))
+			h.AssertEq(t, report.Exporter.Stale, 1)
+			h.AssertEq(t, report.Exporter.Buildpacks[0].BytesUploaded, int64(20))
+		})
+
+		it("fails for an unknown phase", func() {
+			err := lifecycle.WriteCacheStats(filepath.Join(tmpDir, "cache-stats.toml"), "builder", lifecycle.CacheStats{})
+			h.AssertError(t, err, "unknown phase 'builder'")
+		})
+	})
+}
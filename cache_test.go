@@ -8,6 +8,7 @@ import (
 	"os"
 	"path/filepath"
 	"strings"
+	"sync/atomic"
 	"testing"
 	"time"
 
@@ -111,6 +112,17 @@ func testCache(t *testing.T, when spec.G, it spec.S) {
 					})
 				})
 
+				it("records cache misses", func() {
+					h.AssertNil(t, exporter.Cache(layersDir, testCache))
+
+					stats := exporter.CacheStats()
+					h.AssertEq(t, stats.Miss, 3)
+					h.AssertEq(t, stats.Hit, 0)
+					h.AssertEq(t, stats.Buildpacks[1].ID, "other.buildpack.id")
+					h.AssertEq(t, stats.Buildpacks[1].Miss, 1)
+					h.AssertEq(t, stats.BytesUploaded > 0, true)
+				})
+
 				it("doesn't export uncached layers", func() {
 					err := exporter.Cache(layersDir, testCache)
 					h.AssertNil(t, err)
@@ -121,6 +133,22 @@ func testCache(t *testing.T, when spec.G, it spec.S) {
 				})
 			})
 
+			when("the cache does not allow concurrent writes", func() {
+				it("adds layers one at a time in buildpack order", func() {
+					exporter.CacheConcurrency = 4
+					sequential := &sequentialCache{Cache: testCache}
+
+					h.AssertNil(t, exporter.Cache(layersDir, sequential))
+
+					h.AssertEq(t, sequential.added, []string{
+						testLayerDigest("buildpack.id:cache-true-layer"),
+						testLayerDigest("buildpack.id:cache-true-no-sha-layer"),
+						testLayerDigest("other.buildpack.id:other-buildpack-layer"),
+					})
+					h.AssertEq(t, sequential.overlapped, false)
+				})
+			})
+
 			when("there are previously cached layers", func() {
 				var (
 					metadataTemplate string
@@ -178,6 +206,15 @@ func testCache(t *testing.T, when spec.G, it spec.S) {
 						h.AssertEq(t, previousLayers, reusedLayers)
 					})
 
+					it("records cache hits", func() {
+						h.AssertNil(t, exporter.Cache(layersDir, testCache))
+
+						stats := exporter.CacheStats()
+						h.AssertEq(t, stats.Hit, 1)
+						h.AssertEq(t, stats.Stale, 1)
+						h.AssertEq(t, stats.Miss, 1)
+					})
+
 					it("sets cache metadata", func() {
 						err := exporter.Cache(layersDir, testCache)
 						h.AssertNil(t, err)
@@ -250,6 +287,33 @@ func testCache(t *testing.T, when spec.G, it spec.S) {
 			})
 		})
 
+		when("a lazily restored layer was not restored", func() {
+			it.Before(func() {
+				layersDir = filepath.Join(tmpDir, "layers")
+				h.AssertNil(t, os.MkdirAll(filepath.Join(layersDir, "buildpack.id"), 0777))
+				h.Mkfile(t, "cache=true", filepath.Join(layersDir, "buildpack.id", "lazy-layer.toml"))
+				h.Mkfile(t, "lazy-layer-sha", filepath.Join(layersDir, "buildpack.id", "lazy-layer.sha"))
+				h.Mkfile(t, "sha = \"lazy-layer-sha\"\ncache = \"file:///cache\"", filepath.Join(layersDir, "buildpack.id", "lazy-layer.restore"))
+
+				h.Mkfile(t, "lazy layer data", filepath.Join(cacheDir, "committed", "lazy-layer-sha.tar"))
+				h.Mkfile(t, `{"buildpacks": [{"key": "buildpack.id", "layers": {"lazy-layer": {"cache": true, "sha": "lazy-layer-sha"}}}]}`,
+					filepath.Join(cacheDir, "committed", "io.buildpacks.lifecycle.cache.metadata"))
+				var err error
+				testCache, err = cache.NewVolumeCache(cacheDir)
+				h.AssertNil(t, err)
+			})
+
+			it("keeps the cached layer", func() {
+				h.AssertNil(t, exporter.Cache(layersDir, testCache))
+
+				metadata, err := testCache.RetrieveMetadata()
+				h.AssertNil(t, err)
+				h.AssertEq(t, metadata.Buildpacks[0].Layers["lazy-layer"].SHA, "lazy-layer-sha")
+				h.AssertPathExists(t, filepath.Join(cacheDir, "committed", "lazy-layer-sha.tar"))
+				h.AssertEq(t, exporter.CacheStats().Hit, 1)
+			})
+		})
+
 		when("there are invalid layers", func() {
 			it.Before(func() {
 				layerFactory.EXPECT().
@@ -282,6 +346,24 @@ func testCache(t *testing.T, when spec.G, it spec.S) {
 	})
 }
 
+// sequentialCache hides the ConcurrentWrites method of the wrapped cache and records the order layers are added in.
+type sequentialCache struct {
+	lifecycle.Cache
+	added      []string
+	writing    int32
+	overlapped bool
+}
+
+func (c *sequentialCache) AddLayerFile(tarPath string, sha string) error {
+	if atomic.AddInt32(&c.writing, 1) > 1 {
+		c.overlapped = true
+	}
+	defer atomic.AddInt32(&c.writing, -1)
+	time.Sleep(10 * time.Millisecond)
+	c.added = append(c.added, sha)
+	return c.Cache.AddLayerFile(tarPath, sha)
+}
+
 func assertCacheHasLayer(t *testing.T, cache lifecycle.Cache, id string) {
 	t.Helper()
 
@@ -22,6 +22,15 @@ type Command interface {
 }
 
 func Run(c Command, asSubcommand bool) {
+	if asSubcommand {
+		RunArgs(c, os.Args[2:])
+	} else {
+		RunArgs(c, os.Args[1:])
+	}
+}
+
+// RunArgs runs the command with the given arguments, for commands nested below a subcommand
+func RunArgs(c Command, args []string) {
 	var (
 		printVersion bool
 		logLevel     string
@@ -33,16 +42,9 @@ func Run(c Command, asSubcommand bool) {
 	FlagLogLevel(&logLevel)
 	FlagNoColor(&noColor)
 	c.DefineFlags()
-	if asSubcommand {
-		if err := flagSet.Parse(os.Args[2:]); err != nil {
-			//flagSet exits on error, we shouldn't get here
-			Exit(err)
-		}
-	} else {
-		if err := flagSet.Parse(os.Args[1:]); err != nil {
-			//flagSet exits on error, we shouldn't get here
-			Exit(err)
-		}
+	if err := flagSet.Parse(args); err != nil {
+		//flagSet exits on error, we shouldn't get here
+		Exit(err)
 	}
 	DisableColor(noColor)
 
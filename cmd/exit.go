@@ -34,6 +34,7 @@ const (
 	// build phase errors: 400-499
 	CodeFailedBuildWithErrors = 401 // CodeFailedBuildWithErrors indicates buildpack error during /bin/build
 	CodeBuildError            = 402 // CodeBuildError indicates generic build error
+	CodeBuildTimeout          = 403 // CodeBuildTimeout indicates that a buildpack exceeded its timeout during /bin/build
 
 	// export phase errors: 500-599
 	CodeExportError = 502 // CodeExportError indicates generic export error
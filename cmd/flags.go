@@ -3,9 +3,11 @@ package cmd
 import (
 	"flag"
 	"fmt"
+	"math"
 	"os"
 	"path/filepath"
 	"strconv"
+	"strings"
 
 	"github.com/buildpacks/lifecycle/api"
 )
@@ -24,13 +26,23 @@ var (
 	DefaultStackPath       = filepath.Join(rootDir, "cnb", "stack.toml")
 
 	DefaultAnalyzedFile        = "analyzed.toml"
+	DefaultCacheStatsFile      = "cache-stats.toml"
 	DefaultGroupFile           = "group.toml"
+	DefaultIgnoreFile          = ".cnbignore"
+	DefaultImageConfigFile     = "image-config.toml"
+	DefaultInvalidationsFile   = "cache-invalidations.toml"
+	DefaultLogsDirName         = "+logs" // '+' is not allowed in buildpack IDs, so it cannot collide with a buildpack's layers
 	DefaultPlanFile            = "plan.toml"
 	DefaultProjectMetadataFile = "project-metadata.toml"
+	DefaultProvenanceFile      = "provenance.json"
 	DefaultReportFile          = "report.toml"
 
 	PlaceholderAnalyzedPath        = filepath.Join("<layers>", DefaultAnalyzedFile)
+	PlaceholderCacheStatsPath      = filepath.Join("<layers>", DefaultCacheStatsFile)
 	PlaceholderGroupPath           = filepath.Join("<layers>", DefaultGroupFile)
+	PlaceholderImageConfigPath     = filepath.Join("<layers>", DefaultImageConfigFile)
+	PlaceholderInvalidationsPath   = filepath.Join("<layers>", DefaultInvalidationsFile)
+	PlaceholderLogsDir             = filepath.Join("<layers>", DefaultLogsDirName)
 	PlaceholderPlanPath            = filepath.Join("<layers>", DefaultPlanFile)
 	PlaceholderProjectMetadataPath = filepath.Join("<layers>", DefaultProjectMetadataFile)
 	PlaceholderReportPath          = filepath.Join("<layers>", DefaultReportFile)
@@ -39,32 +51,65 @@ var (
 const (
 	EnvAnalyzedPath        = "CNB_ANALYZED_PATH"
 	EnvAppDir              = "CNB_APP_DIR"
+	EnvBuildTimeout        = "CNB_BUILD_TIMEOUT"
 	EnvBuildpacksDir       = "CNB_BUILDPACKS_DIR"
+	EnvCache               = "CNB_CACHE"
+	EnvCacheArchiveFormat  = "CNB_CACHE_ARCHIVE_FORMAT"
+	EnvCacheConcurrency    = "CNB_CACHE_CONCURRENCY"
 	EnvCacheDir            = "CNB_CACHE_DIR"
 	EnvCacheImage          = "CNB_CACHE_IMAGE"
+	EnvCacheStatsPath      = "CNB_CACHE_STATS_PATH"
+	EnvCaptureOutput       = "CNB_CAPTURE_OUTPUT" // defaults to false
 	EnvDeprecationMode     = "CNB_DEPRECATION_MODE"
+	EnvDetectCache         = "CNB_DETECT_CACHE"               // defaults to false
+	EnvDetectCacheHash     = "CNB_DETECT_CACHE_HASH_CONTENTS" // defaults to false
+	EnvDetectConcurrency   = "CNB_DETECT_CONCURRENCY"
+	EnvDetectTimeout       = "CNB_DETECT_TIMEOUT"
 	EnvGID                 = "CNB_GROUP_ID"
 	EnvGroupPath           = "CNB_GROUP_PATH"
+	EnvHideIgnored         = "CNB_HIDE_IGNORED" // defaults to false
+	EnvIgnorePath          = "CNB_IGNORE_PATH"
+	EnvImageConfigPath     = "CNB_IMAGE_CONFIG_PATH"
+	EnvInvalidationsPath   = "CNB_CACHE_INVALIDATIONS_PATH"
 	EnvLaunchCacheDir      = "CNB_LAUNCH_CACHE_DIR"
+	EnvLazyRestore         = "CNB_LAZY_RESTORE" // defaults to false
 	EnvLayersDir           = "CNB_LAYERS_DIR"
 	EnvLogLevel            = "CNB_LOG_LEVEL"
+	EnvMaxImageSize        = "CNB_MAX_IMAGE_SIZE"
+	EnvMaxLayerSize        = "CNB_MAX_LAYER_SIZE"
+	EnvMaxMemory           = "CNB_BUILDPACK_MAX_MEMORY"
+	EnvMaxNewLayersSize    = "CNB_MAX_NEW_LAYERS_SIZE"
+	EnvMaxOpenFiles        = "CNB_BUILDPACK_MAX_OPEN_FILES"
 	EnvNoColor             = "CNB_NO_COLOR" // defaults to false
+	EnvOrderOverridesPath  = "CNB_ORDER_OVERRIDES_PATH"
 	EnvOrderPath           = "CNB_ORDER_PATH"
+	EnvPinRunImage         = "CNB_PIN_RUN_IMAGE" // defaults to false
 	EnvPlanPath            = "CNB_PLAN_PATH"
 	EnvPlatformAPI         = "CNB_PLATFORM_API"
 	EnvPlatformDir         = "CNB_PLATFORM_DIR"
+	EnvPrefixOutput        = "CNB_PREFIX_OUTPUT" // defaults to false
 	EnvPreviousImage       = "CNB_PREVIOUS_IMAGE"
 	EnvProcessType         = "CNB_PROCESS_TYPE"
 	EnvProjectMetadataPath = "CNB_PROJECT_METADATA_PATH"
+	EnvProvenance          = "CNB_PROVENANCE" // defaults to false
+	EnvProvenanceKeyPath   = "CNB_PROVENANCE_KEY_PATH"
 	EnvReportPath          = "CNB_REPORT_PATH"
+	EnvResumeFrom          = "CNB_RESUME_FROM"
 	EnvRunImage            = "CNB_RUN_IMAGE"
+	EnvRunImagePolicyPath  = "CNB_RUN_IMAGE_POLICY_PATH"
 	EnvSkipLayers          = "CNB_ANALYZE_SKIP_LAYERS" // defaults to false
+	EnvSizeBudgetWarn      = "CNB_SIZE_BUDGET_WARN"    // defaults to false
 	EnvSkipRestore         = "CNB_SKIP_RESTORE"        // defaults to false
 	EnvStackPath           = "CNB_STACK_PATH"
 	EnvUID                 = "CNB_USER_ID"
 	EnvUseDaemon           = "CNB_USE_DAEMON" // defaults to false
 )
 
+const (
+	CacheArchiveFormatTar = "tar"
+	CacheArchiveFormatOCI = "oci"
+)
+
 var flagSet = flag.NewFlagSet("lifecycle", flag.ExitOnError)
 
 func FlagAnalyzedPath(analyzedPath *string) {
@@ -79,10 +124,26 @@ func FlagAppDir(appDir *string) {
 	flagSet.StringVar(appDir, "app", EnvOrDefault(EnvAppDir, DefaultAppDir), "path to app directory")
 }
 
+func FlagBuildTimeout(timeout *string) {
+	flagSet.StringVar(timeout, "build-timeout", os.Getenv(EnvBuildTimeout), "maximum duration of each buildpack's build, e.g. 10m")
+}
+
 func FlagBuildpacksDir(buildpacksDir *string) {
 	flagSet.StringVar(buildpacksDir, "buildpacks", EnvOrDefault(EnvBuildpacksDir, DefaultBuildpacksDir), "path to buildpacks directory")
 }
 
+func FlagCache(cacheURL *string) {
+	flagSet.StringVar(cacheURL, "cache", os.Getenv(EnvCache), "cache backend URL, e.g. s3://bucket/prefix")
+}
+
+func FlagCacheArchiveFormat(format *string) {
+	flagSet.StringVar(format, "format", EnvOrDefault(EnvCacheArchiveFormat, CacheArchiveFormatTar), "cache archive format, either 'tar' or 'oci'")
+}
+
+func FlagCacheConcurrency(concurrency *int) {
+	flagSet.IntVar(concurrency, "cache-concurrency", intEnv(EnvCacheConcurrency), "maximum number of cache layers created at once, defaults to the number of CPUs when 0")
+}
+
 func FlagCacheDir(cacheDir *string) {
 	flagSet.StringVar(cacheDir, "cache-dir", os.Getenv(EnvCacheDir), "path to cache directory")
 }
@@ -91,6 +152,34 @@ func FlagCacheImage(cacheImage *string) {
 	flagSet.StringVar(cacheImage, "cache-image", os.Getenv(EnvCacheImage), "cache image tag name")
 }
 
+func FlagCacheStatsPath(cacheStatsPath *string) {
+	flagSet.StringVar(cacheStatsPath, "cache-stats", EnvOrDefault(EnvCacheStatsPath, PlaceholderCacheStatsPath), "path to cache-stats.toml")
+}
+
+func DefaultCacheStatsPath(platformAPI, layersDir string) string {
+	return defaultPath(DefaultCacheStatsFile, platformAPI, layersDir)
+}
+
+func FlagCaptureOutput(capture *bool) {
+	flagSet.BoolVar(capture, "capture-output", BoolEnv(EnvCaptureOutput), "save the build output of each buildpack under "+PlaceholderLogsDir)
+}
+
+func FlagDetectCache(detectCache *bool) {
+	flagSet.BoolVar(detectCache, "detect-cache", BoolEnv(EnvDetectCache), "reuse detect results stored in the cache directory")
+}
+
+func FlagDetectCacheHash(hash *bool) {
+	flagSet.BoolVar(hash, "detect-cache-hash-contents", BoolEnv(EnvDetectCacheHash), "fingerprint app files by their contents rather than their size and modification time when reusing detect results")
+}
+
+func FlagDetectConcurrency(concurrency *int) {
+	flagSet.IntVar(concurrency, "detect-concurrency", intEnv(EnvDetectConcurrency), "maximum number of concurrent buildpack detect processes, unlimited when 0")
+}
+
+func FlagDetectTimeout(timeout *string) {
+	flagSet.StringVar(timeout, "detect-timeout", os.Getenv(EnvDetectTimeout), "maximum duration of each buildpack's detect, e.g. 30s")
+}
+
 func FlagGID(gid *int) {
 	flagSet.IntVar(gid, "gid", intEnv(EnvGID), "GID of user's group in the stack's build and run images")
 }
@@ -103,6 +192,30 @@ func DefaultGroupPath(platformAPI, layersDir string) string {
 	return defaultPath(DefaultGroupFile, platformAPI, layersDir)
 }
 
+func FlagHideIgnored(hide *bool) {
+	flagSet.BoolVar(hide, "hide-ignored", BoolEnv(EnvHideIgnored), "run buildpacks against a copy of the app directory without the files matching the ignore file")
+}
+
+func FlagIgnorePath(ignorePath *string) {
+	flagSet.StringVar(ignorePath, "ignore-file", os.Getenv(EnvIgnorePath), "path to a file of app paths to leave out of the image, in .gitignore format (default <app>/"+DefaultIgnoreFile+")")
+}
+
+func FlagImageConfigPath(imageConfigPath *string) {
+	flagSet.StringVar(imageConfigPath, "image-config", EnvOrDefault(EnvImageConfigPath, PlaceholderImageConfigPath), "path to image-config.toml")
+}
+
+func DefaultImageConfigPath(platformAPI, layersDir string) string {
+	return defaultPath(DefaultImageConfigFile, platformAPI, layersDir)
+}
+
+func FlagInvalidationsPath(invalidationsPath *string) {
+	flagSet.StringVar(invalidationsPath, "cache-invalidations", EnvOrDefault(EnvInvalidationsPath, PlaceholderInvalidationsPath), "path to cache-invalidations.toml")
+}
+
+func DefaultInvalidationsPath(platformAPI, layersDir string) string {
+	return defaultPath(DefaultInvalidationsFile, platformAPI, layersDir)
+}
+
 func FlagLaunchCacheDir(launchCacheDir *string) {
 	flagSet.StringVar(launchCacheDir, "launch-cache", os.Getenv(EnvLaunchCacheDir), "path to launch cache directory")
 }
@@ -115,14 +228,46 @@ func FlagLayersDir(layersDir *string) {
 	flagSet.StringVar(layersDir, "layers", EnvOrDefault(EnvLayersDir, DefaultLayersDir), "path to layers directory")
 }
 
+func FlagLazyRestore(lazy *bool) {
+	flagSet.BoolVar(lazy, "lazy-restore", BoolEnv(EnvLazyRestore), "write restore markers instead of restoring cached layer data")
+}
+
+func FlagMaxImageSize(maxImageSize *string) {
+	flagSet.StringVar(maxImageSize, "max-image-size", os.Getenv(EnvMaxImageSize), "maximum size of the exported image, including run image and reused layers, e.g. 4G")
+}
+
+func FlagMaxLayerSize(maxLayerSize *string) {
+	flagSet.StringVar(maxLayerSize, "max-layer-size", os.Getenv(EnvMaxLayerSize), "maximum size of a single exported buildpack layer, e.g. 500M")
+}
+
+func FlagMaxMemory(maxMemory *string) {
+	flagSet.StringVar(maxMemory, "buildpack-max-memory", os.Getenv(EnvMaxMemory), "maximum memory of each buildpack process, e.g. 2G (linux only)")
+}
+
+func FlagMaxNewLayersSize(maxNewLayersSize *string) {
+	flagSet.StringVar(maxNewLayersSize, "max-new-layers-size", os.Getenv(EnvMaxNewLayersSize), "maximum combined size of the layers written by the exporter, not counting run image or reused layers, e.g. 2G")
+}
+
+func FlagMaxOpenFiles(maxOpenFiles *int) {
+	flagSet.IntVar(maxOpenFiles, "buildpack-max-open-files", intEnv(EnvMaxOpenFiles), "maximum open files of each buildpack process (linux only)")
+}
+
 func FlagNoColor(skip *bool) {
 	flagSet.BoolVar(skip, "no-color", BoolEnv(EnvNoColor), "disable color output")
 }
 
+func FlagOrderOverridesPath(orderOverridesPath *string) {
+	flagSet.StringVar(orderOverridesPath, "order-overrides", os.Getenv(EnvOrderOverridesPath), "path to file of buildpacks to include, exclude or pin in the order")
+}
+
 func FlagOrderPath(orderPath *string) {
 	flagSet.StringVar(orderPath, "order", EnvOrDefault(EnvOrderPath, DefaultOrderPath), "path to order.toml")
 }
 
+func FlagPinRunImage(pin *bool) {
+	flagSet.BoolVar(pin, "pin-run-image", BoolEnv(EnvPinRunImage), "use the run image of the previous image")
+}
+
 func FlagPlanPath(planPath *string) {
 	flagSet.StringVar(planPath, "plan", EnvOrDefault(EnvPlanPath, PlaceholderPlanPath), "path to plan.toml")
 }
@@ -135,8 +280,20 @@ func FlagPlatformDir(platformDir *string) {
 	flagSet.StringVar(platformDir, "platform", EnvOrDefault(EnvPlatformDir, DefaultPlatformDir), "path to platform directory")
 }
 
+func FlagPrefixOutput(prefix *bool) {
+	flagSet.BoolVar(prefix, "prefix-output", BoolEnv(EnvPrefixOutput), "prefix each line of build output with the buildpack ID and a timestamp")
+}
+
 func FlagPreviousImage(image *string) {
-	flagSet.StringVar(image, "previous-image", os.Getenv(EnvPreviousImage), "reference to previous image")
+	flagSet.StringVar(image, "previous-image", os.Getenv(EnvPreviousImage), "reference to previous image, or an image archive prefixed with oci: or docker-archive:")
+}
+
+func FlagProvenance(provenance *bool) {
+	flagSet.BoolVar(provenance, "provenance", BoolEnv(EnvProvenance), "write an in-toto provenance statement next to report.toml")
+}
+
+func FlagProvenanceKeyPath(provenanceKeyPath *string) {
+	flagSet.StringVar(provenanceKeyPath, "provenance-key", os.Getenv(EnvProvenanceKeyPath), "path to PEM encoded private key used to sign the provenance statement")
 }
 
 func FlagReportPath(reportPath *string) {
@@ -147,10 +304,22 @@ func DefaultReportPath(platformAPI, layersDir string) string {
 	return defaultPath(DefaultReportFile, platformAPI, layersDir)
 }
 
+func FlagResumeFrom(resumeFrom *string) {
+	flagSet.StringVar(resumeFrom, "resume-from", os.Getenv(EnvResumeFrom), "ID of the buildpack to resume a failed build from")
+}
+
 func FlagRunImage(runImage *string) {
 	flagSet.StringVar(runImage, "run-image", os.Getenv(EnvRunImage), "reference to run image")
 }
 
+func FlagRunImagePolicyPath(runImagePolicyPath *string) {
+	flagSet.StringVar(runImagePolicyPath, "run-image-policy", os.Getenv(EnvRunImagePolicyPath), "path to run image policy file")
+}
+
+func FlagSizeBudgetWarn(warn *bool) {
+	flagSet.BoolVar(warn, "size-budget-warn", BoolEnv(EnvSizeBudgetWarn), "warn instead of failing when the size budget is exceeded")
+}
+
 func FlagSkipLayers(skip *bool) {
 	flagSet.BoolVar(skip, "skip-layers", BoolEnv(EnvSkipLayers), "do not provide layer metadata to buildpacks")
 }
@@ -219,6 +388,30 @@ func intEnv(k string) int {
 	return d
 }
 
+// ParseSize parses a size in bytes with an optional K, M or G (power of 1024) suffix. The empty string is 0.
+func ParseSize(size string) (int64, error) {
+	if size == "" {
+		return 0, nil
+	}
+	number, multiplier := size, int64(1)
+	switch strings.ToUpper(size[len(size)-1:]) {
+	case "K":
+		multiplier = 1 << 10
+	case "M":
+		multiplier = 1 << 20
+	case "G":
+		multiplier = 1 << 30
+	}
+	if multiplier != 1 {
+		number = size[:len(size)-1]
+	}
+	n, err := strconv.ParseInt(number, 10, 64)
+	if err != nil || n < 0 || n > math.MaxInt64/multiplier {
+		return 0, fmt.Errorf("invalid size '%s'", size)
+	}
+	return n * multiplier, nil
+}
+
 func BoolEnv(k string) bool {
 	v := os.Getenv(k)
 	b, err := strconv.ParseBool(v)
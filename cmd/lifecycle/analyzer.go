@@ -3,6 +3,7 @@ package main
 import (
 	"fmt"
 
+	"github.com/BurntSushi/toml"
 	"github.com/buildpacks/imgutil"
 	"github.com/buildpacks/imgutil/local"
 	"github.com/buildpacks/imgutil/remote"
@@ -13,15 +14,20 @@ import (
 	"github.com/buildpacks/lifecycle"
 	"github.com/buildpacks/lifecycle/auth"
 	"github.com/buildpacks/lifecycle/cmd"
+	"github.com/buildpacks/lifecycle/image"
 	"github.com/buildpacks/lifecycle/priv"
 )
 
 type analyzeCmd struct {
 	//flags: inputs
-	cacheDir      string
-	cacheImageTag string
-	groupPath     string
-	uid, gid      int
+	cacheURL           string
+	cacheDir           string
+	cacheImageTag      string
+	groupPath          string
+	invalidationsPath  string
+	runImagePolicyPath string
+	stackPath          string
+	uid, gid           int
 	analyzeArgs
 
 	//flags: paths to write data
@@ -30,11 +36,14 @@ type analyzeCmd struct {
 
 type analyzeArgs struct {
 	//inputs needed when run by creator
-	imageName   string
-	layersDir   string
-	platformAPI string
-	skipLayers  bool
-	useDaemon   bool
+	cacheInvalidations lifecycle.CacheInvalidations
+	cacheStatsPath     string
+	imageName          string
+	layersDir          string
+	platformAPI        string
+	runImageRef        string
+	skipLayers         bool
+	useDaemon          bool
 
 	//construct if necessary before dropping privileges
 	docker   client.CommonAPIClient
@@ -43,11 +52,17 @@ type analyzeArgs struct {
 
 func (a *analyzeCmd) DefineFlags() {
 	cmd.FlagAnalyzedPath(&a.analyzedPath)
+	cmd.FlagCache(&a.cacheURL)
 	cmd.FlagCacheDir(&a.cacheDir)
 	cmd.FlagCacheImage(&a.cacheImageTag)
+	cmd.FlagCacheStatsPath(&a.cacheStatsPath)
 	cmd.FlagGroupPath(&a.groupPath)
+	cmd.FlagInvalidationsPath(&a.invalidationsPath)
 	cmd.FlagLayersDir(&a.layersDir)
+	cmd.FlagRunImage(&a.runImageRef)
+	cmd.FlagRunImagePolicyPath(&a.runImagePolicyPath)
 	cmd.FlagSkipLayers(&a.skipLayers)
+	cmd.FlagStackPath(&a.stackPath)
 	cmd.FlagUseDaemon(&a.useDaemon)
 	cmd.FlagUID(&a.uid)
 	cmd.FlagGID(&a.gid)
@@ -60,7 +75,7 @@ func (a *analyzeCmd) Args(nargs int, args []string) error {
 	if args[0] == "" {
 		return cmd.FailErrCode(errors.New("image argument is required"), cmd.CodeInvalidArgs, "parse arguments")
 	}
-	if a.cacheImageTag == "" && a.cacheDir == "" {
+	if a.cacheImageTag == "" && a.cacheDir == "" && a.cacheURL == "" {
 		cmd.DefaultLogger.Warn("Not restoring cached layer metadata, no cache flag specified.")
 	}
 
@@ -68,11 +83,42 @@ func (a *analyzeCmd) Args(nargs int, args []string) error {
 		a.analyzedPath = cmd.DefaultAnalyzedPath(a.platformAPI, a.layersDir)
 	}
 
+	if a.cacheStatsPath == cmd.PlaceholderCacheStatsPath {
+		a.cacheStatsPath = cmd.DefaultCacheStatsPath(a.platformAPI, a.layersDir)
+	}
+
 	if a.groupPath == cmd.PlaceholderGroupPath {
 		a.groupPath = cmd.DefaultGroupPath(a.platformAPI, a.layersDir)
 	}
 
+	if a.invalidationsPath == cmd.PlaceholderInvalidationsPath {
+		a.invalidationsPath = cmd.DefaultInvalidationsPath(a.platformAPI, a.layersDir)
+	}
+
 	a.imageName = args[0]
+	return a.resolveRunImage()
+}
+
+// resolveRunImage chooses the run image the exporter will use, so that it can be compared with the previous run image.
+// Run image changes are not detected when there is no run image or stack metadata.
+func (a *analyzeCmd) resolveRunImage() error {
+	if a.runImageRef != "" || image.IsArchiveRef(a.imageName) {
+		return nil
+	}
+	var stackMD lifecycle.StackMetadata
+	if _, err := toml.DecodeFile(a.stackPath, &stackMD); err != nil || stackMD.RunImage.Image == "" {
+		cmd.DefaultLogger.Debugf("No run image metadata found at path '%s', run image changes will not be detected", a.stackPath)
+		return nil
+	}
+	policy, err := readRunImagePolicy(a.runImagePolicyPath)
+	if err != nil {
+		return err
+	}
+	_, resolution, _, err := resolveStack(a.imageName, a.stackPath, "", policy.Policy())
+	if err != nil {
+		return err
+	}
+	a.runImageRef = resolution.Reference
 	return nil
 }
 
@@ -108,11 +154,16 @@ func (a *analyzeCmd) Exec() error {
 		return err
 	}
 
-	cacheStore, err := initCache(a.cacheImageTag, a.cacheDir, a.keychain)
+	cacheStore, err := initCache(a.cacheURL, a.cacheImageTag, a.cacheDir, a.keychain)
 	if err != nil {
 		return cmd.FailErr(err, "initialize cache")
 	}
 
+	a.cacheInvalidations, err = readCacheInvalidations(a.invalidationsPath)
+	if err != nil {
+		return err
+	}
+
 	analyzedMD, err := a.analyze(group, cacheStore)
 	if err != nil {
 		return err
@@ -130,7 +181,9 @@ func (aa analyzeArgs) analyze(group lifecycle.BuildpackGroup, cacheStore lifecyc
 		img imgutil.Image
 		err error
 	)
-	if aa.useDaemon {
+	if image.IsArchiveRef(aa.imageName) {
+		img, err = image.NewArchiveImage(aa.imageName)
+	} else if aa.useDaemon {
 		img, err = local.NewImage(
 			aa.imageName,
 			aa.docker,
@@ -147,15 +200,33 @@ func (aa analyzeArgs) analyze(group lifecycle.BuildpackGroup, cacheStore lifecyc
 		return lifecycle.AnalyzedMetadata{}, cmd.FailErr(err, "get previous image")
 	}
 
-	analyzedMD, err := (&lifecycle.Analyzer{
-		Buildpacks: group.Group,
-		LayersDir:  aa.layersDir,
-		Logger:     cmd.DefaultLogger,
-		SkipLayers: aa.skipLayers,
-	}).Analyze(img, cacheStore)
+	var runImage imgutil.Image
+	if aa.runImageRef != "" && img.Found() { // the run image is only compared with the run image of a previous image
+		if aa.useDaemon {
+			runImage, err = local.NewImage(aa.runImageRef, aa.docker, local.FromBaseImage(aa.runImageRef))
+		} else {
+			runImage, err = remote.NewImage(aa.runImageRef, aa.keychain, remote.FromBaseImage(aa.runImageRef))
+		}
+		if err != nil {
+			return lifecycle.AnalyzedMetadata{}, cmd.FailErr(err, "get run image")
+		}
+	}
+
+	analyzer := &lifecycle.Analyzer{
+		Buildpacks:         group.Group,
+		CacheInvalidations: aa.cacheInvalidations,
+		LayersDir:          aa.layersDir,
+		Logger:             cmd.DefaultLogger,
+		RunImage:           runImage,
+		SkipLayers:         aa.skipLayers,
+	}
+	analyzedMD, err := analyzer.Analyze(img, cacheStore)
 	if err != nil {
 		return lifecycle.AnalyzedMetadata{}, cmd.FailErrCode(err, cmd.CodeAnalyzeError, "analyzer")
 	}
+	if err := writeCacheStats(aa.cacheStatsPath, "analyzer", analyzer.CacheStats()); err != nil {
+		return lifecycle.AnalyzedMetadata{}, err
+	}
 	return analyzedMD, nil
 }
 
@@ -164,8 +235,11 @@ func (a *analyzeCmd) registryImages() []string {
 	if a.cacheImageTag != "" {
 		registryImages = append(registryImages, a.cacheImageTag)
 	}
-	if !a.useDaemon {
+	if !a.useDaemon && !image.IsArchiveRef(a.analyzeArgs.imageName) {
 		registryImages = append(registryImages, a.analyzeArgs.imageName)
 	}
+	if !a.useDaemon && a.runImageRef != "" {
+		registryImages = append(registryImages, a.runImageRef)
+	}
 	return registryImages
 }
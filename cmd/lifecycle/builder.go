@@ -17,8 +17,11 @@ import (
 
 type buildCmd struct {
 	// flags: inputs
-	groupPath string
-	planPath  string
+	groupPath    string
+	planPath     string
+	buildTimeout string
+	maxMemory    string
+	maxOpenFiles int
 	buildArgs
 }
 
@@ -27,17 +30,31 @@ type buildArgs struct {
 	buildpacksDir string
 	layersDir     string
 	appDir        string
+	captureOutput bool
+	hideIgnored   bool
+	ignorePath    string
+	limits        lifecycle.ExecLimits
+	prefixOutput  bool
+	resumeFrom    string
 	platformDir   string
 	platformAPI   string
 }
 
 func (b *buildCmd) DefineFlags() {
 	cmd.FlagBuildpacksDir(&b.buildpacksDir)
+	cmd.FlagBuildTimeout(&b.buildTimeout)
 	cmd.FlagGroupPath(&b.groupPath)
 	cmd.FlagPlanPath(&b.planPath)
 	cmd.FlagLayersDir(&b.layersDir)
 	cmd.FlagAppDir(&b.appDir)
 	cmd.FlagPlatformDir(&b.platformDir)
+	cmd.FlagMaxMemory(&b.maxMemory)
+	cmd.FlagMaxOpenFiles(&b.maxOpenFiles)
+	cmd.FlagCaptureOutput(&b.captureOutput)
+	cmd.FlagHideIgnored(&b.hideIgnored)
+	cmd.FlagIgnorePath(&b.ignorePath)
+	cmd.FlagPrefixOutput(&b.prefixOutput)
+	cmd.FlagResumeFrom(&b.resumeFrom)
 }
 
 func (b *buildCmd) Args(nargs int, args []string) error {
@@ -53,7 +70,9 @@ func (b *buildCmd) Args(nargs int, args []string) error {
 		b.planPath = cmd.DefaultPlanPath(b.platformAPI, b.layersDir)
 	}
 
-	return nil
+	var err error
+	b.limits, err = parseExecLimits(b.buildTimeout, b.maxMemory, b.maxOpenFiles)
+	return err
 }
 
 func (b *buildCmd) Privileges() error {
@@ -81,24 +100,59 @@ func (ba buildArgs) build(group lifecycle.BuildpackGroup, plan lifecycle.BuildPl
 		return cmd.FailErrCode(err, cmd.CodeBuildError, "build")
 	}
 
+	var logsDir string
+	if ba.captureOutput {
+		logsDir = filepath.Join(ba.layersDir, cmd.DefaultLogsDirName)
+	}
+
+	if ba.resumeFrom != "" {
+		cmd.DefaultLogger.Infof("Resuming build from buildpack '%s'", ba.resumeFrom)
+	}
+
+	appDir := ba.appDir
+	var filtered *lifecycle.FilteredAppDir
+	if ba.hideIgnored {
+		if filtered, err = filterAppDir(ba.appDir, ba.layersDir, ba.ignorePath); err != nil {
+			return err
+		}
+		defer filtered.Remove()
+		appDir = filtered.Dir
+	}
+
 	builder := &lifecycle.Builder{
-		AppDir:         ba.appDir,
-		LayersDir:      ba.layersDir,
-		PlatformDir:    ba.platformDir,
-		PlatformAPI:    api.MustParse(ba.platformAPI),
-		Env:            env.NewBuildEnv(os.Environ()),
-		Group:          group,
-		Plan:           plan,
-		Out:            cmd.Stdout,
-		Err:            cmd.Stderr,
-		BuildpackStore: &lifecycle.DirBuildpackStore{Dir: buildpacksDir},
+		AppDir:          appDir,
+		LayersDir:       ba.layersDir,
+		PlatformDir:     ba.platformDir,
+		PlatformAPI:     api.MustParse(ba.platformAPI),
+		Env:             env.NewBuildEnv(os.Environ()),
+		Group:           group,
+		Plan:            plan,
+		Out:             cmd.Stdout,
+		Err:             cmd.Stderr,
+		BuildpackStore:  &lifecycle.DirBuildpackStore{Dir: buildpacksDir},
+		Limits:          ba.limits,
+		PrefixOutput:    ba.prefixOutput,
+		LogsDir:         logsDir,
+		CheckpointPath:  filepath.Join(ba.layersDir, "build-checkpoint.toml"),
+		ResumeFrom:      ba.resumeFrom,
+		DeprecationMode: cmd.DeprecationMode,
+		Logger:          cmd.DefaultLogger,
 	}
 	md, err := builder.Build()
+	if filtered != nil {
+		// changes made by buildpacks that ran before a failure are kept for a resumed build
+		if syncErr := filtered.Sync(); syncErr != nil && err == nil {
+			return cmd.FailErr(syncErr, "sync filtered app directory")
+		}
+	}
 
 	if err != nil {
 		if err, ok := err.(*lifecycle.Error); ok {
-			if err.Type == lifecycle.ErrTypeBuildpack {
+			switch err.Type {
+			case lifecycle.ErrTypeBuildpack:
 				return cmd.FailErrCode(err.Cause(), cmd.CodeFailedBuildWithErrors, "build")
+			case lifecycle.ErrTypeBuildpackTimeout:
+				return cmd.FailErrCode(err.Cause(), cmd.CodeBuildTimeout, "build")
 			}
 		}
 		return cmd.FailErrCode(err, cmd.CodeBuildError, "build")
@@ -0,0 +1,264 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"sort"
+
+	"github.com/google/go-containerregistry/pkg/authn"
+
+	"github.com/buildpacks/lifecycle"
+	"github.com/buildpacks/lifecycle/auth"
+	"github.com/buildpacks/lifecycle/cache"
+	"github.com/buildpacks/lifecycle/cmd"
+	"github.com/buildpacks/lifecycle/priv"
+)
+
+func cacheSubcommand() {
+	if len(os.Args) < 3 {
+		cmd.Exit(cmd.FailCode(cmd.CodeInvalidArgs, "parse arguments", "expected 'cache export', 'cache import', 'cache inspect' or 'cache prune'"))
+	}
+	switch os.Args[2] {
+	case "export":
+		cmd.RunArgs(&cacheExportCmd{}, os.Args[3:])
+	case "import":
+		cmd.RunArgs(&cacheImportCmd{}, os.Args[3:])
+	case "inspect":
+		cmd.RunArgs(&cacheInspectCmd{}, os.Args[3:])
+	case "prune":
+		cmd.RunArgs(&cachePruneCmd{}, os.Args[3:])
+	default:
+		cmd.Exit(cmd.FailCode(cmd.CodeInvalidArgs, "unknown cache command:", os.Args[2]))
+	}
+}
+
+type cacheArgs struct {
+	// flags: inputs
+	cacheURL      string
+	cacheDir      string
+	cacheImageTag string
+	uid, gid      int
+
+	archivePath string
+
+	//set before dropping privileges
+	keychain authn.Keychain
+}
+
+func (c *cacheArgs) defineFlags() {
+	cmd.FlagCache(&c.cacheURL)
+	cmd.FlagCacheDir(&c.cacheDir)
+	cmd.FlagCacheImage(&c.cacheImageTag)
+	cmd.FlagUID(&c.uid)
+	cmd.FlagGID(&c.gid)
+}
+
+func (c *cacheArgs) validateCache() error {
+	if c.cacheImageTag == "" && c.cacheDir == "" && c.cacheURL == "" {
+		return cmd.FailErrCode(errors.New("a cache flag is required"), cmd.CodeInvalidArgs, "parse arguments")
+	}
+	return nil
+}
+
+func (c *cacheArgs) archiveArgs(nargs int, args []string) error {
+	if nargs != 1 {
+		return cmd.FailErrCode(fmt.Errorf("received %d arguments, but expected 1", nargs), cmd.CodeInvalidArgs, "parse arguments")
+	}
+	if args[0] == "" {
+		return cmd.FailErrCode(errors.New("archive argument is required"), cmd.CodeInvalidArgs, "parse arguments")
+	}
+	c.archivePath = args[0]
+	return c.validateCache()
+}
+
+func (c *cacheArgs) privileges() error {
+	var err error
+	var registryImages []string
+	if c.cacheImageTag != "" {
+		registryImages = append(registryImages, c.cacheImageTag)
+	}
+	c.keychain, err = auth.DefaultKeychain(registryImages...)
+	if err != nil {
+		return cmd.FailErr(err, "resolve keychain")
+	}
+
+	if err := priv.EnsureOwner(c.uid, c.gid, c.cacheDir); err != nil {
+		return cmd.FailErr(err, "chown volumes")
+	}
+	if err := priv.RunAs(c.uid, c.gid); err != nil {
+		return cmd.FailErr(err, fmt.Sprintf("exec as user %d:%d", c.uid, c.gid))
+	}
+	return nil
+}
+
+func (c *cacheArgs) initCache() (lifecycle.Cache, error) {
+	return initCache(c.cacheURL, c.cacheImageTag, c.cacheDir, c.keychain)
+}
+
+type cacheExportCmd struct {
+	cacheArgs
+	format string
+}
+
+func (e *cacheExportCmd) DefineFlags() {
+	e.defineFlags()
+	cmd.FlagCacheArchiveFormat(&e.format)
+}
+
+func (e *cacheExportCmd) Args(nargs int, args []string) error {
+	if e.format != cmd.CacheArchiveFormatTar && e.format != cmd.CacheArchiveFormatOCI {
+		return cmd.FailErrCode(fmt.Errorf("unknown format '%s', must be '%s' or '%s'", e.format, cmd.CacheArchiveFormatTar, cmd.CacheArchiveFormatOCI), cmd.CodeInvalidArgs, "parse arguments")
+	}
+	return e.archiveArgs(nargs, args)
+}
+
+func (e *cacheExportCmd) Privileges() error {
+	return e.privileges()
+}
+
+func (e *cacheExportCmd) Exec() error {
+	cacheStore, err := e.initCache()
+	if err != nil {
+		return err
+	}
+	if !cacheStore.Exists() {
+		return cmd.FailErr(fmt.Errorf("cache '%s' does not exist", cacheStore.Name()), "export cache")
+	}
+
+	if e.format == cmd.CacheArchiveFormatOCI {
+		if err := cache.ExportLayout(cacheStore, e.archivePath); err != nil {
+			return cmd.FailErr(err, "export cache")
+		}
+	} else if err := exportArchive(cacheStore, e.archivePath); err != nil {
+		return err
+	}
+	cmd.DefaultLogger.Infof("Exported cache '%s' to '%s'", cacheStore.Name(), e.archivePath)
+	return nil
+}
+
+// exportArchive writes the cache to a tar archive at path, removing the archive if it could not be written in full.
+func exportArchive(cacheStore lifecycle.Cache, path string) error {
+	f, err := os.Create(path)
+	if err != nil {
+		return cmd.FailErr(err, "create archive")
+	}
+	err = cache.Export(cacheStore, f)
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		os.Remove(path)
+		return cmd.FailErr(err, "export cache")
+	}
+	return nil
+}
+
+type cacheImportCmd struct {
+	cacheArgs
+}
+
+func (i *cacheImportCmd) DefineFlags() {
+	i.defineFlags()
+}
+
+func (i *cacheImportCmd) Args(nargs int, args []string) error {
+	return i.archiveArgs(nargs, args)
+}
+
+func (i *cacheImportCmd) Privileges() error {
+	return i.privileges()
+}
+
+func (i *cacheImportCmd) Exec() error {
+	cacheStore, err := i.initCache()
+	if err != nil {
+		return err
+	}
+	if err := cache.Import(cacheStore, i.archivePath); err != nil {
+		return cmd.FailErr(err, "import cache")
+	}
+	cmd.DefaultLogger.Infof("Imported '%s' into cache '%s'", i.archivePath, cacheStore.Name())
+	return nil
+}
+
+type cacheInspectCmd struct {
+	cacheArgs
+}
+
+func (i *cacheInspectCmd) DefineFlags() {
+	i.defineFlags()
+}
+
+func (i *cacheInspectCmd) Args(nargs int, args []string) error {
+	if nargs > 0 {
+		return cmd.FailErrCode(errors.New("received unexpected Args"), cmd.CodeInvalidArgs, "parse arguments")
+	}
+	return i.validateCache()
+}
+
+func (i *cacheInspectCmd) Privileges() error {
+	return i.privileges()
+}
+
+func (i *cacheInspectCmd) Exec() error {
+	cacheStore, err := i.initCache()
+	if err != nil {
+		return err
+	}
+	if !cacheStore.Exists() {
+		cmd.DefaultLogger.Infof("Cache '%s' does not exist", cacheStore.Name())
+		return nil
+	}
+	meta, err := cacheStore.RetrieveMetadata()
+	if err != nil {
+		return cmd.FailErr(err, "retrieve cache metadata")
+	}
+
+	cmd.DefaultLogger.Infof("Cache '%s':", cacheStore.Name())
+	for _, bp := range meta.Buildpacks {
+		cmd.DefaultLogger.Infof("  %s@%s", bp.ID, bp.Version)
+		var names []string
+		for name := range bp.Layers {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		for _, name := range names {
+			layer := bp.Layers[name]
+			cmd.DefaultLogger.Infof("    %s: %s (build=%t, launch=%t, cache=%t)", name, layer.SHA, layer.Build, layer.Launch, layer.Cache)
+		}
+	}
+	return nil
+}
+
+type cachePruneCmd struct {
+	cacheArgs
+	invalidations lifecycle.CacheInvalidations
+}
+
+func (p *cachePruneCmd) DefineFlags() {
+	p.defineFlags()
+}
+
+func (p *cachePruneCmd) Args(nargs int, args []string) error {
+	if nargs == 0 {
+		return cmd.FailErrCode(errors.New("at least one <buildpack ID> or <buildpack ID>:<layer name> argument is required"), cmd.CodeInvalidArgs, "parse arguments")
+	}
+	p.invalidations = lifecycle.CacheInvalidations{Invalidate: args}
+	return p.validateCache()
+}
+
+func (p *cachePruneCmd) Privileges() error {
+	return p.privileges()
+}
+
+func (p *cachePruneCmd) Exec() error {
+	cacheStore, err := p.initCache()
+	if err != nil {
+		return err
+	}
+	if err := lifecycle.PruneCache(cacheStore, p.invalidations, cmd.DefaultLogger); err != nil {
+		return cmd.FailErr(err, "prune cache")
+	}
+	return nil
+}
@@ -8,6 +8,7 @@ import (
 
 	"github.com/buildpacks/lifecycle"
 	"github.com/buildpacks/lifecycle/auth"
+	"github.com/buildpacks/lifecycle/cache"
 	"github.com/buildpacks/lifecycle/cmd"
 	"github.com/buildpacks/lifecycle/image"
 	"github.com/buildpacks/lifecycle/priv"
@@ -16,26 +17,58 @@ import (
 type createCmd struct {
 	//flags: inputs
 	appDir              string
+	buildLimits         lifecycle.ExecLimits
+	buildTimeout        string
 	buildpacksDir       string
+	cacheURL            string
+	cacheConcurrency    int
 	cacheDir            string
 	cacheImageTag       string
+	cacheStatsPath      string
+	captureOutput       bool
+	detectCache         bool
+	detectCacheHash     bool
+	detectConcurrency   int
+	detectLimits        lifecycle.ExecLimits
+	detectTimeout       string
+	hideIgnored         bool
+	ignorePath          string
+	imageConfigPath     string
 	imageName           string
+	invalidationsPath   string
 	launchCacheDir      string
 	launcherPath        string
+	lazyCacheURL        string
 	layersDir           string
+	maxImageSize        string
+	maxLayerSize        string
+	maxMemory           string
+	maxNewLayersSize    string
+	maxOpenFiles        int
+	orderOverridesPath  string
 	orderPath           string
+	pinRunImage         bool
+	prefixOutput        bool
 	platformAPI         string
 	platformDir         string
 	previousImage       string
 	processType         string
 	projectMetadataPath string
+	provenance          bool
+	provenanceKeyPath   string
 	registry            string
 	reportPath          string
+	runImagePolicy      lifecycle.RunImagePolicyConfig
+	runImagePolicyPath  string
 	runImageRef         string
+	runImageResolution  lifecycle.RunImageResolution
+	sizeBudget          lifecycle.SizeBudget
 	stackMD             lifecycle.StackMetadata
 	stackPath           string
 	uid, gid            int
 	additionalTags      cmd.StringSlice
+	sizeBudgetWarn      bool
+	lazyRestore         bool
 	skipRestore         bool
 	useDaemon           bool
 
@@ -46,24 +79,50 @@ type createCmd struct {
 
 func (c *createCmd) DefineFlags() {
 	cmd.FlagAppDir(&c.appDir)
+	cmd.FlagBuildTimeout(&c.buildTimeout)
 	cmd.FlagBuildpacksDir(&c.buildpacksDir)
+	cmd.FlagCache(&c.cacheURL)
+	cmd.FlagCacheConcurrency(&c.cacheConcurrency)
 	cmd.FlagCacheDir(&c.cacheDir)
 	cmd.FlagCacheImage(&c.cacheImageTag)
+	cmd.FlagCacheStatsPath(&c.cacheStatsPath)
+	cmd.FlagCaptureOutput(&c.captureOutput)
+	cmd.FlagDetectCache(&c.detectCache)
+	cmd.FlagDetectCacheHash(&c.detectCacheHash)
+	cmd.FlagDetectConcurrency(&c.detectConcurrency)
+	cmd.FlagDetectTimeout(&c.detectTimeout)
 	cmd.FlagGID(&c.gid)
+	cmd.FlagHideIgnored(&c.hideIgnored)
+	cmd.FlagIgnorePath(&c.ignorePath)
+	cmd.FlagImageConfigPath(&c.imageConfigPath)
+	cmd.FlagInvalidationsPath(&c.invalidationsPath)
 	cmd.FlagLaunchCacheDir(&c.launchCacheDir)
 	cmd.FlagLauncherPath(&c.launcherPath)
 	cmd.FlagLayersDir(&c.layersDir)
+	cmd.FlagLazyRestore(&c.lazyRestore)
+	cmd.FlagMaxImageSize(&c.maxImageSize)
+	cmd.FlagMaxLayerSize(&c.maxLayerSize)
+	cmd.FlagMaxMemory(&c.maxMemory)
+	cmd.FlagMaxNewLayersSize(&c.maxNewLayersSize)
+	cmd.FlagMaxOpenFiles(&c.maxOpenFiles)
+	cmd.FlagOrderOverridesPath(&c.orderOverridesPath)
 	cmd.FlagOrderPath(&c.orderPath)
+	cmd.FlagPinRunImage(&c.pinRunImage)
+	cmd.FlagPrefixOutput(&c.prefixOutput)
 	cmd.FlagPlatformDir(&c.platformDir)
 	cmd.FlagPreviousImage(&c.previousImage)
 	cmd.FlagReportPath(&c.reportPath)
 	cmd.FlagRunImage(&c.runImageRef)
+	cmd.FlagRunImagePolicyPath(&c.runImagePolicyPath)
+	cmd.FlagSizeBudgetWarn(&c.sizeBudgetWarn)
 	cmd.FlagSkipRestore(&c.skipRestore)
 	cmd.FlagStackPath(&c.stackPath)
 	cmd.FlagUID(&c.uid)
 	cmd.FlagUseDaemon(&c.useDaemon)
 	cmd.FlagTags(&c.additionalTags)
 	cmd.FlagProjectMetadataPath(&c.projectMetadataPath)
+	cmd.FlagProvenance(&c.provenance)
+	cmd.FlagProvenanceKeyPath(&c.provenanceKeyPath)
 	cmd.FlagProcessType(&c.processType)
 }
 
@@ -78,18 +137,53 @@ func (c *createCmd) Args(nargs int, args []string) error {
 		c.launchCacheDir = ""
 	}
 
-	if c.cacheImageTag == "" && c.cacheDir == "" {
+	if c.cacheImageTag == "" && c.cacheDir == "" && c.cacheURL == "" {
 		cmd.DefaultLogger.Warn("Not restoring or caching layer data, no cache flag specified.")
 	}
 
+	if c.detectCache && c.cacheDir == "" {
+		cmd.DefaultLogger.Warn("Ignoring -detect-cache, requires -cache-dir")
+		c.detectCache = false
+	}
+
+	if c.detectCacheHash && !c.detectCache {
+		cmd.DefaultLogger.Warn("Ignoring -detect-cache-hash-contents, only intended for use with -detect-cache")
+		c.detectCacheHash = false
+	}
+
+	if c.cacheConcurrency < 0 {
+		return cmd.FailErrCode(fmt.Errorf("invalid cache concurrency '%d'", c.cacheConcurrency), cmd.CodeInvalidArgs, "parse arguments")
+	}
+
+	if c.detectConcurrency < 0 {
+		return cmd.FailErrCode(fmt.Errorf("invalid detect concurrency '%d'", c.detectConcurrency), cmd.CodeInvalidArgs, "parse arguments")
+	}
+
 	if c.previousImage == "" {
 		c.previousImage = c.imageName
 	}
 
+	if c.provenanceKeyPath != "" && !c.provenance {
+		cmd.DefaultLogger.Warn("Ignoring -provenance-key, only intended for use with -provenance")
+		c.provenanceKeyPath = ""
+	}
+
 	if err := image.ValidateDestinationTags(c.useDaemon, append(c.additionalTags, c.imageName)...); err != nil {
 		return cmd.FailErrCode(err, cmd.CodeInvalidArgs, "validate image tag(s)")
 	}
 
+	if c.cacheStatsPath == cmd.PlaceholderCacheStatsPath {
+		c.cacheStatsPath = cmd.DefaultCacheStatsPath(c.platformAPI, c.layersDir)
+	}
+
+	if c.imageConfigPath == cmd.PlaceholderImageConfigPath {
+		c.imageConfigPath = cmd.DefaultImageConfigPath(c.platformAPI, c.layersDir)
+	}
+
+	if c.invalidationsPath == cmd.PlaceholderInvalidationsPath {
+		c.invalidationsPath = cmd.DefaultInvalidationsPath(c.platformAPI, c.layersDir)
+	}
+
 	if c.projectMetadataPath == cmd.PlaceholderProjectMetadataPath {
 		c.projectMetadataPath = cmd.DefaultProjectMetadataPath(c.platformAPI, c.layersDir)
 	}
@@ -99,11 +193,37 @@ func (c *createCmd) Args(nargs int, args []string) error {
 	}
 
 	var err error
-	c.stackMD, c.runImageRef, c.registry, err = resolveStack(c.imageName, c.stackPath, c.runImageRef)
+	c.lazyCacheURL, err = lazyCacheURL(c.lazyRestore, c.cacheURL, c.cacheImageTag, c.cacheDir)
+	if err != nil {
+		return err
+	}
+
+	c.sizeBudget, err = parseSizeBudget(c.maxImageSize, c.maxNewLayersSize, c.maxLayerSize, c.sizeBudgetWarn)
+	if err != nil {
+		return err
+	}
+
+	c.detectLimits, err = parseExecLimits(c.detectTimeout, c.maxMemory, c.maxOpenFiles)
 	if err != nil {
 		return err
 	}
 
+	c.buildLimits, err = parseExecLimits(c.buildTimeout, c.maxMemory, c.maxOpenFiles)
+	if err != nil {
+		return err
+	}
+
+	c.runImagePolicy, err = readRunImagePolicy(c.runImagePolicyPath)
+	if err != nil {
+		return err
+	}
+
+	c.stackMD, c.runImageResolution, c.registry, err = resolveStack(c.imageName, c.stackPath, c.runImageRef, c.runImagePolicy.Policy())
+	if err != nil {
+		return err
+	}
+	c.runImageRef = c.runImageResolution.Reference
+
 	return nil
 }
 
@@ -134,19 +254,36 @@ func (c *createCmd) Privileges() error {
 }
 
 func (c *createCmd) Exec() error {
-	cacheStore, err := initCache(c.cacheImageTag, c.cacheDir, c.keychain)
+	var cacheOpts []cache.RemoteImageCacheOption
+	if !c.useDaemon {
+		// layers shared by the app image and cache image can be mounted rather than uploaded twice
+		cacheOpts = append(cacheOpts, cache.WithMountSource(c.imageName))
+	}
+	cacheStore, err := initCache(c.cacheURL, c.cacheImageTag, c.cacheDir, c.keychain, cacheOpts...)
+	if err != nil {
+		return err
+	}
+	inv, err := readCacheInvalidations(c.invalidationsPath)
 	if err != nil {
 		return err
 	}
 
 	cmd.DefaultLogger.Phase("DETECTING")
 	group, plan, err := detectArgs{
-		buildpacksDir: c.buildpacksDir,
-		appDir:        c.appDir,
-		layersDir:     c.layersDir,
-		platformAPI:   c.platformAPI,
-		platformDir:   c.platformDir,
-		orderPath:     c.orderPath,
+		buildpacksDir:      c.buildpacksDir,
+		appDir:             c.appDir,
+		cacheDir:           c.cacheDir,
+		concurrency:        c.detectConcurrency,
+		detectCache:        c.detectCache,
+		detectCacheHash:    c.detectCacheHash,
+		hideIgnored:        c.hideIgnored,
+		ignorePath:         c.ignorePath,
+		layersDir:          c.layersDir,
+		limits:             c.detectLimits,
+		platformAPI:        c.platformAPI,
+		platformDir:        c.platformDir,
+		orderPath:          c.orderPath,
+		orderOverridesPath: c.orderOverridesPath,
 	}.detect()
 	if err != nil {
 		return err
@@ -154,13 +291,16 @@ func (c *createCmd) Exec() error {
 
 	cmd.DefaultLogger.Phase("ANALYZING")
 	analyzedMD, err := analyzeArgs{
-		imageName:   c.previousImage,
-		keychain:    c.keychain,
-		layersDir:   c.layersDir,
-		platformAPI: c.platformAPI,
-		skipLayers:  c.skipRestore,
-		useDaemon:   c.useDaemon,
-		docker:      c.docker,
+		cacheInvalidations: inv,
+		cacheStatsPath:     c.cacheStatsPath,
+		imageName:          c.previousImage,
+		keychain:           c.keychain,
+		layersDir:          c.layersDir,
+		platformAPI:        c.platformAPI,
+		runImageRef:        c.runImageRef,
+		skipLayers:         c.skipRestore,
+		useDaemon:          c.useDaemon,
+		docker:             c.docker,
 	}.analyze(group, cacheStore)
 	if err != nil {
 		return err
@@ -168,7 +308,14 @@ func (c *createCmd) Exec() error {
 
 	if !c.skipRestore {
 		cmd.DefaultLogger.Phase("RESTORING")
-		if err := restore(c.layersDir, group, cacheStore); err != nil {
+		err := restoreArgs{
+			cacheInvalidations: inv,
+			cacheStatsPath:     c.cacheStatsPath,
+			layersDir:          c.layersDir,
+			lazyCacheURL:       c.lazyCacheURL,
+			platformAPI:        c.platformAPI,
+		}.restore(group, cacheStore)
+		if err != nil {
 			return err
 		}
 	}
@@ -178,7 +325,12 @@ func (c *createCmd) Exec() error {
 		buildpacksDir: c.buildpacksDir,
 		layersDir:     c.layersDir,
 		appDir:        c.appDir,
+		captureOutput: c.captureOutput,
+		hideIgnored:   c.hideIgnored,
+		ignorePath:    c.ignorePath,
+		limits:        c.buildLimits,
 		platformAPI:   c.platformAPI,
+		prefixOutput:  c.prefixOutput,
 		platformDir:   c.platformDir,
 	}.build(group, plan)
 	if err != nil {
@@ -188,19 +340,29 @@ func (c *createCmd) Exec() error {
 	cmd.DefaultLogger.Phase("EXPORTING")
 	return exportArgs{
 		appDir:              c.appDir,
+		cacheConcurrency:    c.cacheConcurrency,
+		cacheStatsPath:      c.cacheStatsPath,
 		docker:              c.docker,
 		gid:                 c.gid,
+		ignorePath:          c.ignorePath,
+		imageConfigPath:     c.imageConfigPath,
 		imageNames:          append([]string{c.imageName}, c.additionalTags...),
 		keychain:            c.keychain,
 		launchCacheDir:      c.launchCacheDir,
 		launcherPath:        c.launcherPath,
 		layersDir:           c.layersDir,
+		pinRunImage:         c.pinRunImage,
 		platformAPI:         c.platformAPI,
 		processType:         c.processType,
 		projectMetadataPath: c.projectMetadataPath,
+		provenance:          c.provenance,
+		provenanceKeyPath:   c.provenanceKeyPath,
 		registry:            c.registry,
 		reportPath:          c.reportPath,
+		runImagePolicy:      c.runImagePolicy,
 		runImageRef:         c.runImageRef,
+		runImageResolution:  c.runImageResolution,
+		sizeBudget:          c.sizeBudget,
 		stackMD:             c.stackMD,
 		stackPath:           c.stackPath,
 		uid:                 c.uid,
@@ -215,7 +377,11 @@ func (c *createCmd) registryImages() []string {
 	}
 	if !c.useDaemon {
 		registryImages = append(registryImages, append([]string{c.imageName}, c.additionalTags...)...)
-		registryImages = append(registryImages, c.runImageRef, c.previousImage)
+		registryImages = append(registryImages, c.runImageRef)
+		registryImages = append(registryImages, runImageCandidates(c.runImagePolicy, c.runImageResolution, c.stackMD)...)
+		if !image.IsArchiveRef(c.previousImage) {
+			registryImages = append(registryImages, c.previousImage)
+		}
 	}
 	return registryImages
 }
@@ -18,24 +18,46 @@ type detectCmd struct {
 	// flags: paths to write outputs
 	groupPath string
 	planPath  string
+
+	detectTimeout string
+	maxMemory     string
+	maxOpenFiles  int
 }
 
 type detectArgs struct {
 	// inputs needed when run by creator
-	buildpacksDir string
-	appDir        string
-	layersDir     string
-	platformAPI   string
-	platformDir   string
-	orderPath     string
+	buildpacksDir      string
+	appDir             string
+	cacheDir           string
+	concurrency        int
+	detectCache        bool
+	detectCacheHash    bool
+	hideIgnored        bool
+	ignorePath         string
+	layersDir          string
+	limits             lifecycle.ExecLimits
+	platformAPI        string
+	platformDir        string
+	orderPath          string
+	orderOverridesPath string
 }
 
 func (d *detectCmd) DefineFlags() {
 	cmd.FlagBuildpacksDir(&d.buildpacksDir)
 	cmd.FlagAppDir(&d.appDir)
+	cmd.FlagCacheDir(&d.cacheDir)
+	cmd.FlagDetectCache(&d.detectCache)
+	cmd.FlagDetectCacheHash(&d.detectCacheHash)
+	cmd.FlagDetectConcurrency(&d.concurrency)
+	cmd.FlagDetectTimeout(&d.detectTimeout)
+	cmd.FlagHideIgnored(&d.hideIgnored)
+	cmd.FlagIgnorePath(&d.ignorePath)
 	cmd.FlagLayersDir(&d.layersDir)
+	cmd.FlagMaxMemory(&d.maxMemory)
+	cmd.FlagMaxOpenFiles(&d.maxOpenFiles)
 	cmd.FlagPlatformDir(&d.platformDir)
 	cmd.FlagOrderPath(&d.orderPath)
+	cmd.FlagOrderOverridesPath(&d.orderOverridesPath)
 	cmd.FlagGroupPath(&d.groupPath)
 	cmd.FlagPlanPath(&d.planPath)
 }
@@ -53,7 +75,23 @@ func (d *detectCmd) Args(nargs int, args []string) error {
 		d.planPath = cmd.DefaultPlanPath(d.platformAPI, d.layersDir)
 	}
 
-	return nil
+	if d.detectCache && d.cacheDir == "" {
+		cmd.DefaultLogger.Warn("Ignoring -detect-cache, requires -cache-dir")
+		d.detectCache = false
+	}
+
+	if d.detectCacheHash && !d.detectCache {
+		cmd.DefaultLogger.Warn("Ignoring -detect-cache-hash-contents, only intended for use with -detect-cache")
+		d.detectCacheHash = false
+	}
+
+	if d.concurrency < 0 {
+		return cmd.FailErrCode(fmt.Errorf("invalid detect concurrency '%d'", d.concurrency), cmd.CodeInvalidArgs, "parse arguments")
+	}
+
+	var err error
+	d.limits, err = parseExecLimits(d.detectTimeout, d.maxMemory, d.maxOpenFiles)
+	return err
 }
 
 func (d *detectCmd) Privileges() error {
@@ -77,6 +115,9 @@ func (da detectArgs) detect() (lifecycle.BuildpackGroup, lifecycle.BuildPlan, er
 	if err != nil {
 		return lifecycle.BuildpackGroup{}, lifecycle.BuildPlan{}, cmd.FailErr(err, "read buildpack order file")
 	}
+	if order, err = da.applyOrderOverrides(order); err != nil {
+		return lifecycle.BuildpackGroup{}, lifecycle.BuildPlan{}, err
+	}
 	if err := da.verifyBuildpackApis(order); err != nil {
 		return lifecycle.BuildpackGroup{}, lifecycle.BuildPlan{}, err
 	}
@@ -86,12 +127,29 @@ func (da detectArgs) detect() (lifecycle.BuildpackGroup, lifecycle.BuildPlan, er
 	if err != nil {
 		return lifecycle.BuildpackGroup{}, lifecycle.BuildPlan{}, cmd.FailErr(err, "read full env")
 	}
+	var detectCache *lifecycle.DetectCache
+	if da.detectCache {
+		detectCache = lifecycle.NewDetectCache(da.cacheDir)
+		detectCache.HashContents = da.detectCacheHash
+	}
+	appDir := da.appDir
+	if da.hideIgnored {
+		filtered, err := filterAppDir(da.appDir, da.layersDir, da.ignorePath)
+		if err != nil {
+			return lifecycle.BuildpackGroup{}, lifecycle.BuildPlan{}, err
+		}
+		defer filtered.Remove()
+		appDir = filtered.Dir
+	}
 	group, plan, err := order.Detect(&lifecycle.DetectConfig{
 		FullEnv:       fullEnv,
 		ClearEnv:      envv.List(),
-		AppDir:        da.appDir,
+		AppDir:        appDir,
 		PlatformDir:   da.platformDir,
 		BuildpacksDir: da.buildpacksDir,
+		Cache:         detectCache,
+		Concurrency:   da.concurrency,
+		Limits:        da.limits,
 		Logger:        cmd.DefaultLogger,
 	})
 	if err != nil {
@@ -116,6 +174,22 @@ func (da detectArgs) detect() (lifecycle.BuildpackGroup, lifecycle.BuildPlan, er
 	return group, plan, nil
 }
 
+func (da detectArgs) applyOrderOverrides(order lifecycle.BuildpackOrder) (lifecycle.BuildpackOrder, error) {
+	overrides, err := lifecycle.ReadOrderOverrides(da.orderOverridesPath)
+	if err != nil {
+		return nil, cmd.FailErrCode(err, cmd.CodeInvalidArgs, "read order overrides")
+	}
+	if overrides.Empty() {
+		return order, nil
+	}
+	cmd.DefaultLogger.Infof("Applying order overrides from '%s'", da.orderOverridesPath)
+	order, err = overrides.Apply(order, da.buildpacksDir)
+	if err != nil {
+		return nil, cmd.FailErrCode(err, cmd.CodeInvalidArgs, "apply order overrides")
+	}
+	return order, nil
+}
+
 func (da detectArgs) verifyBuildpackApis(order lifecycle.BuildpackOrder) error {
 	for _, group := range order {
 		for _, bp := range group.Group {
@@ -4,6 +4,7 @@ import (
 	"fmt"
 	"io/ioutil"
 	"os"
+	"path/filepath"
 
 	"github.com/BurntSushi/toml"
 	"github.com/buildpacks/imgutil"
@@ -28,10 +29,12 @@ type exportCmd struct {
 	analyzedMD lifecycle.AnalyzedMetadata
 
 	//flags: inputs
+	cacheURL              string
 	cacheDir              string
 	cacheImageTag         string
 	groupPath             string
 	deprecatedRunImageRef string
+	runImagePolicyPath    string
 	exportArgs
 
 	//flags: paths to write outputs
@@ -41,16 +44,30 @@ type exportCmd struct {
 type exportArgs struct {
 	// inputs needed when run by creator
 	appDir              string
+	cacheConcurrency    int
+	cacheStatsPath      string
+	ignorePath          string
+	imageConfigPath     string
 	imageNames          []string
 	launchCacheDir      string
 	launcherPath        string
 	layersDir           string
+	maxImageSize        string
+	maxLayerSize        string
+	maxNewLayersSize    string
+	pinRunImage         bool
 	platformAPI         string
 	processType         string
 	projectMetadataPath string
+	provenance          bool
+	provenanceKeyPath   string
 	registry            string
 	reportPath          string
+	runImagePolicy      lifecycle.RunImagePolicyConfig
 	runImageRef         string
+	runImageResolution  lifecycle.RunImageResolution
+	sizeBudget          lifecycle.SizeBudget
+	sizeBudgetWarn      bool
 	stackMD             lifecycle.StackMetadata
 	stackPath           string
 	useDaemon           bool
@@ -64,17 +81,30 @@ type exportArgs struct {
 func (e *exportCmd) DefineFlags() {
 	cmd.FlagAnalyzedPath(&e.analyzedPath)
 	cmd.FlagAppDir(&e.appDir)
+	cmd.FlagCache(&e.cacheURL)
+	cmd.FlagCacheConcurrency(&e.cacheConcurrency)
 	cmd.FlagCacheDir(&e.cacheDir)
 	cmd.FlagCacheImage(&e.cacheImageTag)
+	cmd.FlagCacheStatsPath(&e.cacheStatsPath)
 	cmd.FlagGID(&e.gid)
 	cmd.FlagGroupPath(&e.groupPath)
+	cmd.FlagIgnorePath(&e.ignorePath)
+	cmd.FlagImageConfigPath(&e.imageConfigPath)
 	cmd.FlagLaunchCacheDir(&e.launchCacheDir)
 	cmd.FlagLauncherPath(&e.launcherPath)
 	cmd.FlagLayersDir(&e.layersDir)
+	cmd.FlagMaxImageSize(&e.maxImageSize)
+	cmd.FlagMaxLayerSize(&e.maxLayerSize)
+	cmd.FlagMaxNewLayersSize(&e.maxNewLayersSize)
+	cmd.FlagPinRunImage(&e.pinRunImage)
 	cmd.FlagProcessType(&e.processType)
 	cmd.FlagProjectMetadataPath(&e.projectMetadataPath)
+	cmd.FlagProvenance(&e.provenance)
+	cmd.FlagProvenanceKeyPath(&e.provenanceKeyPath)
 	cmd.FlagReportPath(&e.reportPath)
 	cmd.FlagRunImage(&e.runImageRef)
+	cmd.FlagRunImagePolicyPath(&e.runImagePolicyPath)
+	cmd.FlagSizeBudgetWarn(&e.sizeBudgetWarn)
 	cmd.FlagStackPath(&e.stackPath)
 	cmd.FlagUID(&e.uid)
 	cmd.FlagUseDaemon(&e.useDaemon)
@@ -93,10 +123,19 @@ func (e *exportCmd) Args(nargs int, args []string) error {
 		e.launchCacheDir = ""
 	}
 
-	if e.cacheImageTag == "" && e.cacheDir == "" {
+	if e.cacheImageTag == "" && e.cacheDir == "" && e.cacheURL == "" {
 		cmd.DefaultLogger.Warn("Will not cache data, no cache flag specified.")
 	}
 
+	if e.cacheConcurrency < 0 {
+		return cmd.FailErrCode(fmt.Errorf("invalid cache concurrency '%d'", e.cacheConcurrency), cmd.CodeInvalidArgs, "parse arguments")
+	}
+
+	if e.provenanceKeyPath != "" && !e.provenance {
+		cmd.DefaultLogger.Warn("Ignoring -provenance-key, only intended for use with -provenance")
+		e.provenanceKeyPath = ""
+	}
+
 	if err := image.ValidateDestinationTags(e.useDaemon, e.imageNames...); err != nil {
 		return cmd.FailErrCode(err, cmd.CodeInvalidArgs, "validate image tag(s)")
 	}
@@ -109,10 +148,18 @@ func (e *exportCmd) Args(nargs int, args []string) error {
 		e.analyzedPath = cmd.DefaultAnalyzedPath(e.platformAPI, e.layersDir)
 	}
 
+	if e.cacheStatsPath == cmd.PlaceholderCacheStatsPath {
+		e.cacheStatsPath = cmd.DefaultCacheStatsPath(e.platformAPI, e.layersDir)
+	}
+
 	if e.groupPath == cmd.PlaceholderGroupPath {
 		e.groupPath = cmd.DefaultGroupPath(e.platformAPI, e.layersDir)
 	}
 
+	if e.imageConfigPath == cmd.PlaceholderImageConfigPath {
+		e.imageConfigPath = cmd.DefaultImageConfigPath(e.platformAPI, e.layersDir)
+	}
+
 	if e.projectMetadataPath == cmd.PlaceholderProjectMetadataPath {
 		e.projectMetadataPath = cmd.DefaultProjectMetadataPath(e.platformAPI, e.layersDir)
 	}
@@ -126,10 +173,21 @@ func (e *exportCmd) Args(nargs int, args []string) error {
 	}
 
 	var err error
-	e.stackMD, e.runImageRef, e.registry, err = resolveStack(e.imageNames[0], e.stackPath, e.runImageRef)
+	e.sizeBudget, err = parseSizeBudget(e.maxImageSize, e.maxNewLayersSize, e.maxLayerSize, e.sizeBudgetWarn)
+	if err != nil {
+		return err
+	}
+
+	e.runImagePolicy, err = readRunImagePolicy(e.runImagePolicyPath)
+	if err != nil {
+		return err
+	}
+
+	e.stackMD, e.runImageResolution, e.registry, err = resolveStack(e.imageNames[0], e.stackPath, e.runImageRef, e.runImagePolicy.Policy())
 	if err != nil {
 		return err
 	}
+	e.runImageRef = e.runImageResolution.Reference
 
 	e.analyzedMD, err = parseOptionalAnalyzedMD(cmd.DefaultLogger, e.analyzedPath)
 	if err != nil {
@@ -171,7 +229,12 @@ func (e *exportCmd) Exec() error {
 		return err
 	}
 
-	cacheStore, err := initCache(e.cacheImageTag, e.cacheDir, e.keychain)
+	var cacheOpts []cache.RemoteImageCacheOption
+	if !e.useDaemon {
+		// layers shared by the app image and cache image can be mounted rather than uploaded twice
+		cacheOpts = append(cacheOpts, cache.WithMountSource(e.imageNames[0]))
+	}
+	cacheStore, err := initCache(e.cacheURL, e.cacheImageTag, e.cacheDir, e.keychain, cacheOpts...)
 	if err != nil {
 		cmd.DefaultLogger.Infof("no stack metadata found at path '%s', stack metadata will not be exported\n", e.stackPath)
 	}
@@ -187,7 +250,11 @@ func (e *exportCmd) registryImages() []string {
 	if !e.useDaemon {
 		registryImages = append(registryImages, e.imageNames...)
 		registryImages = append(registryImages, e.runImageRef)
-		if e.analyzedMD.Image != nil {
+		registryImages = append(registryImages, runImageCandidates(e.runImagePolicy, e.runImageResolution, e.stackMD)...)
+		if e.pinRunImage && e.analyzedMD.Metadata.RunImage.Reference != "" {
+			registryImages = append(registryImages, e.analyzedMD.Metadata.RunImage.Reference)
+		}
+		if e.analyzedMD.Image != nil && !image.IsArchiveRef(e.analyzedMD.Image.Reference) {
 			registryImages = append(registryImages, e.analyzedMD.Image.Reference)
 		}
 	}
@@ -210,33 +277,64 @@ func (ea exportArgs) export(group lifecycle.BuildpackGroup, cacheStore lifecycle
 		cmd.DefaultLogger.Debugf("no project metadata found at path '%s', project metadata will not be exported\n", ea.projectMetadataPath)
 	}
 
+	var imageConfig lifecycle.ImageConfig
+	_, err = toml.DecodeFile(ea.imageConfigPath, &imageConfig)
+	if err != nil {
+		if !os.IsNotExist(err) {
+			return cmd.FailErr(err, "read image config")
+		}
+		cmd.DefaultLogger.Debugf("no image config found at path '%s', image config will not be applied\n", ea.imageConfigPath)
+	}
+
+	ignoreRules, err := readIgnoreRules(ea.appDir, ea.ignorePath)
+	if err != nil {
+		return err
+	}
+
 	exporter := &lifecycle.Exporter{
 		Buildpacks: group.Group,
 		LayerFactory: &layers.Factory{
 			ArtifactsDir: artifactsDir,
 			UID:          ea.uid,
 			GID:          ea.gid,
+			Ignore:       ignoreRules,
 			Logger:       cmd.DefaultLogger,
 		},
-		Logger:      cmd.DefaultLogger,
-		PlatformAPI: api.MustParse(ea.platformAPI),
+		Logger:           cmd.DefaultLogger,
+		PlatformAPI:      api.MustParse(ea.platformAPI),
+		CacheConcurrency: ea.cacheConcurrency,
+	}
+
+	ea.pinToPreviousRunImage(analyzedMD)
+	if err := ea.verifyRunImage(); err != nil {
+		return err
 	}
 
 	var appImage imgutil.Image
 	var runImageID string
 	if ea.useDaemon {
-		appImage, runImageID, err = ea.initDaemonAppImage(analyzedMD)
+		appImage, runImageID, err = ea.initDaemonAppImage(analyzedMD, artifactsDir)
 	} else {
-		appImage, runImageID, err = ea.initRemoteAppImage(analyzedMD)
+		appImage, runImageID, err = ea.initRemoteAppImage(analyzedMD, artifactsDir)
 	}
 	if err != nil {
 		return err
 	}
 
+	var baseLayerSizes lifecycle.BaseLayerSizes
+	if ea.sizeBudget.MaxImageSize > 0 {
+		if baseLayerSizes, err = ea.baseLayerSizes(analyzedMD); err != nil {
+			return err
+		}
+	}
+
 	report, err := exporter.Export(lifecycle.ExportOptions{
 		AdditionalNames:    ea.imageNames[1:],
 		AppDir:             ea.appDir,
+		BaseLayerSizes:     baseLayerSizes,
 		DefaultProcessType: ea.processType,
+		ImageConfig:        imageConfig,
+		SizeBudget:         ea.sizeBudget,
 		LauncherConfig:     launcherConfig(ea.launcherPath),
 		LayersDir:          ea.layersDir,
 		OrigMetadata:       analyzedMD.Metadata,
@@ -248,24 +346,49 @@ func (ea exportArgs) export(group lifecycle.BuildpackGroup, cacheStore lifecycle
 	if err != nil {
 		return cmd.FailErrCode(err, cmd.CodeExportError, "export")
 	}
+	if ea.runImageResolution.Reference != "" {
+		report.RunImage = &ea.runImageResolution
+	}
 	if err := lifecycle.WriteTOML(ea.reportPath, &report); err != nil {
 		return cmd.FailErrCode(err, cmd.CodeExportError, "write export report")
 	}
 
+	if ea.provenance {
+		if err := ea.writeProvenance(appImage, report); err != nil {
+			return cmd.FailErrCode(err, cmd.CodeExportError, "write provenance")
+		}
+	}
+
 	if cacheStore != nil {
 		if cacheErr := exporter.Cache(ea.layersDir, cacheStore); cacheErr != nil {
 			cmd.DefaultLogger.Warnf("Failed to export cache: %v\n", cacheErr)
+		} else if err := writeCacheStats(ea.cacheStatsPath, "exporter", exporter.CacheStats()); err != nil {
+			cmd.DefaultLogger.Warnf("Failed to write cache stats: %v\n", err)
 		}
 	}
 	return nil
 }
 
-func (ea exportArgs) initDaemonAppImage(analyzedMD lifecycle.AnalyzedMetadata) (imgutil.Image, string, error) {
+func (ea exportArgs) writeProvenance(appImage imgutil.Image, report lifecycle.ExportReport) error {
+	statement, err := lifecycle.NewProvenance(appImage, report)
+	if err != nil {
+		return err
+	}
+	provenancePath := filepath.Join(filepath.Dir(ea.reportPath), cmd.DefaultProvenanceFile)
+	if ea.provenanceKeyPath != "" {
+		cmd.DefaultLogger.Infof("Writing signed provenance to '%s'", provenancePath)
+	} else {
+		cmd.DefaultLogger.Infof("Writing provenance to '%s'", provenancePath)
+	}
+	return lifecycle.WriteProvenance(provenancePath, statement, ea.provenanceKeyPath)
+}
+
+func (ea exportArgs) initDaemonAppImage(analyzedMD lifecycle.AnalyzedMetadata, artifactsDir string) (imgutil.Image, string, error) {
 	var opts = []local.ImageOption{
 		local.FromBaseImage(ea.runImageRef),
 	}
 
-	if analyzedMD.Image != nil {
+	if analyzedMD.Image != nil && !image.IsArchiveRef(analyzedMD.Image.Reference) {
 		cmd.DefaultLogger.Debugf("Reusing layers from image with id '%s'", analyzedMD.Image.Reference)
 		opts = append(opts, local.WithPreviousImage(analyzedMD.Image.Reference))
 	}
@@ -285,6 +408,11 @@ func (ea exportArgs) initDaemonAppImage(analyzedMD lifecycle.AnalyzedMetadata) (
 		return nil, "", cmd.FailErr(err, "get run image ID")
 	}
 
+	appImage, err = withPreviousArchive(appImage, analyzedMD, artifactsDir)
+	if err != nil {
+		return nil, "", err
+	}
+
 	if ea.launchCacheDir != "" {
 		volumeCache, err := cache.NewVolumeCache(ea.launchCacheDir)
 		if err != nil {
@@ -292,15 +420,15 @@ func (ea exportArgs) initDaemonAppImage(analyzedMD lifecycle.AnalyzedMetadata) (
 		}
 		appImage = cache.NewCachingImage(appImage, volumeCache)
 	}
-	return appImage, runImageID.String(), nil
+	return image.NewLocalConfigImage(appImage, ea.docker), runImageID.String(), nil
 }
 
-func (ea exportArgs) initRemoteAppImage(analyzedMD lifecycle.AnalyzedMetadata) (imgutil.Image, string, error) {
+func (ea exportArgs) initRemoteAppImage(analyzedMD lifecycle.AnalyzedMetadata, artifactsDir string) (imgutil.Image, string, error) {
 	var opts = []remote.ImageOption{
 		remote.FromBaseImage(ea.runImageRef),
 	}
 
-	if analyzedMD.Image != nil {
+	if analyzedMD.Image != nil && !image.IsArchiveRef(analyzedMD.Image.Reference) {
 		cmd.DefaultLogger.Infof("Reusing layers from image '%s'", analyzedMD.Image.Reference)
 		ref, err := name.ParseReference(analyzedMD.Image.Reference, name.WeakValidation)
 		if err != nil {
@@ -313,6 +441,7 @@ func (ea exportArgs) initRemoteAppImage(analyzedMD lifecycle.AnalyzedMetadata) (
 		opts = append(opts, remote.WithPreviousImage(analyzedMD.Image.Reference))
 	}
 
+	var appImage imgutil.Image
 	appImage, err := remote.NewImage(
 		ea.imageNames[0],
 		ea.keychain,
@@ -322,6 +451,11 @@ func (ea exportArgs) initRemoteAppImage(analyzedMD lifecycle.AnalyzedMetadata) (
 		return nil, "", cmd.FailErr(err, "create new app image")
 	}
 
+	appImage, err = withPreviousArchive(appImage, analyzedMD, artifactsDir)
+	if err != nil {
+		return nil, "", err
+	}
+
 	runImage, err := remote.NewImage(ea.runImageRef, ea.keychain, remote.FromBaseImage(ea.runImageRef))
 	if err != nil {
 		return nil, "", cmd.FailErr(err, "access run image")
@@ -330,7 +464,75 @@ func (ea exportArgs) initRemoteAppImage(analyzedMD lifecycle.AnalyzedMetadata) (
 	if err != nil {
 		return nil, "", cmd.FailErr(err, "get run image reference")
 	}
-	return appImage, runImageID.String(), nil
+	return image.NewRemoteConfigImage(appImage, ea.keychain), runImageID.String(), nil
+}
+
+// withPreviousArchive wraps appImage so that it reuses layers from the analyzed image, when that image is an archive.
+func withPreviousArchive(appImage imgutil.Image, analyzedMD lifecycle.AnalyzedMetadata, tmpDir string) (imgutil.Image, error) {
+	if analyzedMD.Image == nil || !image.IsArchiveRef(analyzedMD.Image.Reference) {
+		return appImage, nil
+	}
+	cmd.DefaultLogger.Infof("Reusing layers from image archive '%s'", analyzedMD.Image.Reference)
+	previous, err := image.NewArchiveImage(analyzedMD.Image.Reference)
+	if err != nil {
+		return nil, cmd.FailErr(err, "read previous image archive")
+	}
+	if !previous.Found() {
+		return nil, cmd.FailErr(fmt.Errorf("image archive '%s' does not exist", analyzedMD.Image.Reference), "read previous image archive")
+	}
+	return image.WithPreviousArchive(appImage, previous, tmpDir), nil
+}
+
+// baseLayerSizes sizes the run image and the layers of the previous image, which the exporter does not write.
+func (ea exportArgs) baseLayerSizes(analyzedMD lifecycle.AnalyzedMetadata) (lifecycle.BaseLayerSizes, error) {
+	var (
+		sizes lifecycle.BaseLayerSizes
+		err   error
+	)
+	if ea.useDaemon {
+		sizes.RunImage, _, err = image.DaemonImageSize(ea.docker, ea.runImageRef)
+	} else {
+		sizes.RunImage, _, err = image.RegistryImageSize(ea.runImageRef, ea.keychain)
+	}
+	if err != nil {
+		return lifecycle.BaseLayerSizes{}, cmd.FailErr(err, "size run image")
+	}
+
+	if analyzedMD.Image == nil || analyzedMD.Image.Reference == "" {
+		return sizes, nil
+	}
+	ref := analyzedMD.Image.Reference
+	switch {
+	case image.IsArchiveRef(ref):
+		previous, err := image.NewArchiveImage(ref)
+		if err != nil {
+			return lifecycle.BaseLayerSizes{}, cmd.FailErr(err, "read previous image archive")
+		}
+		_, sizes.Previous, err = previous.Size()
+	case ea.useDaemon:
+		_, sizes.Previous, err = image.DaemonImageSize(ea.docker, ref)
+	default:
+		_, sizes.Previous, err = image.RegistryImageSize(ref, ea.keychain)
+	}
+	if err != nil {
+		return lifecycle.BaseLayerSizes{}, cmd.FailErr(err, "size previous image")
+	}
+	return sizes, nil
+}
+
+func parseSizeBudget(maxImageSize, maxNewLayersSize, maxLayerSize string, warnOnly bool) (lifecycle.SizeBudget, error) {
+	var err error
+	budget := lifecycle.SizeBudget{WarnOnly: warnOnly}
+	if budget.MaxImageSize, err = cmd.ParseSize(maxImageSize); err != nil {
+		return lifecycle.SizeBudget{}, cmd.FailErrCode(err, cmd.CodeInvalidArgs, "parse max image size")
+	}
+	if budget.MaxNewLayersSize, err = cmd.ParseSize(maxNewLayersSize); err != nil {
+		return lifecycle.SizeBudget{}, cmd.FailErrCode(err, cmd.CodeInvalidArgs, "parse max new layers size")
+	}
+	if budget.MaxLayerSize, err = cmd.ParseSize(maxLayerSize); err != nil {
+		return lifecycle.SizeBudget{}, cmd.FailErrCode(err, cmd.CodeInvalidArgs, "parse max layer size")
+	}
+	return budget, nil
 }
 
 func launcherConfig(launcherPath string) lifecycle.LauncherConfig {
@@ -364,10 +566,10 @@ func parseOptionalAnalyzedMD(logger lifecycle.Logger, path string) (lifecycle.An
 	return analyzedMD, nil
 }
 
-func resolveStack(imageName, stackPath, runImageRefOrig string) (lifecycle.StackMetadata, string, string, error) {
+func resolveStack(imageName, stackPath, runImageRefOrig string, policy lifecycle.RunImagePolicy) (lifecycle.StackMetadata, lifecycle.RunImageResolution, string, error) {
 	ref, err := name.ParseReference(imageName, name.WeakValidation)
 	if err != nil {
-		return lifecycle.StackMetadata{}, "", "", cmd.FailErr(err, "failed to parse registry")
+		return lifecycle.StackMetadata{}, lifecycle.RunImageResolution{}, "", cmd.FailErr(err, "failed to parse registry")
 	}
 
 	registry := ref.Context().RegistryStr()
@@ -378,22 +580,100 @@ func resolveStack(imageName, stackPath, runImageRefOrig string) (lifecycle.Stack
 		cmd.DefaultLogger.Infof("no stack metadata found at path '%s', stack metadata will not be exported\n", stackPath)
 	}
 
-	var runImageRef string
-	if runImageRefOrig == "" {
-		if stackMD.RunImage.Image == "" {
-			return lifecycle.StackMetadata{}, "", "", cmd.FailErrCode(
-				errors.New("-run-image is required when there is no stack metadata available"),
-				cmd.CodeInvalidArgs,
-				"parse arguments",
-			)
-		}
-		runImageRef, err = stackMD.BestRunImageMirror(registry)
-		if err != nil {
-			return lifecycle.StackMetadata{}, "", "", err
-		}
-	} else {
-		runImageRef = runImageRefOrig
+	if runImageRefOrig != "" {
+		return stackMD, lifecycle.RunImageResolution{
+			Reference: runImageRefOrig,
+			Reasons:   []string{"set by -run-image"},
+		}, registry, nil
+	}
+	if stackMD.RunImage.Image == "" {
+		return lifecycle.StackMetadata{}, lifecycle.RunImageResolution{}, "", cmd.FailErrCode(
+			errors.New("-run-image is required when there is no stack metadata available"),
+			cmd.CodeInvalidArgs,
+			"parse arguments",
+		)
+	}
+	resolution, err := lifecycle.ResolveRunImage(stackMD, registry, policy, nil)
+	if err != nil {
+		return lifecycle.StackMetadata{}, lifecycle.RunImageResolution{}, "", err
+	}
+	return stackMD, resolution, registry, nil
+}
+
+func readRunImagePolicy(path string) (lifecycle.RunImagePolicyConfig, error) {
+	policy, err := lifecycle.ReadRunImagePolicyConfig(path)
+	if err != nil {
+		return lifecycle.RunImagePolicyConfig{}, cmd.FailErrCode(err, cmd.CodeInvalidArgs, "read run image policy")
+	}
+	return policy, nil
+}
+
+// runImageCandidates returns the run image and mirrors that may be looked up when verifying the run image.
+func runImageCandidates(policy lifecycle.RunImagePolicyConfig, resolution lifecycle.RunImageResolution, stackMD lifecycle.StackMetadata) []string {
+	if !policy.Verify || resolution.Policy == "" {
+		return nil
 	}
+	return append([]string{stackMD.RunImage.Image}, stackMD.RunImage.Mirrors...)
+}
 
-	return stackMD, runImageRef, registry, nil
+// pinToPreviousRunImage uses the run image of the previous image when requested, so that rebuilds do not change the base.
+func (ea *exportArgs) pinToPreviousRunImage(analyzedMD lifecycle.AnalyzedMetadata) {
+	if !ea.pinRunImage {
+		return
+	}
+	previous := analyzedMD.Metadata.RunImage.Reference
+	if analyzedMD.Image == nil || previous == "" {
+		cmd.DefaultLogger.Infof("Not pinning run image, previous image has no run image metadata")
+		return
+	}
+	cmd.DefaultLogger.Infof("Pinning run image to '%s' from previous image", previous)
+	ea.runImageRef = previous
+	ea.runImageResolution = lifecycle.RunImageResolution{
+		Reference: previous,
+		Reasons:   []string{"pinned to the run image of the previous image"},
+	}
+}
+
+// verifyRunImage chooses the run image again, skipping mirrors that are unreachable or differ from the primary run image,
+// when required by the run image policy.
+func (ea *exportArgs) verifyRunImage() error {
+	if !ea.runImagePolicy.Verify || ea.runImageResolution.Policy == "" {
+		return nil
+	}
+	if ea.useDaemon {
+		cmd.DefaultLogger.Warn("Not verifying run image mirrors, only supported when exporting to a registry")
+		return nil
+	}
+	resolution, err := lifecycle.ResolveRunImage(ea.stackMD, ea.registry, ea.runImagePolicy.Policy(), ea.runImageDigest)
+	for _, reason := range resolution.Reasons {
+		cmd.DefaultLogger.Debugf("Run image: %s", reason)
+	}
+	if err != nil {
+		return cmd.FailErrCode(err, cmd.CodeExportError, "verify run image")
+	}
+	if resolution.Reference != ea.runImageRef {
+		cmd.DefaultLogger.Infof("Using run image '%s' instead of '%s'", resolution.Reference, ea.runImageRef)
+	}
+	ea.runImageRef = resolution.Reference
+	ea.runImageResolution = resolution
+	return nil
+}
+
+func (ea exportArgs) runImageDigest(ref string) (string, error) {
+	img, err := remote.NewImage(ref, ea.keychain, remote.FromBaseImage(ref))
+	if err != nil {
+		return "", err
+	}
+	if !img.Found() {
+		return "", fmt.Errorf("image '%s' not found", ref)
+	}
+	id, err := img.Identifier()
+	if err != nil {
+		return "", err
+	}
+	digest, err := name.NewDigest(id.String(), name.WeakValidation)
+	if err != nil {
+		return "", err
+	}
+	return digest.DigestStr(), nil
 }
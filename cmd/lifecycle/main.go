@@ -1,18 +1,26 @@
 package main
 
 import (
+	"errors"
+	"fmt"
 	"os"
 	"path/filepath"
 	"strings"
+	"time"
 
 	"github.com/google/go-containerregistry/pkg/authn"
 
 	"github.com/buildpacks/lifecycle"
 	"github.com/buildpacks/lifecycle/cache"
 	"github.com/buildpacks/lifecycle/cmd"
+	"github.com/buildpacks/lifecycle/layers"
 )
 
 func main() {
+	if filepath.Base(os.Args[0]) == lifecycle.ExecLimitsShim {
+		lifecycle.ExecWithLimits(os.Args[1:])
+	}
+
 	platformAPI := cmd.EnvOrDefault(cmd.EnvPlatformAPI, cmd.DefaultPlatformAPI)
 	if err := cmd.VerifyPlatformAPI(platformAPI); err != nil {
 		cmd.Exit(err)
@@ -24,7 +32,7 @@ func main() {
 	case "analyzer":
 		cmd.Run(&analyzeCmd{analyzeArgs: analyzeArgs{platformAPI: platformAPI}}, false)
 	case "restorer":
-		cmd.Run(&restoreCmd{platformAPI: platformAPI}, false)
+		cmd.Run(&restoreCmd{restoreArgs: restoreArgs{platformAPI: platformAPI}}, false)
 	case "builder":
 		cmd.Run(&buildCmd{buildArgs: buildArgs{platformAPI: platformAPI}}, false)
 	case "exporter":
@@ -61,6 +69,10 @@ func subcommand() {
 		cmd.Run(&rebaseCmd{}, true)
 	case "create":
 		cmd.Run(&createCmd{}, true)
+	case "cache":
+		cacheSubcommand()
+	case "restore-layer":
+		cmd.Run(&restoreLayerCmd{}, true)
 	default:
 		cmd.Exit(cmd.FailCode(cmd.CodeInvalidArgs, "unknown phase:", phase))
 	}
@@ -80,13 +92,22 @@ func verifyBuildpackApis(group lifecycle.BuildpackGroup) error {
 	return nil
 }
 
-func initCache(cacheImageTag, cacheDir string, keychain authn.Keychain) (lifecycle.Cache, error) {
+func initCache(cacheURL, cacheImageTag, cacheDir string, keychain authn.Keychain, opts ...cache.RemoteImageCacheOption) (lifecycle.Cache, error) {
 	var (
 		cacheStore lifecycle.Cache
 		err        error
 	)
-	if cacheImageTag != "" {
-		cacheStore, err = cache.NewImageCacheFromName(cacheImageTag, keychain)
+	if cacheURL != "" {
+		if cacheImageTag != "" || cacheDir != "" {
+			return nil, cmd.FailErrCode(errors.New("-cache cannot be combined with -cache-dir or -cache-image"), cmd.CodeInvalidArgs, "parse arguments")
+		}
+		cacheStore, err = cache.NewFromURL(cacheURL)
+		if err != nil {
+			return nil, cmd.FailErr(err, "create cache")
+		}
+	} else if cacheImageTag != "" {
+		opts = append([]cache.RemoteImageCacheOption{cache.WithLogger(cmd.DefaultLogger)}, opts...)
+		cacheStore, err = cache.NewRemoteImageCache(cacheImageTag, keychain, opts...)
 		if err != nil {
 			return nil, cmd.FailErr(err, "create image cache")
 		}
@@ -98,3 +119,69 @@ func initCache(cacheImageTag, cacheDir string, keychain authn.Keychain) (lifecyc
 	}
 	return cacheStore, nil
 }
+
+func parseExecLimits(timeout, maxMemory string, maxOpenFiles int) (lifecycle.ExecLimits, error) {
+	var limits lifecycle.ExecLimits
+	if timeout != "" {
+		d, err := time.ParseDuration(timeout)
+		if err != nil {
+			return lifecycle.ExecLimits{}, cmd.FailErrCode(err, cmd.CodeInvalidArgs, "parse timeout")
+		}
+		limits.Timeout = d
+	}
+	mem, err := cmd.ParseSize(maxMemory)
+	if err != nil {
+		return lifecycle.ExecLimits{}, cmd.FailErrCode(err, cmd.CodeInvalidArgs, "parse max memory")
+	}
+	if maxOpenFiles < 0 {
+		return lifecycle.ExecLimits{}, cmd.FailErrCode(fmt.Errorf("invalid max open files '%d'", maxOpenFiles), cmd.CodeInvalidArgs, "parse max open files")
+	}
+	limits.MaxMemory = uint64(mem)
+	limits.MaxOpenFiles = uint64(maxOpenFiles)
+	return limits, nil
+}
+
+// readIgnoreRules reads the ignore file at ignorePath, or the default ignore file in appDir when ignorePath is empty.
+func readIgnoreRules(appDir, ignorePath string) (*layers.IgnoreRules, error) {
+	if ignorePath == "" {
+		ignorePath = filepath.Join(appDir, cmd.DefaultIgnoreFile)
+	}
+	rules, err := layers.ReadIgnoreFile(ignorePath)
+	if err != nil {
+		return nil, cmd.FailErrCode(err, cmd.CodeInvalidArgs, "read ignore file")
+	}
+	return rules, nil
+}
+
+// filterAppDir copies the app files that do not match the ignore file to a directory in layersDir, for buildpacks to run against.
+func filterAppDir(appDir, layersDir, ignorePath string) (*lifecycle.FilteredAppDir, error) {
+	rules, err := readIgnoreRules(appDir, ignorePath)
+	if err != nil {
+		return nil, err
+	}
+	filtered, err := lifecycle.NewFilteredAppDir(appDir, layersDir, rules)
+	if err != nil {
+		return nil, cmd.FailErr(err, "filter app directory")
+	}
+	cmd.DefaultLogger.Infof("Hiding %d app files matching the ignore file from buildpacks", filtered.Ignored)
+	return filtered, nil
+}
+
+func writeCacheStats(path, phase string, stats lifecycle.CacheStats) error {
+	cmd.DefaultLogger.Infof("Cache stats: %d hit, %d miss, %d stale", stats.Hit, stats.Miss, stats.Stale)
+	if err := lifecycle.WriteCacheStats(path, phase, stats); err != nil {
+		return cmd.FailErr(err, "write cache stats")
+	}
+	return nil
+}
+
+func readCacheInvalidations(path string) (lifecycle.CacheInvalidations, error) {
+	inv, err := lifecycle.ReadCacheInvalidations(path)
+	if err != nil {
+		return lifecycle.CacheInvalidations{}, cmd.FailErrCode(err, cmd.CodeInvalidArgs, "read cache invalidations")
+	}
+	if len(inv.Invalidate) > 0 {
+		cmd.DefaultLogger.Debugf("Treating cached layers as cache misses: %s", strings.Join(inv.Invalidate, ", "))
+	}
+	return inv, nil
+}
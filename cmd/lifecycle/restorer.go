@@ -8,28 +8,44 @@ import (
 
 	"github.com/buildpacks/lifecycle"
 	"github.com/buildpacks/lifecycle/auth"
+	"github.com/buildpacks/lifecycle/cache"
 	"github.com/buildpacks/lifecycle/cmd"
 	"github.com/buildpacks/lifecycle/priv"
 )
 
 type restoreCmd struct {
 	// flags: inputs
-	cacheDir      string
-	cacheImageTag string
-	groupPath     string
-	layersDir     string
-	platformAPI   string
-	uid, gid      int
+	cacheURL          string
+	cacheDir          string
+	cacheImageTag     string
+	groupPath         string
+	invalidationsPath string
+	lazyRestore       bool
+	uid, gid          int
+	restoreArgs
 
 	//set before dropping privileges
 	keychain authn.Keychain
 }
 
+type restoreArgs struct {
+	// inputs needed when run by creator
+	cacheInvalidations lifecycle.CacheInvalidations
+	cacheStatsPath     string
+	layersDir          string
+	lazyCacheURL       string
+	platformAPI        string
+}
+
 func (r *restoreCmd) DefineFlags() {
+	cmd.FlagCache(&r.cacheURL)
 	cmd.FlagCacheDir(&r.cacheDir)
 	cmd.FlagCacheImage(&r.cacheImageTag)
+	cmd.FlagCacheStatsPath(&r.cacheStatsPath)
 	cmd.FlagGroupPath(&r.groupPath)
+	cmd.FlagInvalidationsPath(&r.invalidationsPath)
 	cmd.FlagLayersDir(&r.layersDir)
+	cmd.FlagLazyRestore(&r.lazyRestore)
 	cmd.FlagUID(&r.uid)
 	cmd.FlagGID(&r.gid)
 }
@@ -38,15 +54,25 @@ func (r *restoreCmd) Args(nargs int, args []string) error {
 	if nargs > 0 {
 		return cmd.FailErrCode(errors.New("received unexpected Args"), cmd.CodeInvalidArgs, "parse arguments")
 	}
-	if r.cacheImageTag == "" && r.cacheDir == "" {
+	if r.cacheImageTag == "" && r.cacheDir == "" && r.cacheURL == "" {
 		cmd.DefaultLogger.Warn("Not restoring cached layer data, no cache flag specified.")
 	}
 
+	if r.cacheStatsPath == cmd.PlaceholderCacheStatsPath {
+		r.cacheStatsPath = cmd.DefaultCacheStatsPath(r.platformAPI, r.layersDir)
+	}
+
 	if r.groupPath == cmd.PlaceholderGroupPath {
 		r.groupPath = cmd.DefaultGroupPath(r.platformAPI, r.layersDir)
 	}
 
-	return nil
+	if r.invalidationsPath == cmd.PlaceholderInvalidationsPath {
+		r.invalidationsPath = cmd.DefaultInvalidationsPath(r.platformAPI, r.layersDir)
+	}
+
+	var err error
+	r.lazyCacheURL, err = lazyCacheURL(r.lazyRestore, r.cacheURL, r.cacheImageTag, r.cacheDir)
+	return err
 }
 
 func (r *restoreCmd) Privileges() error {
@@ -73,11 +99,15 @@ func (r *restoreCmd) Exec() error {
 	if err := verifyBuildpackApis(group); err != nil {
 		return err
 	}
-	cacheStore, err := initCache(r.cacheImageTag, r.cacheDir, r.keychain)
+	cacheStore, err := initCache(r.cacheURL, r.cacheImageTag, r.cacheDir, r.keychain)
+	if err != nil {
+		return err
+	}
+	r.cacheInvalidations, err = readCacheInvalidations(r.invalidationsPath)
 	if err != nil {
 		return err
 	}
-	return restore(r.layersDir, group, cacheStore)
+	return r.restore(group, cacheStore)
 }
 
 func (r *restoreCmd) registryImages() []string {
@@ -87,15 +117,78 @@ func (r *restoreCmd) registryImages() []string {
 	return []string{}
 }
 
-func restore(layersDir string, group lifecycle.BuildpackGroup, cacheStore lifecycle.Cache) error {
+func (ra restoreArgs) restore(group lifecycle.BuildpackGroup, cacheStore lifecycle.Cache) error {
 	restorer := &lifecycle.Restorer{
-		LayersDir:  layersDir,
-		Buildpacks: group.Group,
-		Logger:     cmd.DefaultLogger,
+		LayersDir:          ra.layersDir,
+		Buildpacks:         group.Group,
+		CacheInvalidations: ra.cacheInvalidations,
+		LazyCacheURL:       ra.lazyCacheURL,
+		Logger:             cmd.DefaultLogger,
 	}
 
 	if err := restorer.Restore(cacheStore); err != nil {
 		return cmd.FailErrCode(err, cmd.CodeRestoreError, "restore")
 	}
+	return writeCacheStats(ra.cacheStatsPath, "restorer", restorer.CacheStats())
+}
+
+// lazyCacheURL returns the URL recorded in restore markers, or an empty string when layers should be restored eagerly.
+func lazyCacheURL(lazyRestore bool, cacheURL, cacheImageTag, cacheDir string) (string, error) {
+	if !lazyRestore {
+		return "", nil
+	}
+	switch {
+	case cacheURL != "":
+		return cacheURL, nil
+	case cacheDir != "":
+		return cache.FileURL(cacheDir)
+	case cacheImageTag != "":
+		cmd.DefaultLogger.Warn("Ignoring -lazy-restore, not supported with -cache-image")
+	}
+	return "", nil
+}
+
+type restoreLayerCmd struct {
+	layerPaths []string
+}
+
+func (r *restoreLayerCmd) DefineFlags() {}
+
+func (r *restoreLayerCmd) Args(nargs int, args []string) error {
+	if nargs == 0 {
+		return cmd.FailErrCode(errors.New("at least one layer directory argument is required"), cmd.CodeInvalidArgs, "parse arguments")
+	}
+	r.layerPaths = args
+	return nil
+}
+
+func (r *restoreLayerCmd) Privileges() error {
+	return nil
+}
+
+func (r *restoreLayerCmd) Exec() error {
+	caches := map[string]lifecycle.Cache{}
+	for _, path := range r.layerPaths {
+		marker, ok, err := lifecycle.ReadLazyRestoreMarker(path)
+		if err != nil {
+			return cmd.FailErr(err, "read restore marker")
+		}
+		if !ok {
+			cmd.DefaultLogger.Debugf("Layer '%s' is already restored", path)
+			continue
+		}
+		cacheStore, ok := caches[marker.Cache]
+		if !ok {
+			cacheStore, err = cache.NewReadOnlyFromURL(marker.Cache)
+			if err != nil {
+				return cmd.FailErr(err, "create cache")
+			}
+			caches[marker.Cache] = cacheStore
+		}
+		cmd.DefaultLogger.Infof("Restoring data for '%s' from cache", path)
+		if err := lifecycle.RestoreLazyLayer(path, cacheStore); err != nil {
+			return cmd.FailErrCode(err, cmd.CodeRestoreError, "restore layer")
+		}
+	}
 	return nil
 }
@@ -0,0 +1,224 @@
+package lifecycle
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"hash"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/BurntSushi/toml"
+	"github.com/pkg/errors"
+)
+
+// DetectCache stores the results of bin/detect, so that a buildpack is not run again
+// when neither the buildpack, the app files it inspects, nor the platform env have changed.
+// Only passing and failing results are stored, errors are always retried.
+// App files are fingerprinted by path, mode, size and modification time unless HashContents is set.
+type DetectCache struct {
+	Dir          string
+	HashContents bool // HashContents fingerprints app files by their contents
+
+	mu         sync.Mutex
+	appDigests map[string]string   // appDigests memoizes app fingerprints by the detect inputs they were computed from
+	used       map[string]struct{} // used are the keys loaded or stored, which are kept by Prune
+}
+
+// NewDetectCache returns a detect cache that stores results in the detect directory of cacheDir.
+func NewDetectCache(cacheDir string) *DetectCache {
+	return &DetectCache{Dir: filepath.Join(cacheDir, "detect")}
+}
+
+type detectCacheEntry struct {
+	Code   int       `toml:"code"`
+	Output string    `toml:"output"`
+	Plan   DetectRun `toml:"plan"`
+}
+
+// Key returns the key of the detect result of bp, derived from the buildpack ID, version and API,
+// a digest of the app files that the buildpack declares as detect inputs (or of the whole app dir),
+// and the platform env.
+func (d *DetectCache) Key(bp *BuildpackTOML, appDir, platformDir string) (string, error) {
+	appDigest, err := d.appDigest(appDir, bp.Buildpack.DetectInputs)
+	if err != nil {
+		return "", errors.Wrap(err, "fingerprinting app dir")
+	}
+	envDigest, err := dirDigest(filepath.Join(platformDir, "env"), nil, true)
+	if err != nil {
+		return "", errors.Wrap(err, "fingerprinting platform env")
+	}
+	h := sha256.New()
+	fmt.Fprintf(h, "%s\x00%s\x00%s\x00%s\x00%s", bp.Buildpack.ID, bp.Buildpack.Version, bp.API, appDigest, envDigest)
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// Load returns the stored detect result for key.
+func (d *DetectCache) Load(key string) (DetectRun, bool) {
+	d.use(key)
+	var entry detectCacheEntry
+	if _, err := toml.DecodeFile(d.path(key), &entry); err != nil {
+		return DetectRun{}, false
+	}
+	run := entry.Plan
+	run.Code = entry.Code
+	run.Output = []byte(entry.Output)
+	return run, true
+}
+
+// Store saves run as the detect result for key.
+func (d *DetectCache) Store(key string, run DetectRun) error {
+	if run.Err != nil || (run.Code != CodeDetectPass && run.Code != CodeDetectFail) {
+		return nil
+	}
+	d.use(key)
+	if err := os.MkdirAll(d.Dir, 0777); err != nil {
+		return err
+	}
+	return WriteTOML(d.path(key), detectCacheEntry{
+		Code:   run.Code,
+		Output: string(run.Output),
+		Plan:   DetectRun{planSections: run.planSections, Or: run.Or},
+	})
+}
+
+// Prune removes the stored results that were not loaded or stored since the cache was created.
+// Results for app files, buildpacks or platform env that are no longer used do not accumulate.
+func (d *DetectCache) Prune() error {
+	files, err := ioutil.ReadDir(d.Dir)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return err
+	}
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	for _, fi := range files {
+		key := strings.TrimSuffix(fi.Name(), ".toml")
+		if _, ok := d.used[key]; ok {
+			continue
+		}
+		if err := os.RemoveAll(filepath.Join(d.Dir, fi.Name())); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (d *DetectCache) use(key string) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if d.used == nil {
+		d.used = map[string]struct{}{}
+	}
+	d.used[key] = struct{}{}
+}
+
+func (d *DetectCache) path(key string) string {
+	return filepath.Join(d.Dir, key+".toml")
+}
+
+func (d *DetectCache) appDigest(appDir string, patterns []string) (string, error) {
+	memoKey := fmt.Sprintf("%s\x00%q", appDir, patterns)
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if digest, ok := d.appDigests[memoKey]; ok {
+		return digest, nil
+	}
+	digest, err := dirDigest(appDir, patterns, d.HashContents)
+	if err != nil {
+		return "", err
+	}
+	if d.appDigests == nil {
+		d.appDigests = map[string]string{}
+	}
+	d.appDigests[memoKey] = digest
+	return digest, nil
+}
+
+// dirDigest hashes the relative paths and modes of the files in dir matching any of patterns,
+// or of all files when no patterns are given, and either their contents or their sizes and modification times.
+// A missing dir has an empty digest.
+func dirDigest(dir string, patterns []string, contents bool) (string, error) {
+	var paths []string
+	err := filepath.Walk(dir, func(path string, fi os.FileInfo, err error) error {
+		if err != nil {
+			if os.IsNotExist(err) && path == dir {
+				return nil
+			}
+			return err
+		}
+		if fi.IsDir() {
+			return nil
+		}
+		rel, err := filepath.Rel(dir, path)
+		if err != nil {
+			return err
+		}
+		if matchesAny(rel, patterns) {
+			paths = append(paths, rel)
+		}
+		return nil
+	})
+	if err != nil {
+		return "", err
+	}
+	sort.Strings(paths)
+
+	h := sha256.New()
+	for _, rel := range paths {
+		if err := hashFile(h, dir, rel, contents); err != nil {
+			return "", err
+		}
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+func matchesAny(rel string, patterns []string) bool {
+	if len(patterns) == 0 {
+		return true
+	}
+	for _, pattern := range patterns {
+		if ok, _ := filepath.Match(pattern, rel); ok {
+			return true
+		}
+		if ok, _ := filepath.Match(pattern, filepath.Base(rel)); ok {
+			return true
+		}
+	}
+	return false
+}
+
+func hashFile(h hash.Hash, dir, rel string, contents bool) error {
+	path := filepath.Join(dir, rel)
+	fi, err := os.Lstat(path)
+	if err != nil {
+		return err
+	}
+	fmt.Fprintf(h, "%s\x00%o\x00", rel, fi.Mode())
+	if !contents {
+		_, err = fmt.Fprintf(h, "%d\x00%d\x00", fi.Size(), fi.ModTime().UnixNano())
+		return err
+	}
+	if fi.Mode()&os.ModeSymlink != 0 {
+		target, err := os.Readlink(path)
+		if err != nil {
+			return err
+		}
+		_, err = io.WriteString(h, target)
+		return err
+	}
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	_, err = io.Copy(h, f)
+	return err
+}
@@ -0,0 +1,201 @@
+package lifecycle_test
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/apex/log"
+	"github.com/apex/log/handlers/memory"
+	"github.com/sclevine/spec"
+	"github.com/sclevine/spec/report"
+
+	"github.com/buildpacks/lifecycle"
+	h "github.com/buildpacks/lifecycle/testhelpers"
+)
+
+func TestDetectCache(t *testing.T) {
+	spec.Run(t, "DetectCache", testDetectCache, spec.Report(report.Terminal{}))
+}
+
+func testDetectCache(t *testing.T, when spec.G, it spec.S) {
+	var (
+		subject     *lifecycle.DetectCache
+		bpTOML      *lifecycle.BuildpackTOML
+		tmpDir      string
+		appDir      string
+		platformDir string
+	)
+
+	it.Before(func() {
+		var err error
+		tmpDir, err = ioutil.TempDir("", "detect-cache")
+		h.AssertNil(t, err)
+		appDir = filepath.Join(tmpDir, "app")
+		platformDir = filepath.Join(tmpDir, "platform")
+		h.Mkdir(t, appDir, filepath.Join(platformDir, "env"))
+		h.Mkfile(t, "some-source", filepath.Join(appDir, "main.go"))
+		h.Mkfile(t, "some-readme", filepath.Join(appDir, "README.md"))
+
+		subject = lifecycle.NewDetectCache(filepath.Join(tmpDir, "cache"))
+		bpTOML, err = lifecycle.GroupBuildpack{ID: "A", Version: "v1"}.Lookup(filepath.Join("testdata", "by-id"))
+		h.AssertNil(t, err)
+	})
+
+	it.After(func() {
+		os.RemoveAll(tmpDir)
+	})
+
+	key := func() string {
+		t.Helper()
+		key, err := (&lifecycle.DetectCache{Dir: subject.Dir, HashContents: subject.HashContents}).Key(bpTOML, appDir, platformDir)
+		h.AssertNil(t, err)
+		return key
+	}
+
+	assertChanged := func(before string) {
+		t.Helper()
+		if key() == before {
+			t.Fatalf("Expected key to change from %s", before)
+		}
+	}
+
+	when("#Key", func() {
+		it("is stable for unchanged inputs", func() {
+			h.AssertEq(t, key(), key())
+		})
+
+		it("changes when the app changes", func() {
+			before := key()
+			h.Mkfile(t, "other-readme", filepath.Join(appDir, "README.md"))
+			assertChanged(before)
+		})
+
+		it("changes when an app file is modified without changing its size", func() {
+			before := key()
+			h.AssertNil(t, os.Chtimes(filepath.Join(appDir, "README.md"), time.Unix(0, 0), time.Unix(0, 0)))
+			assertChanged(before)
+		})
+
+		when("app file contents are hashed", func() {
+			it.Before(func() {
+				subject.HashContents = true
+			})
+
+			it("ignores modification times", func() {
+				before := key()
+				h.AssertNil(t, os.Chtimes(filepath.Join(appDir, "README.md"), time.Unix(0, 0), time.Unix(0, 0)))
+				h.AssertEq(t, key(), before)
+			})
+
+			it("changes when the contents change without changing the size", func() {
+				before := key()
+				h.AssertNil(t, ioutil.WriteFile(filepath.Join(appDir, "README.md"), []byte("same-length"), 0600))
+				h.AssertNil(t, os.Chtimes(filepath.Join(appDir, "README.md"), time.Unix(0, 0), time.Unix(0, 0)))
+				assertChanged(before)
+			})
+		})
+
+		it("changes when the platform env changes", func() {
+			before := key()
+			h.Mkfile(t, "some-value", filepath.Join(platformDir, "env", "SOME_VAR"))
+			assertChanged(before)
+		})
+
+		it("changes when the buildpack version changes", func() {
+			before := key()
+			bpTOML.Buildpack.Version = "v2"
+			assertChanged(before)
+		})
+
+		when("the buildpack declares detect inputs", func() {
+			it.Before(func() {
+				bpTOML.Buildpack.DetectInputs = []string{"*.go"}
+			})
+
+			it("ignores changes to other files", func() {
+				before := key()
+				h.Mkfile(t, "other-readme", filepath.Join(appDir, "README.md"))
+				h.AssertEq(t, key(), before)
+			})
+
+			it("changes when an input changes", func() {
+				before := key()
+				h.Mkfile(t, "other-source", filepath.Join(appDir, "main.go"))
+				assertChanged(before)
+			})
+		})
+	})
+
+	when("#Store", func() {
+		it("stores passing and failing results", func() {
+			h.AssertNil(t, subject.Store("some-key", lifecycle.DetectRun{Code: lifecycle.CodeDetectFail, Output: []byte("some-output")}))
+
+			run, ok := subject.Load("some-key")
+			h.AssertEq(t, ok, true)
+			h.AssertEq(t, run.Code, lifecycle.CodeDetectFail)
+			h.AssertEq(t, string(run.Output), "some-output")
+		})
+
+		it("does not store errors", func() {
+			h.AssertNil(t, subject.Store("some-key", lifecycle.DetectRun{Code: 1}))
+
+			_, ok := subject.Load("some-key")
+			h.AssertEq(t, ok, false)
+		})
+	})
+
+	when("#Prune", func() {
+		it("removes the results that were not loaded or stored", func() {
+			h.AssertNil(t, subject.Store("old-key", lifecycle.DetectRun{Code: lifecycle.CodeDetectPass}))
+			h.AssertNil(t, subject.Store("reused-key", lifecycle.DetectRun{Code: lifecycle.CodeDetectPass}))
+
+			next := lifecycle.NewDetectCache(filepath.Join(tmpDir, "cache"))
+			_, ok := next.Load("reused-key")
+			h.AssertEq(t, ok, true)
+			h.AssertNil(t, next.Store("new-key", lifecycle.DetectRun{Code: lifecycle.CodeDetectFail}))
+			h.AssertNil(t, next.Prune())
+
+			h.AssertPathDoesNotExist(t, filepath.Join(next.Dir, "old-key.toml"))
+			_, ok = next.Load("reused-key")
+			h.AssertEq(t, ok, true)
+			_, ok = next.Load("new-key")
+			h.AssertEq(t, ok, true)
+		})
+
+		it("succeeds when nothing has been stored", func() {
+			h.AssertNil(t, subject.Prune())
+		})
+	})
+
+	when("used by the detector", func() {
+		it("uses cached results instead of running bin/detect", func() {
+			var stored lifecycle.DetectRun
+			stored.Provides = []lifecycle.Provide{{Name: "some-dep"}}
+			stored.Requires = []lifecycle.Require{{Name: "some-dep", Metadata: map[string]interface{}{"version": "1.0"}}}
+			h.AssertNil(t, subject.Store(key(), stored))
+
+			logHandler := memory.New()
+			group, plan, err := lifecycle.BuildpackOrder{
+				{Group: []lifecycle.GroupBuildpack{{ID: "A", Version: "v1"}}},
+			}.Detect(&lifecycle.DetectConfig{
+				AppDir:        appDir,
+				PlatformDir:   platformDir,
+				BuildpacksDir: filepath.Join("testdata", "by-id"),
+				Cache:         subject,
+				Logger:        &log.Logger{Handler: logHandler},
+			})
+			h.AssertNil(t, err)
+
+			h.AssertEq(t, len(group.Group), 1)
+			h.AssertEq(t, plan.Entries, []lifecycle.BuildPlanEntry{{
+				Providers: []lifecycle.GroupBuildpack{{ID: "A", Version: "v1"}},
+				Requires:  []lifecycle.Require{{Name: "some-dep", Metadata: map[string]interface{}{"version": "1.0"}}},
+			}})
+			h.AssertPathDoesNotExist(t, filepath.Join(appDir, "detect-env-type-A-v1"))
+			assertLogEntry(t, logHandler, "Using cached detect result for A@v1")
+		})
+	})
+}
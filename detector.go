@@ -7,10 +7,12 @@ import (
 	"os"
 	"os/exec"
 	"path/filepath"
+	"strings"
 	"sync"
 	"syscall"
 
 	"github.com/BurntSushi/toml"
+	"github.com/Masterminds/semver/v3"
 	"github.com/pkg/errors"
 
 	"github.com/buildpacks/lifecycle/api"
@@ -85,8 +87,34 @@ func (r *Require) hasTopLevelVersions() bool {
 	return r.Version != ""
 }
 
+func (r *Require) version() string {
+	if r.Version != "" {
+		return r.Version
+	}
+	if version, ok := r.Metadata["version"]; ok {
+		return fmt.Sprintf("%v", version)
+	}
+	return ""
+}
+
 type Provide struct {
 	Name string `toml:"name"`
+	// Version, when set, is the version the buildpack provides. Requires with a semver constraint must match it.
+	Version string `toml:"version,omitempty"`
+}
+
+// versionMatches reports whether version satisfies constraint.
+// Versions and constraints that are not semver are opaque and always match.
+func versionMatches(constraint, version string) bool {
+	c, err := semver.NewConstraint(constraint)
+	if err != nil {
+		return true
+	}
+	v, err := semver.NewVersion(version)
+	if err != nil {
+		return true
+	}
+	return c.Check(v)
 }
 
 type DetectConfig struct {
@@ -95,8 +123,12 @@ type DetectConfig struct {
 	AppDir        string
 	PlatformDir   string
 	BuildpacksDir string
+	Cache         *DetectCache // Cache stores detect results when set
+	Limits        ExecLimits
+	Concurrency   int // Concurrency is the maximum number of concurrent bin/detect processes, unlimited when 0
 	Logger        Logger
 	runs          *sync.Map
+	slots         chan struct{}
 }
 
 func (c *DetectConfig) process(done []GroupBuildpack) ([]GroupBuildpack, []BuildPlanEntry, error) {
@@ -148,6 +180,10 @@ func (c *DetectConfig) process(done []GroupBuildpack) ([]GroupBuildpack, []Build
 			c.Logger.Infof("err:  %s", bp)
 			buildpackErr = true
 			detected = detected && bp.Optional
+		case CodeDetectTimeout:
+			c.Logger.Infof("timeout: %s", bp)
+			buildpackErr = true
+			detected = detected && bp.Optional
 		default:
 			c.Logger.Infof("err:  %s (%d)", bp, run.Code)
 			buildpackErr = true
@@ -233,6 +269,34 @@ func (c *DetectConfig) runTrial(i int, trial detectTrial) (depMap, detectTrial,
 		}); err != nil {
 			return nil, nil, err
 		}
+
+		if err := deps.eachIncompatibleRequire(func(name string, bp GroupBuildpack, constraint string, providers []GroupBuildpack, versions map[GroupBuildpack]string) error {
+			retry = true
+			var provided []string
+			for _, provider := range providers {
+				provided = append(provided, fmt.Sprintf("%s provides %s", provider, versions[provider]))
+			}
+			if bp.Optional {
+				c.Logger.Debugf("skip: %s requires %s %s, %s", bp, name, constraint, strings.Join(provided, ", "))
+				trial = trial.remove(bp)
+				return nil
+			}
+			var skipped bool
+			for _, provider := range providers {
+				if provider.Optional {
+					c.Logger.Debugf("skip: %s provides %s %s, %s requires %s", provider, name, versions[provider], bp, constraint)
+					trial = trial.remove(provider)
+					skipped = true
+				}
+			}
+			if skipped {
+				return nil
+			}
+			c.Logger.Infof("fail: %s requires %s %s, %s", bp, name, constraint, strings.Join(provided, ", "))
+			return errFailedDetection
+		}); err != nil {
+			return nil, nil, err
+		}
 	}
 
 	if len(trial) == 0 {
@@ -242,6 +306,39 @@ func (c *DetectConfig) runTrial(i int, trial detectTrial) (depMap, detectTrial,
 	return deps, trial, nil
 }
 
+// run stores the detect result of bp under key, unless it is already known.
+// At most Concurrency detect runs are in progress at once.
+func (c *DetectConfig) run(key string, bp *BuildpackTOML) {
+	if c.slots != nil {
+		c.slots <- struct{}{}
+		defer func() { <-c.slots }()
+	}
+	if _, ok := c.runs.Load(key); !ok {
+		c.runs.Store(key, c.detect(bp))
+	}
+}
+
+// detect runs bin/detect for bp, or uses its cached result.
+func (c *DetectConfig) detect(bp *BuildpackTOML) DetectRun {
+	if c.Cache == nil {
+		return bp.Detect(c)
+	}
+	key, err := c.Cache.Key(bp, c.AppDir, c.PlatformDir)
+	if err != nil {
+		c.Logger.Warnf("Not caching detect result for %s: %s", bp.Buildpack.ID, err)
+		return bp.Detect(c)
+	}
+	if run, ok := c.Cache.Load(key); ok {
+		c.Logger.Infof("Using cached detect result for %s@%s", bp.Buildpack.ID, bp.Buildpack.Version)
+		return run
+	}
+	run := bp.Detect(c)
+	if err := c.Cache.Store(key, run); err != nil {
+		c.Logger.Warnf("Failed to cache detect result for %s: %s", bp.Buildpack.ID, err)
+	}
+	return run
+}
+
 func (b *BuildpackTOML) Detect(c *DetectConfig) DetectRun {
 	appDir, err := filepath.Abs(c.AppDir)
 	if err != nil {
@@ -277,7 +374,10 @@ func (b *BuildpackTOML) Detect(c *DetectConfig) DetectRun {
 	}
 	cmd.Env = append(cmd.Env, EnvBuildpackDir+"="+b.Dir)
 
-	if err := cmd.Run(); err != nil {
+	if err := c.Limits.run(cmd, b.Buildpack.ID+"@"+b.Buildpack.Version, "detect"); err != nil {
+		if err, ok := err.(*TimeoutError); ok {
+			return DetectRun{Code: CodeDetectTimeout, Err: err, Output: out.Bytes()}
+		}
 		if err, ok := err.(*exec.ExitError); ok {
 			if status, ok := err.Sys().(syscall.WaitStatus); ok {
 				return DetectRun{Code: status.ExitStatus(), Output: out.Bytes()}
@@ -318,6 +418,9 @@ func (bg BuildpackGroup) Detect(c *DetectConfig) (BuildpackGroup, BuildPlan, err
 	if c.runs == nil {
 		c.runs = &sync.Map{}
 	}
+	if c.slots == nil && c.Concurrency > 0 {
+		c.slots = make(chan struct{}, c.Concurrency)
+	}
 	bps, entries, err := bg.detect(nil, &sync.WaitGroup{}, c)
 	if err == errBuildpack {
 		err = NewLifecycleError(err, ErrTypeBuildpack)
@@ -352,9 +455,7 @@ func (bg BuildpackGroup) detect(done []GroupBuildpack, wg *sync.WaitGroup, c *De
 		done = append(done, bp)
 		wg.Add(1)
 		go func() {
-			if _, ok := c.runs.Load(key); !ok {
-				c.runs.Store(key, info.Detect(c))
-			}
+			c.run(key, info)
 			wg.Done()
 		}()
 	}
@@ -377,7 +478,15 @@ func (bo BuildpackOrder) Detect(c *DetectConfig) (BuildpackGroup, BuildPlan, err
 	if c.runs == nil {
 		c.runs = &sync.Map{}
 	}
+	if c.slots == nil && c.Concurrency > 0 {
+		c.slots = make(chan struct{}, c.Concurrency)
+	}
 	bps, entries, err := bo.detect(nil, nil, false, &sync.WaitGroup{}, c)
+	if c.Cache != nil {
+		if err := c.Cache.Prune(); err != nil {
+			c.Logger.Warnf("Failed to prune detect cache: %s", err)
+		}
+	}
 	if err == errBuildpack {
 		err = NewLifecycleError(err, ErrTypeBuildpack)
 	} else if err == errFailedDetection {
@@ -554,6 +663,8 @@ type depEntry struct {
 	BuildPlanEntry
 	earlyRequires []GroupBuildpack
 	extraProvides []GroupBuildpack
+	requirers     []GroupBuildpack // requirers[i] made Requires[i]
+	versions      map[GroupBuildpack]string
 }
 
 type depMap map[string]depEntry
@@ -574,6 +685,12 @@ func newDepMap(trial detectTrial) depMap {
 func (m depMap) provide(bp GroupBuildpack, provide Provide) {
 	entry := m[provide.Name]
 	entry.extraProvides = append(entry.extraProvides, bp)
+	if provide.Version != "" {
+		if entry.versions == nil {
+			entry.versions = map[GroupBuildpack]string{}
+		}
+		entry.versions[bp] = provide.Version
+	}
 	m[provide.Name] = entry
 }
 
@@ -586,6 +703,7 @@ func (m depMap) require(bp GroupBuildpack, require Require) {
 		entry.earlyRequires = append(entry.earlyRequires, bp)
 	} else {
 		entry.Requires = append(entry.Requires, require)
+		entry.requirers = append(entry.requirers, bp)
 	}
 	m[require.Name] = entry
 }
@@ -615,3 +733,32 @@ func (m depMap) eachUnmetRequire(f func(name string, bp GroupBuildpack) error) e
 	}
 	return nil
 }
+
+// eachIncompatibleRequire calls f for each require with a version constraint that none of the providers of its entry
+// can satisfy, with the providers that declare a version. Providers that do not declare a version satisfy any constraint.
+func (m depMap) eachIncompatibleRequire(f func(name string, bp GroupBuildpack, constraint string, providers []GroupBuildpack, versions map[GroupBuildpack]string) error) error {
+	for name, entry := range m {
+		for i, require := range entry.Requires {
+			constraint := require.version()
+			if constraint == "" {
+				continue
+			}
+			var mismatched []GroupBuildpack
+			for _, provider := range entry.Providers {
+				version, ok := entry.versions[provider]
+				if !ok || versionMatches(constraint, version) {
+					mismatched = nil
+					break
+				}
+				mismatched = append(mismatched, provider)
+			}
+			if len(mismatched) == 0 {
+				continue
+			}
+			if err := f(name, entry.requirers[i], constraint, mismatched, entry.versions); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
@@ -5,6 +5,7 @@ import (
 	"os"
 	"path/filepath"
 	"reflect"
+	"runtime"
 	"strings"
 	"testing"
 
@@ -765,6 +766,144 @@ func testDetector(t *testing.T, when spec.G, it spec.S) {
 				})
 			})
 		})
+
+		when("concurrency is limited", func() {
+			var runLog string
+
+			mkbuildpack := func(id, status string) {
+				t.Helper()
+				dir := filepath.Join(config.BuildpacksDir, id, "v1")
+				h.Mkdir(t, filepath.Join(dir, "bin"))
+				h.Mkfile(t, "api = \"0.3\"\n[buildpack]\nid = \""+id+"\"\nversion = \"v1\"\n", filepath.Join(dir, "buildpack.toml"))
+				script := "#!/usr/bin/env bash\n" +
+					"echo start " + id + " >> " + runLog + "\n" +
+					"sleep 0.1\n" +
+					"echo end " + id + " >> " + runLog + "\n" +
+					"exit " + status + "\n"
+				if err := ioutil.WriteFile(filepath.Join(dir, "bin", "detect"), []byte(script), 0755); err != nil {
+					t.Fatalf("Error: %s\n", err)
+				}
+			}
+
+			it.Before(func() {
+				if runtime.GOOS == "windows" {
+					t.Skip("detect scripts are bash scripts")
+				}
+				runLog = filepath.Join(tmpDir, "run.log")
+				config.BuildpacksDir = filepath.Join(tmpDir, "buildpacks")
+				config.Concurrency = 1
+				mkbuildpack("A", "0")
+				mkbuildpack("B", "100")
+				mkbuildpack("C", "0")
+				mkbuildpack("D", "0")
+			})
+
+			it("should run at most that many detect processes at once and detect each buildpack once", func() {
+				group, _, err := lifecycle.BuildpackOrder{
+					{Group: []lifecycle.GroupBuildpack{{ID: "A", Version: "v1"}, {ID: "B", Version: "v1"}}},
+					{Group: []lifecycle.GroupBuildpack{{ID: "A", Version: "v1"}, {ID: "C", Version: "v1"}, {ID: "D", Version: "v1"}}},
+				}.Detect(config)
+				if err != nil {
+					t.Fatalf("Unexpected error:\n%s\n", err)
+				}
+				h.AssertEq(t, len(group.Group), 3)
+
+				lines := strings.Split(strings.TrimSpace(h.Rdfile(t, runLog)), "\n")
+				h.AssertEq(t, len(lines), 8)
+				for i := 0; i < len(lines); i += 2 {
+					id := strings.TrimPrefix(lines[i], "start ")
+					h.AssertEq(t, lines[i+1], "end "+id)
+				}
+			})
+		})
+
+		when("provides declare a version", func() {
+			mkplanbuildpack := func(id, plan string) {
+				t.Helper()
+				dir := filepath.Join(config.BuildpacksDir, id, "v1")
+				h.Mkdir(t, filepath.Join(dir, "bin"))
+				h.Mkfile(t, "api = \"0.3\"\n[buildpack]\nid = \""+id+"\"\nversion = \"v1\"\n", filepath.Join(dir, "buildpack.toml"))
+				script := "#!/usr/bin/env bash\n" +
+					"cat > \"$2\" <<'EOF'\n" + plan + "\nEOF\n"
+				if err := ioutil.WriteFile(filepath.Join(dir, "bin", "detect"), []byte(script), 0755); err != nil {
+					t.Fatalf("Error: %s\n", err)
+				}
+			}
+
+			it.Before(func() {
+				if runtime.GOOS == "windows" {
+					t.Skip("detect scripts are bash scripts")
+				}
+				config.BuildpacksDir = filepath.Join(tmpDir, "buildpacks")
+				mkplanbuildpack("node", "[[provides]]\nname = \"node\"\nversion = \"14.17.0\"")
+				mkplanbuildpack("node12", "[[provides]]\nname = \"node\"\nversion = \"12.22.0\"")
+				mkplanbuildpack("npm", "[[requires]]\nname = \"node\"\n[requires.metadata]\nversion = \"^14\"")
+				mkplanbuildpack("legacy", "[[requires]]\nname = \"node\"\n[requires.metadata]\nversion = \"^12\"")
+				mkplanbuildpack("opaque", "[[requires]]\nname = \"node\"\n[requires.metadata]\nversion = \"lts\"")
+			})
+
+			it("should pass when the requires match the provided version", func() {
+				group, plan, err := lifecycle.BuildpackGroup{
+					Group: []lifecycle.GroupBuildpack{{ID: "node", Version: "v1"}, {ID: "npm", Version: "v1"}, {ID: "opaque", Version: "v1"}},
+				}.Detect(config)
+				if err != nil {
+					t.Fatalf("Unexpected error:\n%s\n", err)
+				}
+				h.AssertEq(t, len(group.Group), 3)
+				h.AssertEq(t, len(plan.Entries), 1)
+				h.AssertEq(t, len(plan.Entries[0].Requires), 2)
+			})
+
+			it("should fail when a require does not match the provided version", func() {
+				_, _, err := lifecycle.BuildpackGroup{
+					Group: []lifecycle.GroupBuildpack{{ID: "node", Version: "v1"}, {ID: "npm", Version: "v1"}, {ID: "legacy", Version: "v1"}},
+				}.Detect(config)
+				if err, ok := err.(*lifecycle.Error); !ok || err.Type != lifecycle.ErrTypeFailedDetection {
+					t.Fatalf("Unexpected error:\n%s\n", err)
+				}
+				if s := allLogs(logHandler); !strings.Contains(s, "fail: legacy@v1 requires node ^12, node@v1 provides 14.17.0\n") {
+					t.Fatalf("Unexpected log:\n%s\n", s)
+				}
+			})
+
+			it("should pass when any of the providers matches the required version", func() {
+				group, plan, err := lifecycle.BuildpackGroup{
+					Group: []lifecycle.GroupBuildpack{{ID: "node", Version: "v1"}, {ID: "node12", Version: "v1"}, {ID: "npm", Version: "v1"}, {ID: "legacy", Version: "v1"}},
+				}.Detect(config)
+				if err != nil {
+					t.Fatalf("Unexpected error:\n%s\n", err)
+				}
+				h.AssertEq(t, len(group.Group), 4)
+				h.AssertEq(t, len(plan.Entries), 1)
+				h.AssertEq(t, len(plan.Entries[0].Providers), 2)
+			})
+
+			it("should skip optional providers whose version does not match before failing", func() {
+				_, _, err := lifecycle.BuildpackGroup{
+					Group: []lifecycle.GroupBuildpack{{ID: "node", Version: "v1", Optional: true}, {ID: "legacy", Version: "v1"}},
+				}.Detect(config)
+				if err, ok := err.(*lifecycle.Error); !ok || err.Type != lifecycle.ErrTypeFailedDetection {
+					t.Fatalf("Unexpected error:\n%s\n", err)
+				}
+				if s := allLogs(logHandler); !strings.Contains(s, "skip: node@v1 provides node 14.17.0, legacy@v1 requires ^12\n") ||
+					!strings.Contains(s, "fail: legacy@v1 requires node\n") {
+					t.Fatalf("Unexpected log:\n%s\n", s)
+				}
+			})
+
+			it("should skip an optional buildpack whose require does not match the provided version", func() {
+				group, _, err := lifecycle.BuildpackGroup{
+					Group: []lifecycle.GroupBuildpack{{ID: "node", Version: "v1"}, {ID: "npm", Version: "v1"}, {ID: "legacy", Version: "v1", Optional: true}},
+				}.Detect(config)
+				if err != nil {
+					t.Fatalf("Unexpected error:\n%s\n", err)
+				}
+				h.AssertEq(t, group.Group, []lifecycle.GroupBuildpack{
+					{ID: "node", Version: "v1", API: "0.3"},
+					{ID: "npm", Version: "v1", API: "0.3"},
+				})
+			})
+		})
 	})
 }
 
@@ -3,6 +3,7 @@ package lifecycle
 type ErrorType string
 
 const ErrTypeBuildpack ErrorType = "ERR_BUILDPACK"
+const ErrTypeBuildpackTimeout ErrorType = "ERR_BUILDPACK_TIMEOUT"
 const ErrTypeFailedDetection ErrorType = "ERR_FAILED_DETECTION"
 
 type Error struct {
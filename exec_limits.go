@@ -0,0 +1,85 @@
+package lifecycle
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"os/signal"
+	"strings"
+	"time"
+)
+
+// CodeDetectTimeout is the code of a detect run that was killed because it exceeded its timeout.
+const CodeDetectTimeout = -2
+
+// ExecLimitsShim is the name the current executable is run with to apply memory and open file limits to itself
+// before executing a buildpack executable, as exec.Cmd cannot run code between fork and exec. Executables that
+// run buildpacks with these limits must call ExecWithLimits when started as ExecLimitsShim.
+const ExecLimitsShim = "exec-limits"
+
+// ExecLimits bound the buildpack executables run by a phase. Zero values are unlimited.
+type ExecLimits struct {
+	Timeout time.Duration
+	// MaxMemory is the maximum address space of each process in bytes, only enforced on Linux.
+	MaxMemory uint64
+	// MaxOpenFiles is the maximum number of open files of each process, only enforced on Linux.
+	MaxOpenFiles uint64
+}
+
+// TimeoutError is returned when a buildpack executable is killed for exceeding its timeout.
+type TimeoutError struct {
+	Buildpack string
+	Phase     string
+	Timeout   time.Duration
+}
+
+func (e *TimeoutError) Error() string {
+	return fmt.Sprintf("buildpack %s timed out after %s during %s", e.Buildpack, e.Timeout, e.Phase)
+}
+
+// ExecWithLimits applies the limits to the current process and executes the buildpack executable. args are
+// the arguments the executable was started with as ExecLimitsShim: the limits, the path of the buildpack
+// executable and its arguments. It does not return.
+func ExecWithLimits(args []string) {
+	err := errors.New("missing executable")
+	if len(args) >= 3 {
+		err = execWithRlimits(args[0], args[1:])
+	}
+	fmt.Fprintf(os.Stderr, "ERROR: failed to run '%s' with limits: %s\n", strings.Join(args, " "), err)
+	os.Exit(1)
+}
+
+// run runs cmd within the limits. When the timeout expires, the process group of cmd is killed
+// and a *TimeoutError is returned.
+//
+// With a timeout, cmd runs in its own process group so that the processes it starts can be killed with it.
+// Signals sent to the process group of the lifecycle, such as on Ctrl-C, then no longer reach cmd, so interrupt
+// and termination signals are forwarded to the group of cmd while it runs.
+func (l ExecLimits) run(cmd *exec.Cmd, buildpack, phase string) error {
+	var signals chan os.Signal
+	if l.Timeout > 0 {
+		setProcessGroup(cmd)
+		signals = make(chan os.Signal, 1)
+		notifySignals(signals)
+		defer func() {
+			signal.Stop(signals)
+			close(signals)
+		}()
+	}
+	setRlimits(cmd, l)
+	if err := cmd.Start(); err != nil {
+		return err
+	}
+	if l.Timeout <= 0 {
+		return cmd.Wait()
+	}
+	go forwardSignals(signals, cmd)
+
+	timer := time.AfterFunc(l.Timeout, func() { killProcessGroup(cmd) })
+	err := cmd.Wait()
+	if !timer.Stop() {
+		return &TimeoutError{Buildpack: buildpack, Phase: phase, Timeout: l.Timeout}
+	}
+	return err
+}
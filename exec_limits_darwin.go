@@ -0,0 +1,12 @@
+package lifecycle
+
+import (
+	"errors"
+	"os/exec"
+)
+
+func setRlimits(cmd *exec.Cmd, l ExecLimits) {}
+
+func execWithRlimits(string, []string) error {
+	return errors.New("resource limits are not supported on darwin")
+}
@@ -0,0 +1,42 @@
+// +build linux
+
+package lifecycle
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"syscall"
+
+	"github.com/pkg/errors"
+)
+
+// setRlimits makes cmd apply the memory and open file limits to itself before it executes,
+// so that the buildpack executable and the processes it starts never run without them.
+func setRlimits(cmd *exec.Cmd, l ExecLimits) {
+	if l.MaxMemory == 0 && l.MaxOpenFiles == 0 {
+		return
+	}
+	limits := fmt.Sprintf("%d:%d", l.MaxMemory, l.MaxOpenFiles)
+	cmd.Args = append([]string{ExecLimitsShim, limits, cmd.Path}, cmd.Args...)
+	cmd.Path = "/proc/self/exe"
+}
+
+// execWithRlimits applies the limits and executes args, which are the path of the executable followed by its arguments.
+func execWithRlimits(limits string, args []string) error {
+	var maxMemory, maxOpenFiles uint64
+	if _, err := fmt.Sscanf(limits, "%d:%d", &maxMemory, &maxOpenFiles); err != nil {
+		return errors.Wrapf(err, "parsing limits '%s'", limits)
+	}
+	if maxMemory > 0 {
+		if err := syscall.Setrlimit(syscall.RLIMIT_AS, &syscall.Rlimit{Cur: maxMemory, Max: maxMemory}); err != nil {
+			return errors.Wrap(err, "setting memory limit")
+		}
+	}
+	if maxOpenFiles > 0 {
+		if err := syscall.Setrlimit(syscall.RLIMIT_NOFILE, &syscall.Rlimit{Cur: maxOpenFiles, Max: maxOpenFiles}); err != nil {
+			return errors.Wrap(err, "setting open files limit")
+		}
+	}
+	return syscall.Exec(args[0], args[1:], os.Environ())
+}
@@ -0,0 +1,176 @@
+package lifecycle_test
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/sclevine/spec"
+	"github.com/sclevine/spec/report"
+
+	"github.com/buildpacks/lifecycle"
+	"github.com/buildpacks/lifecycle/api"
+	"github.com/buildpacks/lifecycle/env"
+	h "github.com/buildpacks/lifecycle/testhelpers"
+)
+
+// TestMain applies the limits of buildpack executables run by the tests, like cmd/lifecycle.
+func TestMain(m *testing.M) {
+	if filepath.Base(os.Args[0]) == lifecycle.ExecLimitsShim {
+		lifecycle.ExecWithLimits(os.Args[1:])
+	}
+	os.Exit(m.Run())
+}
+
+func TestExecLimits(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("buildpack executables are shell scripts")
+	}
+	spec.Run(t, "ExecLimits", testExecLimits, spec.Report(report.Terminal{}))
+}
+
+func testExecLimits(t *testing.T, when spec.G, it spec.S) {
+	var (
+		bpTOML      *lifecycle.BuildpackTOML
+		tmpDir      string
+		appDir      string
+		platformDir string
+	)
+
+	it.Before(func() {
+		var err error
+		tmpDir, err = ioutil.TempDir("", "exec-limits")
+		h.AssertNil(t, err)
+		appDir = filepath.Join(tmpDir, "app")
+		platformDir = filepath.Join(tmpDir, "platform")
+		h.Mkdir(t, appDir, filepath.Join(platformDir, "env"), filepath.Join(tmpDir, "buildpack", "bin"))
+
+		bpTOML = &lifecycle.BuildpackTOML{
+			API:       api.Buildpack.Latest().String(),
+			Buildpack: lifecycle.BuildpackInfo{ID: "A", Version: "v1"},
+			Dir:       filepath.Join(tmpDir, "buildpack"),
+		}
+	})
+
+	it.After(func() {
+		os.RemoveAll(tmpDir)
+	})
+
+	writeBin := func(name, script string) {
+		t.Helper()
+		path := filepath.Join(tmpDir, "buildpack", "bin", name)
+		h.AssertNil(t, ioutil.WriteFile(path, []byte("#!/usr/bin/env bash\n"+script+"\n"), 0755))
+	}
+
+	detect := func(limits lifecycle.ExecLimits) lifecycle.DetectRun {
+		return bpTOML.Detect(&lifecycle.DetectConfig{
+			FullEnv:     os.Environ(),
+			AppDir:      appDir,
+			PlatformDir: platformDir,
+			Limits:      limits,
+		})
+	}
+
+	when("#Detect", func() {
+		it("kills detect when it exceeds the timeout", func() {
+			writeBin("detect", "echo started\nsleep 10 &\nwait")
+
+			start := time.Now()
+			run := detect(lifecycle.ExecLimits{Timeout: 100 * time.Millisecond})
+			if elapsed := time.Since(start); elapsed > 5*time.Second {
+				t.Fatalf("Expected detect to be killed, took %s", elapsed)
+			}
+
+			h.AssertEq(t, run.Code, lifecycle.CodeDetectTimeout)
+			h.AssertEq(t, string(run.Output), "started\n")
+			timeoutErr, ok := run.Err.(*lifecycle.TimeoutError)
+			if !ok {
+				t.Fatalf("Expected *lifecycle.TimeoutError, got %T: %v", run.Err, run.Err)
+			}
+			h.AssertEq(t, timeoutErr.Buildpack, "A@v1")
+			h.AssertEq(t, timeoutErr.Phase, "detect")
+			h.AssertError(t, run.Err, "buildpack A@v1 timed out after 100ms during detect")
+		})
+
+		it("forwards termination signals to detect when it runs with a timeout", func() {
+			started := filepath.Join(tmpDir, "started")
+			writeBin("detect", "trap 'echo terminated; exit 3' TERM\ntouch "+started+"\nsleep 10 &\nwait")
+
+			go func() {
+				for i := 0; i < 100; i++ {
+					if _, err := os.Stat(started); err == nil {
+						p, _ := os.FindProcess(os.Getpid())
+						_ = p.Signal(syscall.SIGTERM)
+						return
+					}
+					time.Sleep(50 * time.Millisecond)
+				}
+			}()
+			run := detect(lifecycle.ExecLimits{Timeout: 10 * time.Second})
+
+			h.AssertEq(t, run.Code, 3)
+			h.AssertEq(t, string(run.Output), "terminated\n")
+		})
+
+		it("returns the exit code when detect finishes within the timeout", func() {
+			writeBin("detect", "exit 100")
+
+			run := detect(lifecycle.ExecLimits{Timeout: 10 * time.Second})
+
+			h.AssertEq(t, run.Code, 100)
+		})
+
+		it("limits open files", func() {
+			if runtime.GOOS != "linux" {
+				t.Skip("resource limits are only enforced on linux")
+			}
+			writeBin("detect", "ulimit -n")
+
+			run := detect(lifecycle.ExecLimits{MaxOpenFiles: 64})
+
+			h.AssertEq(t, run.Code, 0)
+			h.AssertEq(t, strings.TrimSpace(string(run.Output)), "64")
+		})
+
+		it("limits memory", func() {
+			if runtime.GOOS != "linux" {
+				t.Skip("resource limits are only enforced on linux")
+			}
+			writeBin("detect", "ulimit -v")
+
+			run := detect(lifecycle.ExecLimits{MaxMemory: 1 << 30})
+
+			h.AssertEq(t, run.Code, 0)
+			h.AssertEq(t, strings.TrimSpace(string(run.Output)), "1048576")
+		})
+	})
+
+	when("#Build", func() {
+		it("fails with a buildpack timeout error when build exceeds the timeout", func() {
+			writeBin("build", "sleep 10")
+
+			_, err := bpTOML.Build(lifecycle.BuildpackPlan{}, lifecycle.BuildConfig{
+				Env:         env.NewBuildEnv(os.Environ()),
+				AppDir:      appDir,
+				PlatformDir: platformDir,
+				LayersDir:   filepath.Join(tmpDir, "layers"),
+				Out:         &bytes.Buffer{},
+				Err:         &bytes.Buffer{},
+				Limits:      lifecycle.ExecLimits{Timeout: 100 * time.Millisecond},
+			})
+
+			lerr, ok := err.(*lifecycle.Error)
+			if !ok {
+				t.Fatalf("Expected *lifecycle.Error, got %T: %v", err, err)
+			}
+			h.AssertEq(t, lerr.Type, lifecycle.ErrTypeBuildpackTimeout)
+			h.AssertError(t, lerr.Cause(), "buildpack A@v1 timed out after 100ms during build")
+		})
+	})
+}
@@ -0,0 +1,36 @@
+// +build linux darwin
+
+package lifecycle
+
+import (
+	"os"
+	"os/exec"
+	"os/signal"
+	"syscall"
+)
+
+func setProcessGroup(cmd *exec.Cmd) {
+	if cmd.SysProcAttr == nil {
+		cmd.SysProcAttr = &syscall.SysProcAttr{}
+	}
+	cmd.SysProcAttr.Setpgid = true
+}
+
+// killProcessGroup kills cmd and any processes it started.
+func killProcessGroup(cmd *exec.Cmd) {
+	if cmd.Process == nil {
+		return
+	}
+	_ = syscall.Kill(-cmd.Process.Pid, syscall.SIGKILL)
+}
+
+func notifySignals(signals chan<- os.Signal) {
+	signal.Notify(signals, syscall.SIGINT, syscall.SIGTERM)
+}
+
+// forwardSignals sends the signals received on signals to the process group of cmd until signals is closed.
+func forwardSignals(signals <-chan os.Signal, cmd *exec.Cmd) {
+	for sig := range signals {
+		_ = syscall.Kill(-cmd.Process.Pid, sig.(syscall.Signal))
+	}
+}
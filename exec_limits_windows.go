@@ -0,0 +1,26 @@
+package lifecycle
+
+import (
+	"errors"
+	"os"
+	"os/exec"
+)
+
+func setProcessGroup(cmd *exec.Cmd) {}
+
+func killProcessGroup(cmd *exec.Cmd) {
+	if cmd.Process == nil {
+		return
+	}
+	_ = cmd.Process.Kill()
+}
+
+func setRlimits(cmd *exec.Cmd, l ExecLimits) {}
+
+func notifySignals(signals chan<- os.Signal) {}
+
+func forwardSignals(signals <-chan os.Signal, cmd *exec.Cmd) {}
+
+func execWithRlimits(string, []string) error {
+	return errors.New("resource limits are not supported on windows")
+}
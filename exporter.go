@@ -10,6 +10,7 @@ import (
 
 	"github.com/BurntSushi/toml"
 	"github.com/buildpacks/imgutil"
+	v1 "github.com/google/go-containerregistry/pkg/v1"
 	"github.com/pkg/errors"
 
 	"github.com/buildpacks/lifecycle/api"
@@ -29,11 +30,43 @@ type Cache interface {
 	Commit() error
 }
 
+// ConcurrentCache is implemented by caches that allow AddLayerFile and ReuseLayer to be called concurrently.
+// Layers are written to other caches one at a time, in buildpack order.
+type ConcurrentCache interface {
+	ConcurrentWrites() bool
+}
+
+// TransferStatsCache is implemented by caches that keep statistics of the data transferred to and from their store.
+type TransferStatsCache interface {
+	TransferStats() CacheTransferStats
+}
+
+// CacheTransferStats summarizes the blobs transferred by a cache.
+type CacheTransferStats struct {
+	BlobsUploaded   int   // BlobsUploaded is the number of blobs written to the store
+	BlobsMounted    int   // BlobsMounted is the number of blobs linked from another repository without being uploaded
+	BlobsSkipped    int   // BlobsSkipped is the number of blobs that were already present in the store
+	BytesUploaded   int64 // BytesUploaded is the number of bytes written to the store
+	BytesDownloaded int64 // BytesDownloaded is the number of bytes read from the store
+}
+
+// HistoryImage is implemented by images that can record an OCI history entry for each added or reused layer.
+// Images that do not implement it are exported without layer history.
+type HistoryImage interface {
+	AddLayerWithDiffIDAndHistory(path, diffID string, history v1.History) error
+	ReuseLayerWithHistory(diffID string, history v1.History) error
+}
+
 type Exporter struct {
 	Buildpacks   []GroupBuildpack
 	LayerFactory LayerFactory
 	Logger       Logger
 	PlatformAPI  *api.Version
+
+	CacheConcurrency int // CacheConcurrency is the maximum number of cache layers created at once, defaults to the number of CPUs
+
+	layerSizes []layerSize // layerSizes holds the size of each layer tarball written during the current export
+	cacheStats cacheStatsRecorder
 }
 
 //go:generate mockgen -package testmock -destination testmock/layer_factory.go github.com/buildpacks/lifecycle LayerFactory
@@ -60,17 +93,29 @@ type ExportOptions struct {
 	Stack              StackMetadata
 	Project            ProjectMetadata
 	DefaultProcessType string
+	ImageConfig        ImageConfig
+	SizeBudget         SizeBudget
+	BaseLayerSizes     BaseLayerSizes
 }
 
 type ExportReport struct {
-	Build BuildReport `toml:"build,omitempty"`
-	Image ImageReport `toml:"image"`
+	Build    BuildReport         `toml:"build,omitempty"`
+	Launch   LaunchReport        `toml:"launch,omitempty"`
+	Image    ImageReport         `toml:"image"`
+	Layers   *LayersDiffReport   `toml:"layers,omitempty"`
+	RunImage *RunImageResolution `toml:"run-image,omitempty"`
 }
 
+// BuildReport lists the dependencies buildpacks used during the build.
 type BuildReport struct {
 	BOM []BOMEntry `toml:"bom"`
 }
 
+// LaunchReport lists the dependencies buildpacks contributed to the image.
+type LaunchReport struct {
+	BOM []BOMEntry `toml:"bom"`
+}
+
 type ImageReport struct {
 	Tags    []string `toml:"tags"`
 	ImageID string   `toml:"image-id,omitempty"`
@@ -90,6 +135,7 @@ func (e *Exporter) Export(opts ExportOptions) (ExportReport, error) {
 		return ExportReport{}, errors.Wrapf(err, "app dir absolute path")
 	}
 
+	e.layerSizes = nil
 	meta := LayersMetadata{}
 	meta.RunImage.TopLayer, err = opts.WorkingImage.TopLayer()
 	if err != nil {
@@ -119,10 +165,18 @@ func (e *Exporter) Export(opts ExportOptions) (ExportReport, error) {
 		return ExportReport{}, err
 	}
 
+	if err := e.enforceSizeBudget(opts.SizeBudget, opts.BaseLayerSizes); err != nil {
+		return ExportReport{}, err
+	}
+
 	if err := e.setLabels(opts, meta, buildMD); err != nil {
 		return ExportReport{}, err
 	}
 
+	if err := e.setImageConfig(opts, buildMD); err != nil {
+		return ExportReport{}, errors.Wrap(err, "applying image config")
+	}
+
 	if err := e.setEnv(opts, buildMD.toLaunchMD()); err != nil {
 		return ExportReport{}, err
 	}
@@ -141,10 +195,9 @@ func (e *Exporter) Export(opts ExportOptions) (ExportReport, error) {
 	}
 
 	report := ExportReport{}
-	report.Build, err = e.makeBuildReport(opts.LayersDir)
-	if err != nil {
-		return ExportReport{}, err
-	}
+	report.Build = e.makeBuildReport(buildMD)
+	report.Launch = e.makeLaunchReport(buildMD)
+	report.Layers = e.diffLayers(opts.OrigMetadata, meta)
 	report.Image, err = saveImage(opts.WorkingImage, opts.AdditionalNames, e.Logger)
 	if err != nil {
 		return ExportReport{}, err
@@ -178,11 +231,29 @@ func (e *Exporter) addBuildpackLayers(opts ExportOptions, meta *LayersMetadata)
 					return errors.Wrapf(err, "creating layer")
 				}
 				origLayerMetadata := opts.OrigMetadata.MetadataForBuildpack(bp.ID).Layers[fsLayer.name()]
-				lmd.SHA, err = e.addOrReuseLayer(opts.WorkingImage, layer, origLayerMetadata.SHA)
+				lmd.SHA, err = e.addOrReuseLayer(opts.WorkingImage, layer, origLayerMetadata.SHA, buildpackLayerCreatedBy(bp, fsLayer.name()))
 				if err != nil {
 					return err
 				}
+				if err := e.recordLayerSize(opts.SizeBudget, layer.ID, layer.TarPath, true); err != nil {
+					return err
+				}
 			} else {
+				if marker, ok := fsLayer.notRestored(); ok {
+					// The layer data was never restored from the cache, so the layer in the previous image is still current.
+					origLayerMetadata := opts.OrigMetadata.MetadataForBuildpack(bp.ID).Layers[fsLayer.name()]
+					if origLayerMetadata.SHA != marker.SHA {
+						return fmt.Errorf("layer '%s' was not restored from cache and previous image has a different layer", fsLayer.Identifier())
+					}
+					e.Logger.Infof("Reusing layer '%s', not restored from cache\n", fsLayer.Identifier())
+					if err := e.reuseLayer(opts.WorkingImage, marker.SHA, buildpackLayerCreatedBy(bp, fsLayer.name())); err != nil {
+						return errors.Wrapf(err, "reusing layer: '%s'", fsLayer.Identifier())
+					}
+					e.recordReusedLayerSize(opts, fsLayer.Identifier(), marker.SHA)
+					lmd.SHA = marker.SHA
+					bpMD.Layers[fsLayer.name()] = lmd
+					continue
+				}
 				if lmd.Cache {
 					return fmt.Errorf("layer '%s' is cache=true but has no contents", fsLayer.Identifier())
 				}
@@ -193,9 +264,10 @@ func (e *Exporter) addBuildpackLayers(opts ExportOptions, meta *LayersMetadata)
 
 				e.Logger.Infof("Reusing layer '%s'\n", fsLayer.Identifier())
 				e.Logger.Debugf("Layer '%s' SHA: %s\n", fsLayer.Identifier(), origLayerMetadata.SHA)
-				if err := opts.WorkingImage.ReuseLayer(origLayerMetadata.SHA); err != nil {
+				if err := e.reuseLayer(opts.WorkingImage, origLayerMetadata.SHA, buildpackLayerCreatedBy(bp, fsLayer.name())); err != nil {
 					return errors.Wrapf(err, "reusing layer: '%s'", fsLayer.Identifier())
 				}
+				e.recordReusedLayerSize(opts, fsLayer.Identifier(), origLayerMetadata.SHA)
 				lmd.SHA = origLayerMetadata.SHA
 			}
 			bpMD.Layers[fsLayer.name()] = lmd
@@ -218,18 +290,24 @@ func (e *Exporter) addLauncherLayers(opts ExportOptions, buildMD *BuildMetadata,
 	if err != nil {
 		return errors.Wrap(err, "creating launcher layers")
 	}
-	meta.Launcher.SHA, err = e.addOrReuseLayer(opts.WorkingImage, launcherLayer, opts.OrigMetadata.Launcher.SHA)
+	meta.Launcher.SHA, err = e.addOrReuseLayer(opts.WorkingImage, launcherLayer, opts.OrigMetadata.Launcher.SHA, launcherCreatedBy)
 	if err != nil {
 		return errors.Wrap(err, "exporting launcher configLayer")
 	}
+	if err := e.recordLayerSize(opts.SizeBudget, launcherLayer.ID, launcherLayer.TarPath, false); err != nil {
+		return err
+	}
 	configLayer, err := e.LayerFactory.DirLayer("config", filepath.Join(opts.LayersDir, "config"))
 	if err != nil {
 		return errors.Wrapf(err, "creating layer '%s'", configLayer.ID)
 	}
-	meta.Config.SHA, err = e.addOrReuseLayer(opts.WorkingImage, configLayer, opts.OrigMetadata.Config.SHA)
+	meta.Config.SHA, err = e.addOrReuseLayer(opts.WorkingImage, configLayer, opts.OrigMetadata.Config.SHA, configCreatedBy)
 	if err != nil {
 		return errors.Wrap(err, "exporting config layer")
 	}
+	if err := e.recordLayerSize(opts.SizeBudget, configLayer.ID, configLayer.TarPath, false); err != nil {
+		return err
+	}
 
 	if err := e.launcherConfig(opts, buildMD, meta); err != nil {
 		return err
@@ -245,7 +323,7 @@ func (e *Exporter) addAppLayers(opts ExportOptions, slices []layers.Slice, meta
 	}
 
 	var numberOfReusedLayers int
-	for _, slice := range sliceLayers {
+	for i, slice := range sliceLayers {
 		var err error
 
 		found := false
@@ -255,15 +333,19 @@ func (e *Exporter) addAppLayers(opts ExportOptions, slices []layers.Slice, meta
 				break
 			}
 		}
+		createdBy := appSliceCreatedBy(i + 1)
 		if found {
-			err = opts.WorkingImage.ReuseLayer(slice.Digest)
+			err = e.reuseLayer(opts.WorkingImage, slice.Digest, createdBy)
 			numberOfReusedLayers++
 		} else {
-			err = opts.WorkingImage.AddLayerWithDiffID(slice.TarPath, slice.Digest)
+			err = e.addLayer(opts.WorkingImage, slice.TarPath, slice.Digest, createdBy)
 		}
 		if err != nil {
 			return err
 		}
+		if err := e.recordLayerSize(opts.SizeBudget, appLayerID(i), slice.TarPath, false); err != nil {
+			return err
+		}
 		e.Logger.Debugf("Layer '%s' SHA: %s\n", slice.ID, slice.Digest)
 		meta.App = append(meta.App, LayerMetadata{SHA: slice.Digest})
 	}
@@ -393,10 +475,13 @@ func (e *Exporter) launcherConfig(opts ExportOptions, buildMD *BuildMetadata, me
 			if err != nil {
 				return errors.Wrapf(err, "creating layer '%s'", processTypesLayer.ID)
 			}
-			meta.ProcessTypes.SHA, err = e.addOrReuseLayer(opts.WorkingImage, processTypesLayer, opts.OrigMetadata.ProcessTypes.SHA)
+			meta.ProcessTypes.SHA, err = e.addOrReuseLayer(opts.WorkingImage, processTypesLayer, opts.OrigMetadata.ProcessTypes.SHA, processTypesCreatedBy)
 			if err != nil {
 				return errors.Wrapf(err, "exporting layer '%s'", processTypesLayer.ID)
 			}
+			if err := e.recordLayerSize(opts.SizeBudget, processTypesLayer.ID, processTypesLayer.TarPath, false); err != nil {
+				return err
+			}
 		}
 	}
 	return nil
@@ -418,7 +503,7 @@ func processTypeWarning(launchMD launch.Metadata, defaultProcessType string) str
 	return fmt.Sprintf("default process type '%s' not present in list %+v", defaultProcessType, typeList)
 }
 
-func (e *Exporter) addOrReuseLayer(image imgutil.Image, layer layers.Layer, previousSHA string) (string, error) {
+func (e *Exporter) addOrReuseLayer(image imgutil.Image, layer layers.Layer, previousSHA, createdBy string) (string, error) {
 	layer, err := e.LayerFactory.DirLayer(layer.ID, layer.TarPath)
 	if err != nil {
 		return "", errors.Wrapf(err, "creating layer '%s'", layer.ID)
@@ -426,28 +511,58 @@ func (e *Exporter) addOrReuseLayer(image imgutil.Image, layer layers.Layer, prev
 	if layer.Digest == previousSHA {
 		e.Logger.Infof("Reusing layer '%s'\n", layer.ID)
 		e.Logger.Debugf("Layer '%s' SHA: %s\n", layer.ID, layer.Digest)
-		return layer.Digest, image.ReuseLayer(previousSHA)
+		return layer.Digest, e.reuseLayer(image, previousSHA, createdBy)
 	}
 	e.Logger.Infof("Adding layer '%s'\n", layer.ID)
 	e.Logger.Debugf("Layer '%s' SHA: %s\n", layer.ID, layer.Digest)
-	return layer.Digest, image.AddLayerWithDiffID(layer.TarPath, layer.Digest)
+	return layer.Digest, e.addLayer(image, layer.TarPath, layer.Digest, createdBy)
+}
+
+func (e *Exporter) addLayer(image imgutil.Image, tarPath, diffID, createdBy string) error {
+	if hImage, ok := image.(HistoryImage); ok {
+		return hImage.AddLayerWithDiffIDAndHistory(tarPath, diffID, layerHistory(createdBy))
+	}
+	return image.AddLayerWithDiffID(tarPath, diffID)
+}
+
+func (e *Exporter) reuseLayer(image imgutil.Image, diffID, createdBy string) error {
+	if hImage, ok := image.(HistoryImage); ok {
+		return hImage.ReuseLayerWithHistory(diffID, layerHistory(createdBy))
+	}
+	return image.ReuseLayer(diffID)
+}
+
+const (
+	configCreatedBy       = "Buildpacks Launcher Config"
+	launcherCreatedBy     = "Buildpacks Application Launcher"
+	processTypesCreatedBy = "Buildpacks Process Types"
+)
+
+func buildpackLayerCreatedBy(bp GroupBuildpack, layerName string) string {
+	return fmt.Sprintf("Layer: '%s', Created by buildpack: %s", layerName, bp)
+}
+
+func appSliceCreatedBy(n int) string {
+	return fmt.Sprintf("Application Slice: %d", n)
+}
+
+func layerHistory(createdBy string) v1.History {
+	return v1.History{
+		Created:   v1.Time{Time: imgutil.NormalizedDateTime},
+		CreatedBy: createdBy,
+	}
 }
 
-func (e *Exporter) makeBuildReport(layersDir string) (BuildReport, error) {
+func (e *Exporter) makeBuildReport(buildMD *BuildMetadata) BuildReport {
 	if e.PlatformAPI.Compare(api.MustParse("0.5")) < 0 { // platform API < 0.5
-		return BuildReport{}, nil
+		return BuildReport{}
 	}
-	var out []BOMEntry
-	for _, bp := range e.Buildpacks {
-		if api.MustParse(bp.API).Compare(api.MustParse("0.5")) < 0 { // buildpack API < 0.5
-			continue
-		}
-		var bpBuildReport BuildReport
-		bpBuildTOML := filepath.Join(layersDir, launch.EscapeID(bp.ID), "build.toml")
-		if _, err := toml.DecodeFile(bpBuildTOML, &bpBuildReport); err != nil && !os.IsNotExist(err) {
-			return BuildReport{}, err
-		}
-		out = append(out, withBuildpack(bp, bpBuildReport.BOM)...)
+	return BuildReport{BOM: buildMD.BuildBOM}
+}
+
+func (e *Exporter) makeLaunchReport(buildMD *BuildMetadata) LaunchReport {
+	if e.PlatformAPI.Compare(api.MustParse("0.5")) < 0 { // platform API < 0.5
+		return LaunchReport{}
 	}
-	return BuildReport{BOM: out}, nil
+	return LaunchReport{BOM: buildMD.BOM}
 }
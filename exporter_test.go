@@ -19,6 +19,7 @@ import (
 	"github.com/buildpacks/imgutil/remote"
 	"github.com/golang/mock/gomock"
 	"github.com/google/go-containerregistry/pkg/name"
+	v1 "github.com/google/go-containerregistry/pkg/v1"
 	"github.com/sclevine/spec"
 	specreport "github.com/sclevine/spec/report"
 
@@ -309,6 +310,98 @@ func testExporter(t *testing.T, when spec.G, it spec.S) {
 				h.AssertEq(t, len(fakeAppImage.ReusedLayers()), 4)
 			})
 
+			when("there is an image size limit", func() {
+				it("counts the run image and reused layers", func() {
+					opts.SizeBudget = lifecycle.SizeBudget{MaxImageSize: 1500}
+					opts.BaseLayerSizes = lifecycle.BaseLayerSizes{
+						RunImage: 1000,
+						Previous: map[string]int64{"launch-layer-no-local-dir-digest": 500},
+					}
+
+					_, err := exporter.Export(opts)
+					h.AssertError(t, err, "image is 1.6 KiB (run image 1000 B, reused layers 500 B, exported layers 145 B), exceeding the image limit of 1.5 KiB; largest layers: 'buildpack.id:launch-layer-no-local-dir' (500 B)")
+				})
+
+				it("warns when the size of a reused layer is unknown", func() {
+					opts.SizeBudget = lifecycle.SizeBudget{MaxImageSize: 1500}
+
+					_, err := exporter.Export(opts)
+					h.AssertNil(t, err)
+					assertLogEntry(t, logHandler, "Size of reused layer 'buildpack.id:launch-layer-no-local-dir' is unknown")
+				})
+			})
+
+			when("reporting layer changes", func() {
+				it("reports added, reused and removed layers with their SHAs and sizes", func() {
+					report, err := exporter.Export(opts)
+					h.AssertNil(t, err)
+
+					h.AssertEq(t, report.Layers.AppChanged, true)
+					h.AssertEq(t, report.Layers.Layers, []lifecycle.LayerDiff{
+						{ID: "buildpack.id:launch-layer-no-local-dir", Status: "reused", OldSHA: "launch-layer-no-local-dir-digest", NewSHA: "launch-layer-no-local-dir-digest"},
+						{ID: "buildpack.id:new-launch-layer", Status: "added", NewSHA: "new-launch-layer-digest", Size: 25},
+						{ID: "other.buildpack.id:local-reusable-layer", Status: "reused", OldSHA: "local-reusable-layer-digest", NewSHA: "local-reusable-layer-digest", Size: 29},
+						{ID: "other.buildpack.id:new-launch-layer", Status: "added", NewSHA: "new-launch-layer-digest", Size: 25},
+						{ID: "other.buildpack.id:layer4", Status: "removed", OldSHA: "orig-layer4-sha"},
+						{ID: "app:1", Status: "added", NewSHA: "app-digest", Size: 12},
+						{ID: "launcher", Status: "reused", OldSHA: "launcher-digest", NewSHA: "launcher-digest", Size: 17},
+						{ID: "config", Status: "added", NewSHA: "config-digest", Size: 15},
+						{ID: "process-types", Status: "reused", OldSHA: "process-types-digest", NewSHA: "process-types-digest", Size: 22},
+					})
+				})
+
+				it("reports layers whose SHA changed", func() {
+					opts.OrigMetadata.Config.SHA = "old-config-digest"
+					opts.OrigMetadata.App = []lifecycle.LayerMetadata{{SHA: "old-app-digest"}}
+
+					report, err := exporter.Export(opts)
+					h.AssertNil(t, err)
+
+					h.AssertContains(t, layerDiffStrings(report.Layers.Layers),
+						"app:1 changed old-app-digest app-digest",
+						"config changed old-config-digest config-digest",
+					)
+				})
+
+				it("does not flag the app when every slice is reused", func() {
+					opts.OrigMetadata.App = []lifecycle.LayerMetadata{{SHA: "app-digest"}}
+					fakeAppImage.AddPreviousLayer("app-digest", "")
+
+					report, err := exporter.Export(opts)
+					h.AssertNil(t, err)
+
+					h.AssertEq(t, report.Layers.AppChanged, false)
+				})
+			})
+
+			when("the image supports history", func() {
+				var historyImage *fakeHistoryImage
+
+				it.Before(func() {
+					historyImage = &fakeHistoryImage{Image: fakeAppImage, history: map[string]string{}}
+					opts.WorkingImage = historyImage
+				})
+
+				it("records which buildpack created each added or reused layer", func() {
+					_, err := exporter.Export(opts)
+					h.AssertNil(t, err)
+
+					h.AssertEq(t, historyImage.history["new-launch-layer-digest"], "Layer: 'new-launch-layer', Created by buildpack: other.buildpack.id@4.5.6")
+					h.AssertEq(t, historyImage.history["launch-layer-no-local-dir-digest"], "Layer: 'launch-layer-no-local-dir', Created by buildpack: buildpack.id@1.2.3")
+					h.AssertEq(t, historyImage.history["local-reusable-layer-digest"], "Layer: 'local-reusable-layer', Created by buildpack: other.buildpack.id@4.5.6")
+				})
+
+				it("records app, launcher, config and process-types layers", func() {
+					_, err := exporter.Export(opts)
+					h.AssertNil(t, err)
+
+					h.AssertEq(t, historyImage.history["app-digest"], "Application Slice: 1")
+					h.AssertEq(t, historyImage.history["launcher-digest"], "Buildpacks Application Launcher")
+					h.AssertEq(t, historyImage.history["config-digest"], "Buildpacks Launcher Config")
+					h.AssertEq(t, historyImage.history["process-types-digest"], "Buildpacks Process Types")
+				})
+			})
+
 			it("saves lifecycle metadata with layer info", func() {
 				_, err := exporter.Export(opts)
 				h.AssertNil(t, err)
@@ -938,6 +1031,112 @@ version = "4.5.6"
 				})
 			})
 
+			when("there is a size budget", func() {
+				it("fails when a buildpack layer exceeds the layer limit", func() {
+					opts.SizeBudget = lifecycle.SizeBudget{MaxLayerSize: 10}
+
+					_, err := exporter.Export(opts)
+					h.AssertError(t, err, "layer 'buildpack.id:layer1' is 15 B, exceeding the layer limit of 10 B")
+					h.AssertEq(t, fakeAppImage.IsSaved(), false)
+				})
+
+				it("fails and names the largest layers when the new layers limit is exceeded", func() {
+					opts.SizeBudget = lifecycle.SizeBudget{MaxNewLayersSize: 50}
+
+					_, err := exporter.Export(opts)
+					h.AssertError(t, err, "exceeding the new layers limit of 50 B; largest layers: 'process-types' (22 B), 'launcher' (17 B)")
+				})
+
+				it("warns instead of failing when configured to", func() {
+					opts.SizeBudget = lifecycle.SizeBudget{MaxLayerSize: 10, WarnOnly: true}
+
+					_, err := exporter.Export(opts)
+					h.AssertNil(t, err)
+					assertLogEntry(t, logHandler, "Size budget exceeded: layer 'buildpack.id:layer1' is 15 B")
+				})
+
+				it("succeeds when the layers are within budget", func() {
+					opts.SizeBudget = lifecycle.SizeBudget{MaxNewLayersSize: 1024, MaxLayerSize: 1024}
+
+					_, err := exporter.Export(opts)
+					h.AssertNil(t, err)
+				})
+			})
+
+			when("there is image config", func() {
+				it.Before(func() {
+					opts.ImageConfig = lifecycle.ImageConfig{
+						ExposedPorts: []string{"8080/tcp", "9090"},
+						Labels:       map[string]string{"some.platform.label": "some-value"},
+						StopSignal:   "SIGINT",
+						User:         "1000:1000",
+						WorkingDir:   opts.AppDir,
+					}
+				})
+
+				it("sets platform-provided labels and working dir", func() {
+					opts.ImageConfig = lifecycle.ImageConfig{
+						Labels:     map[string]string{"some.platform.label": "some-value"},
+						WorkingDir: opts.AppDir,
+					}
+
+					_, err := exporter.Export(opts)
+					h.AssertNil(t, err)
+
+					label, err := fakeAppImage.Label("some.platform.label")
+					h.AssertNil(t, err)
+					h.AssertEq(t, label, "some-value")
+					h.AssertEq(t, fakeAppImage.WorkingDir(), opts.AppDir)
+				})
+
+				it("sets exposed ports, stop signal and user when the image supports them", func() {
+					configImage := &fakeConfigImage{Image: fakeAppImage}
+					opts.WorkingImage = configImage
+
+					_, err := exporter.Export(opts)
+					h.AssertNil(t, err)
+
+					h.AssertEq(t, configImage.exposedPorts, []string{"8080/tcp", "9090"})
+					h.AssertEq(t, configImage.stopSignal, "SIGINT")
+					h.AssertEq(t, configImage.user, "1000:1000")
+				})
+
+				it("fails when the image does not support exposed ports, stop signal or user", func() {
+					_, err := exporter.Export(opts)
+					h.AssertError(t, err, "image does not support setting exposed-ports, stop-signal, user")
+
+					opts.ImageConfig.ExposedPorts = nil
+					opts.ImageConfig.User = ""
+					_, err = exporter.Export(opts)
+					h.AssertError(t, err, "image does not support setting stop-signal")
+				})
+
+				it("fails and reports every invalid field", func() {
+					opts.ImageConfig.ExposedPorts = []string{"http", "8080/icmp"}
+					opts.ImageConfig.StopSignal = "TERM"
+					opts.ImageConfig.WorkingDir = "relative/dir"
+					opts.ImageConfig.Labels = map[string]string{"io.buildpacks.lifecycle.metadata": "{}"}
+
+					_, err := exporter.Export(opts)
+					h.AssertError(t, err, "exposed port 'http' must be a number between 1 and 65535")
+					h.AssertError(t, err, "exposed port '8080/icmp' has unsupported protocol 'icmp'")
+					h.AssertError(t, err, "stop-signal 'TERM' is not a valid signal")
+					h.AssertError(t, err, "working-dir 'relative/dir' must be an absolute path")
+					h.AssertError(t, err, "label 'io.buildpacks.lifecycle.metadata' is reserved by the lifecycle")
+				})
+
+				it("fails when a label conflicts with a buildpack-provided label", func() {
+					h.AssertNil(t, ioutil.WriteFile(filepath.Join(opts.LayersDir, "config", "metadata.toml"), []byte(`
+[[labels]]
+key = "some.platform.label"
+value = "buildpack-value"
+`), os.ModePerm))
+
+					_, err := exporter.Export(opts)
+					h.AssertError(t, err, "label 'some.platform.label' conflicts with a buildpack-provided label")
+				})
+			})
+
 			it("sets CNB_LAYERS_DIR", func() {
 				_, err := exporter.Export(opts)
 				h.AssertNil(t, err)
@@ -1116,7 +1315,7 @@ version = "4.5.6"
 			})
 		})
 
-		when("build.toml", func() {
+		when("build bom", func() {
 			when("platform api >= 0.5", func() {
 				it.Before(func() {
 					exporter.PlatformAPI = api.MustParse("0.5")
@@ -1152,16 +1351,20 @@ version = "4.5.6"
 							},
 						})
 					})
-				})
 
-				when("invalid", func() {
-					it.Before(func() {
-						opts.LayersDir = filepath.Join("testdata", "exporter", "build-metadata", "bad-layers")
-					})
+					it("adds launch bom entries to the report separately", func() {
+						report, err := exporter.Export(opts)
+						h.AssertNil(t, err)
 
-					it("returns an error", func() {
-						_, err := exporter.Export(opts)
-						h.AssertError(t, err, "toml")
+						h.AssertEq(t, report.Launch.BOM, []lifecycle.BOMEntry{
+							{
+								Require: lifecycle.Require{
+									Name:     "launch-dep",
+									Metadata: map[string]interface{}{"version": string("v1")},
+								},
+								Buildpack: lifecycle.GroupBuildpack{ID: "buildpack.id", Version: "1.2.3"},
+							},
+						})
 					})
 				})
 			})
@@ -1246,10 +1449,87 @@ version = "4.5.6"
 					"layer 'buildpack.id:cache-layer-no-contents' is cache=true but has no contents",
 				)
 			})
+
+			when("the layer data was not restored from the cache", func() {
+				it.Before(func() {
+					h.Mkfile(t, "sha = \"cache-layer-sha\"\ncache = \"file:///cache\"",
+						filepath.Join(opts.LayersDir, "buildpack.id", "cache-layer-no-contents.restore"))
+				})
+
+				it("reuses the layer from the previous image", func() {
+					layerFactory.EXPECT().
+						ProcessTypesLayer(gomock.Any()).
+						DoAndReturn(func(_ launch.Metadata) (layers.Layer, error) {
+							return createTestLayer("process-types", tmpDir)
+						}).
+						AnyTimes()
+					fakeAppImage.AddPreviousLayer("cache-layer-sha", "")
+					opts.OrigMetadata = lifecycle.LayersMetadata{Buildpacks: []lifecycle.BuildpackLayersMetadata{{
+						ID: "buildpack.id",
+						Layers: map[string]lifecycle.BuildpackLayerMetadata{
+							"cache-layer-no-contents": {LayerMetadata: lifecycle.LayerMetadata{SHA: "cache-layer-sha"}},
+						},
+					}}}
+
+					_, err := exporter.Export(opts)
+					h.AssertNil(t, err)
+					h.AssertContains(t, fakeAppImage.ReusedLayers(), "cache-layer-sha")
+				})
+
+				it("returns an error when the previous image has a different layer", func() {
+					_, err := exporter.Export(opts)
+					h.AssertError(t, err, "layer 'buildpack.id:cache-layer-no-contents' was not restored from cache")
+				})
+			})
 		})
 	})
 }
 
+type fakeConfigImage struct {
+	*fakes.Image
+	exposedPorts []string
+	stopSignal   string
+	user         string
+}
+
+func (i *fakeConfigImage) SetExposedPorts(ports ...string) error {
+	i.exposedPorts = ports
+	return nil
+}
+
+func (i *fakeConfigImage) SetStopSignal(signal string) error {
+	i.stopSignal = signal
+	return nil
+}
+
+func (i *fakeConfigImage) SetUser(user string) error {
+	i.user = user
+	return nil
+}
+
+func layerDiffStrings(diffs []lifecycle.LayerDiff) []string {
+	var out []string
+	for _, d := range diffs {
+		out = append(out, strings.Join([]string{d.ID, d.Status, d.OldSHA, d.NewSHA}, " "))
+	}
+	return out
+}
+
+type fakeHistoryImage struct {
+	*fakes.Image
+	history map[string]string
+}
+
+func (i *fakeHistoryImage) AddLayerWithDiffIDAndHistory(path, diffID string, history v1.History) error {
+	i.history[diffID] = history.CreatedBy
+	return i.AddLayerWithDiffID(path, diffID)
+}
+
+func (i *fakeHistoryImage) ReuseLayerWithHistory(diffID string, history v1.History) error {
+	i.history[diffID] = history.CreatedBy
+	return i.ReuseLayer(diffID)
+}
+
 func createTestLayer(id string, tmpDir string) (layers.Layer, error) {
 	tarPath := filepath.Join(tmpDir, "artifacts", strings.Replace(id, "/", "_", -1))
 	f, err := os.Create(tarPath)
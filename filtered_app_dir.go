@@ -0,0 +1,165 @@
+package lifecycle
+
+import (
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	"github.com/pkg/errors"
+
+	"github.com/buildpacks/lifecycle/layers"
+)
+
+// FilteredAppDir is a copy of an app directory without the files matched by ignore rules. Buildpacks run against
+// the copy, so that they do not see the ignored files while the app directory itself is left untouched.
+type FilteredAppDir struct {
+	Dir     string // Dir is the copy of the app directory
+	Ignored int    // Ignored is the number of files left out of the copy
+
+	appDir string
+	rules  *layers.IgnoreRules
+}
+
+// NewFilteredAppDir copies the files in appDir that are not matched by rules to a new directory in parentDir.
+func NewFilteredAppDir(appDir, parentDir string, rules *layers.IgnoreRules) (*FilteredAppDir, error) {
+	appDir, err := filepath.Abs(appDir)
+	if err != nil {
+		return nil, err
+	}
+	dir, err := ioutil.TempDir(parentDir, "filtered-app.")
+	if err != nil {
+		return nil, errors.Wrap(err, "creating filtered app directory")
+	}
+	f := &FilteredAppDir{Dir: dir, appDir: appDir, rules: rules}
+	if err := f.copy(appDir, dir, true); err != nil {
+		os.RemoveAll(dir)
+		return nil, errors.Wrap(err, "copying app directory")
+	}
+	return f, nil
+}
+
+// Sync applies the changes made to the copy to the app directory. Ignored files in the app directory are left alone.
+func (f *FilteredAppDir) Sync() error {
+	if err := f.copy(f.Dir, f.appDir, false); err != nil {
+		return errors.Wrap(err, "copying changes to app directory")
+	}
+	return filepath.Walk(f.appDir, func(path string, fi os.FileInfo, err error) error {
+		if err != nil || path == f.appDir {
+			return err
+		}
+		if path == f.Dir {
+			return filepath.SkipDir
+		}
+		relPath, err := filepath.Rel(f.appDir, path)
+		if err != nil {
+			return err
+		}
+		if f.rules.Ignored(relPath, fi.IsDir()) {
+			if fi.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if _, err := os.Lstat(filepath.Join(f.Dir, relPath)); os.IsNotExist(err) {
+			if err := os.RemoveAll(path); err != nil {
+				return errors.Wrapf(err, "removing '%s' from app directory", relPath)
+			}
+			if fi.IsDir() {
+				return filepath.SkipDir
+			}
+		} else if err != nil {
+			return err
+		}
+		return nil
+	})
+}
+
+// Remove removes the copy.
+func (f *FilteredAppDir) Remove() error {
+	return os.RemoveAll(f.Dir)
+}
+
+// copy copies the files in from that are not ignored to to, skipping files that are unchanged.
+// Ignored files are counted when counting is set.
+func (f *FilteredAppDir) copy(from, to string, counting bool) error {
+	return filepath.Walk(from, func(path string, fi os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if path == f.Dir && from != f.Dir {
+			return filepath.SkipDir // the copy is within the app directory
+		}
+		relPath, err := filepath.Rel(from, path)
+		if err != nil {
+			return err
+		}
+		if path != from && f.rules.Ignored(relPath, fi.IsDir()) {
+			if counting {
+				n, err := layers.CountFiles(path, fi)
+				if err != nil {
+					return err
+				}
+				f.Ignored += n
+			}
+			if fi.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if !fi.IsDir() && !fi.Mode().IsRegular() && fi.Mode()&os.ModeSymlink == 0 {
+			return nil // sockets, devices and named pipes are not copied
+		}
+		target := filepath.Join(to, relPath)
+		existing, err := os.Lstat(target)
+		if err != nil && !os.IsNotExist(err) {
+			return err
+		}
+		switch {
+		case fi.IsDir():
+			if existing != nil && !existing.IsDir() {
+				if err := os.Remove(target); err != nil {
+					return err
+				}
+			}
+			if err := os.MkdirAll(target, fi.Mode().Perm()); err != nil {
+				return err
+			}
+			return os.Chmod(target, fi.Mode().Perm())
+		case existing != nil && existing.Mode() == fi.Mode() && existing.Size() == fi.Size() && existing.ModTime().Equal(fi.ModTime()):
+			return nil
+		case existing != nil:
+			if err := os.RemoveAll(target); err != nil {
+				return err
+			}
+		}
+		if fi.Mode()&os.ModeSymlink != 0 {
+			link, err := os.Readlink(path)
+			if err != nil {
+				return err
+			}
+			return os.Symlink(link, target)
+		}
+		return copyAppFile(path, target, fi)
+	})
+}
+
+func copyAppFile(from, to string, fi os.FileInfo) error {
+	in, err := os.Open(from)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+	out, err := os.OpenFile(to, os.O_CREATE|os.O_EXCL|os.O_WRONLY, fi.Mode().Perm())
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(out, in); err != nil {
+		out.Close()
+		return err
+	}
+	if err := out.Close(); err != nil {
+		return err
+	}
+	return os.Chtimes(to, fi.ModTime(), fi.ModTime())
+}
@@ -0,0 +1,85 @@
+package lifecycle_test
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/sclevine/spec"
+	"github.com/sclevine/spec/report"
+
+	"github.com/buildpacks/lifecycle"
+	"github.com/buildpacks/lifecycle/layers"
+	h "github.com/buildpacks/lifecycle/testhelpers"
+)
+
+func TestFilteredAppDir(t *testing.T) {
+	spec.Run(t, "FilteredAppDir", testFilteredAppDir, spec.Report(report.Terminal{}))
+}
+
+func testFilteredAppDir(t *testing.T, when spec.G, it spec.S) {
+	var (
+		tmpDir  string
+		appDir  string
+		subject *lifecycle.FilteredAppDir
+	)
+
+	it.Before(func() {
+		var err error
+		tmpDir, err = ioutil.TempDir("", "lifecycle.filtered-app-dir")
+		h.AssertNil(t, err)
+		appDir = filepath.Join(tmpDir, "app")
+		h.Mkdir(t, filepath.Join(appDir, "node_modules", "dep"), filepath.Join(appDir, "src"))
+		h.Mkfile(t, "dep", filepath.Join(appDir, "node_modules", "dep", "index.js"))
+		h.Mkfile(t, "app", filepath.Join(appDir, "src", "app.js"))
+		h.Mkfile(t, "log", filepath.Join(appDir, "src", "debug.log"))
+		h.Mkfile(t, "readme", filepath.Join(appDir, "README.md"))
+
+		subject, err = lifecycle.NewFilteredAppDir(appDir, tmpDir, layers.NewIgnoreRules([]string{"node_modules/", "*.log"}))
+		h.AssertNil(t, err)
+	})
+
+	it.After(func() {
+		os.RemoveAll(tmpDir)
+	})
+
+	when("#NewFilteredAppDir", func() {
+		it("copies the app files that are not ignored and counts the ignored files", func() {
+			h.AssertEq(t, subject.Ignored, 2)
+			h.AssertEq(t, h.Rdfile(t, filepath.Join(subject.Dir, "src", "app.js")), "app")
+			h.AssertEq(t, h.Rdfile(t, filepath.Join(subject.Dir, "README.md")), "readme")
+			h.AssertPathDoesNotExist(t, filepath.Join(subject.Dir, "node_modules"))
+			h.AssertPathDoesNotExist(t, filepath.Join(subject.Dir, "src", "debug.log"))
+		})
+
+		it("leaves the app directory untouched", func() {
+			h.AssertEq(t, h.Rdfile(t, filepath.Join(appDir, "node_modules", "dep", "index.js")), "dep")
+			h.AssertEq(t, h.Rdfile(t, filepath.Join(appDir, "src", "debug.log")), "log")
+		})
+	})
+
+	when("#Sync", func() {
+		it("applies the changes made to the copy and keeps the ignored files", func() {
+			h.Mkfile(t, "changed", filepath.Join(subject.Dir, "src", "app.js"))
+			h.Mkdir(t, filepath.Join(subject.Dir, "bin"))
+			h.Mkfile(t, "built", filepath.Join(subject.Dir, "bin", "app"))
+			h.AssertNil(t, os.Remove(filepath.Join(subject.Dir, "README.md")))
+
+			h.AssertNil(t, subject.Sync())
+
+			h.AssertEq(t, h.Rdfile(t, filepath.Join(appDir, "src", "app.js")), "changed")
+			h.AssertEq(t, h.Rdfile(t, filepath.Join(appDir, "bin", "app")), "built")
+			h.AssertPathDoesNotExist(t, filepath.Join(appDir, "README.md"))
+			h.AssertEq(t, h.Rdfile(t, filepath.Join(appDir, "node_modules", "dep", "index.js")), "dep")
+			h.AssertEq(t, h.Rdfile(t, filepath.Join(appDir, "src", "debug.log")), "log")
+		})
+	})
+
+	when("#Remove", func() {
+		it("removes the copy", func() {
+			h.AssertNil(t, subject.Remove())
+			h.AssertPathDoesNotExist(t, subject.Dir)
+		})
+	})
+}
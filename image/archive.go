@@ -0,0 +1,281 @@
+package image
+
+import (
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/buildpacks/imgutil"
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+	"github.com/google/go-containerregistry/pkg/v1/layout"
+	"github.com/google/go-containerregistry/pkg/v1/tarball"
+	"github.com/pkg/errors"
+)
+
+// Transports of image references that name an image archive on disk rather than an image in a registry or daemon,
+// e.g. oci:/path/to/layout or docker-archive:/path/to/image.tar.
+const (
+	TransportOCI    = "oci"
+	TransportDocker = "docker-archive"
+)
+
+// ParseArchiveRef returns the transport and path of a reference to an image archive.
+// ok is false when ref names an image in a registry or daemon.
+func ParseArchiveRef(ref string) (transport, path string, ok bool) {
+	parts := strings.SplitN(ref, ":", 2)
+	if len(parts) != 2 || parts[1] == "" {
+		return "", "", false
+	}
+	switch parts[0] {
+	case TransportOCI, TransportDocker:
+		return parts[0], parts[1], true
+	}
+	return "", "", false
+}
+
+// IsArchiveRef returns true if ref names an image archive.
+func IsArchiveRef(ref string) bool {
+	_, _, ok := ParseArchiveRef(ref)
+	return ok
+}
+
+// ArchiveImage is a read-only image loaded from an OCI layout or a `docker save` tarball.
+type ArchiveImage struct {
+	ref   string
+	image v1.Image // image is nil when the archive does not exist
+}
+
+type ArchiveIdentifier struct {
+	Ref    string
+	Digest v1.Hash
+}
+
+func (a ArchiveIdentifier) String() string {
+	return a.Ref
+}
+
+// NewArchiveImage opens the image archive named by ref. An archive that does not exist is an image that is not found.
+func NewArchiveImage(ref string) (*ArchiveImage, error) {
+	transport, path, ok := ParseArchiveRef(ref)
+	if !ok {
+		return nil, fmt.Errorf("'%s' is not an image archive, must be prefixed with '%s:' or '%s:'", ref, TransportOCI, TransportDocker)
+	}
+	a := &ArchiveImage{ref: ref}
+	if _, err := os.Stat(path); err != nil {
+		if os.IsNotExist(err) {
+			return a, nil
+		}
+		return nil, err
+	}
+
+	var err error
+	switch transport {
+	case TransportOCI:
+		a.image, err = imageFromLayout(path)
+	case TransportDocker:
+		a.image, err = tarball.ImageFromPath(path, nil)
+	}
+	if err != nil {
+		return nil, errors.Wrapf(err, "reading image archive '%s'", ref)
+	}
+	return a, nil
+}
+
+func imageFromLayout(path string) (v1.Image, error) {
+	index, err := layout.ImageIndexFromPath(path)
+	if err != nil {
+		return nil, err
+	}
+	manifest, err := index.IndexManifest()
+	if err != nil {
+		return nil, err
+	}
+	if len(manifest.Manifests) != 1 {
+		return nil, fmt.Errorf("layout contains %d images, expected 1", len(manifest.Manifests))
+	}
+	return index.Image(manifest.Manifests[0].Digest)
+}
+
+func (a *ArchiveImage) errReadOnly() error {
+	return fmt.Errorf("image archive '%s' is read-only", a.ref)
+}
+
+func (a *ArchiveImage) configFile() (*v1.ConfigFile, error) {
+	if a.image == nil {
+		return nil, fmt.Errorf("image archive '%s' does not exist", a.ref)
+	}
+	return a.image.ConfigFile()
+}
+
+func (a *ArchiveImage) Name() string {
+	return a.ref
+}
+
+func (a *ArchiveImage) Rename(name string) {}
+
+func (a *ArchiveImage) Found() bool {
+	return a.image != nil
+}
+
+func (a *ArchiveImage) Identifier() (imgutil.Identifier, error) {
+	if a.image == nil {
+		return nil, fmt.Errorf("image archive '%s' does not exist", a.ref)
+	}
+	digest, err := a.image.Digest()
+	if err != nil {
+		return nil, errors.Wrapf(err, "getting digest of '%s'", a.ref)
+	}
+	return ArchiveIdentifier{Ref: a.ref, Digest: digest}, nil
+}
+
+func (a *ArchiveImage) Label(key string) (string, error) {
+	labels, err := a.Labels()
+	if err != nil {
+		return "", err
+	}
+	return labels[key], nil
+}
+
+func (a *ArchiveImage) Labels() (map[string]string, error) {
+	cfg, err := a.configFile()
+	if err != nil {
+		return nil, err
+	}
+	return cfg.Config.Labels, nil
+}
+
+func (a *ArchiveImage) Env(key string) (string, error) {
+	cfg, err := a.configFile()
+	if err != nil {
+		return "", err
+	}
+	for _, env := range cfg.Config.Env {
+		parts := strings.SplitN(env, "=", 2)
+		if parts[0] == key && len(parts) == 2 {
+			return parts[1], nil
+		}
+	}
+	return "", nil
+}
+
+func (a *ArchiveImage) TopLayer() (string, error) {
+	cfg, err := a.configFile()
+	if err != nil {
+		return "", err
+	}
+	diffIDs := cfg.RootFS.DiffIDs
+	if len(diffIDs) == 0 {
+		return "", fmt.Errorf("image archive '%s' has no layers", a.ref)
+	}
+	return diffIDs[len(diffIDs)-1].String(), nil
+}
+
+func (a *ArchiveImage) GetLayer(diffID string) (io.ReadCloser, error) {
+	if a.image == nil {
+		return nil, fmt.Errorf("image archive '%s' does not exist", a.ref)
+	}
+	hash, err := v1.NewHash(diffID)
+	if err != nil {
+		return nil, err
+	}
+	layer, err := a.image.LayerByDiffID(hash)
+	if err != nil {
+		return nil, errors.Wrapf(err, "image archive '%s' does not have layer with diff ID '%s'", a.ref, diffID)
+	}
+	return layer.Uncompressed()
+}
+
+func (a *ArchiveImage) CreatedAt() (time.Time, error) {
+	cfg, err := a.configFile()
+	if err != nil {
+		return time.Time{}, err
+	}
+	return cfg.Created.Time, nil
+}
+
+func (a *ArchiveImage) OS() (string, error) {
+	cfg, err := a.configFile()
+	if err != nil {
+		return "", err
+	}
+	return cfg.OS, nil
+}
+
+func (a *ArchiveImage) OSVersion() (string, error) {
+	cfg, err := a.configFile()
+	if err != nil {
+		return "", err
+	}
+	return cfg.OSVersion, nil
+}
+
+func (a *ArchiveImage) Architecture() (string, error) {
+	cfg, err := a.configFile()
+	if err != nil {
+		return "", err
+	}
+	return cfg.Architecture, nil
+}
+
+func (a *ArchiveImage) SetLabel(string, string) error           { return a.errReadOnly() }
+func (a *ArchiveImage) RemoveLabel(string) error                { return a.errReadOnly() }
+func (a *ArchiveImage) SetEnv(string, string) error             { return a.errReadOnly() }
+func (a *ArchiveImage) SetEntrypoint(...string) error           { return a.errReadOnly() }
+func (a *ArchiveImage) SetWorkingDir(string) error              { return a.errReadOnly() }
+func (a *ArchiveImage) SetCmd(...string) error                  { return a.errReadOnly() }
+func (a *ArchiveImage) SetOS(string) error                      { return a.errReadOnly() }
+func (a *ArchiveImage) SetOSVersion(string) error               { return a.errReadOnly() }
+func (a *ArchiveImage) SetArchitecture(string) error            { return a.errReadOnly() }
+func (a *ArchiveImage) Rebase(string, imgutil.Image) error      { return a.errReadOnly() }
+func (a *ArchiveImage) AddLayer(string) error                   { return a.errReadOnly() }
+func (a *ArchiveImage) AddLayerWithDiffID(string, string) error { return a.errReadOnly() }
+func (a *ArchiveImage) ReuseLayer(string) error                 { return a.errReadOnly() }
+func (a *ArchiveImage) Save(...string) error                    { return a.errReadOnly() }
+func (a *ArchiveImage) Delete() error                           { return a.errReadOnly() }
+
+// previousArchiveImage reuses layers from a previous image stored in an archive by copying them into the wrapped image.
+type previousArchiveImage struct {
+	imgutil.Image
+	previous *ArchiveImage
+	tmpDir   string
+}
+
+// WithPreviousArchive returns an image that reuses layers from previous, an image archive.
+// Reused layers are written to tmpDir before being added to image.
+func WithPreviousArchive(image imgutil.Image, previous *ArchiveImage, tmpDir string) imgutil.Image {
+	return &previousArchiveImage{
+		Image:    image,
+		previous: previous,
+		tmpDir:   tmpDir,
+	}
+}
+
+func (p *previousArchiveImage) ReuseLayer(diffID string) error {
+	path, err := p.layerFile(diffID)
+	if err != nil {
+		return err
+	}
+	return p.Image.AddLayerWithDiffID(path, diffID)
+}
+
+func (p *previousArchiveImage) layerFile(diffID string) (string, error) {
+	rc, err := p.previous.GetLayer(diffID)
+	if err != nil {
+		return "", errors.Wrap(err, "reusing layer from previous image")
+	}
+	defer rc.Close()
+
+	f, err := ioutil.TempFile(p.tmpDir, filepath.Base(strings.Replace(diffID, ":", "-", 1))+".*.tar")
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+	if _, err := io.Copy(f, rc); err != nil {
+		return "", errors.Wrapf(err, "writing layer '%s'", diffID)
+	}
+	return f.Name(), nil
+}
@@ -0,0 +1,184 @@
+package image_test
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/buildpacks/imgutil/fakes"
+	"github.com/google/go-containerregistry/pkg/name"
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+	"github.com/google/go-containerregistry/pkg/v1/empty"
+	"github.com/google/go-containerregistry/pkg/v1/layout"
+	"github.com/google/go-containerregistry/pkg/v1/mutate"
+	"github.com/google/go-containerregistry/pkg/v1/random"
+	"github.com/google/go-containerregistry/pkg/v1/tarball"
+	"github.com/sclevine/spec"
+	"github.com/sclevine/spec/report"
+
+	"github.com/buildpacks/lifecycle/image"
+	h "github.com/buildpacks/lifecycle/testhelpers"
+)
+
+func TestArchiveImage(t *testing.T) {
+	spec.Run(t, "ArchiveImage", testArchiveImage, spec.Report(report.Terminal{}))
+}
+
+func testArchiveImage(t *testing.T, when spec.G, it spec.S) {
+	var (
+		tmpDir   string
+		img      v1.Image
+		diffID   string
+		contents []byte
+	)
+
+	it.Before(func() {
+		var err error
+		tmpDir, err = ioutil.TempDir("", "archive-image")
+		h.AssertNil(t, err)
+
+		img, err = random.Image(64, 2)
+		h.AssertNil(t, err)
+		cfg, err := img.ConfigFile()
+		h.AssertNil(t, err)
+		cfg = cfg.DeepCopy()
+		cfg.Config.Labels = map[string]string{"some-label": "some-value"}
+		cfg.Config.Env = []string{"SOME_KEY=some-value"}
+		img, err = mutate.ConfigFile(img, cfg)
+		h.AssertNil(t, err)
+
+		layers, err := img.Layers()
+		h.AssertNil(t, err)
+		hash, err := layers[1].DiffID()
+		h.AssertNil(t, err)
+		diffID = hash.String()
+		rc, err := layers[1].Uncompressed()
+		h.AssertNil(t, err)
+		defer rc.Close()
+		contents, err = ioutil.ReadAll(rc)
+		h.AssertNil(t, err)
+	})
+
+	it.After(func() {
+		os.RemoveAll(tmpDir)
+	})
+
+	when("#ParseArchiveRef", func() {
+		it("parses oci and docker-archive references", func() {
+			transport, path, ok := image.ParseArchiveRef("oci:/some/layout")
+			h.AssertEq(t, ok, true)
+			h.AssertEq(t, transport, image.TransportOCI)
+			h.AssertEq(t, path, "/some/layout")
+
+			transport, path, ok = image.ParseArchiveRef("docker-archive:some.tar")
+			h.AssertEq(t, ok, true)
+			h.AssertEq(t, transport, image.TransportDocker)
+			h.AssertEq(t, path, "some.tar")
+		})
+
+		it("does not parse registry references", func() {
+			for _, ref := range []string{"some/image", "registry.example.com:5000/some/image:tag", "oci:"} {
+				_, _, ok := image.ParseArchiveRef(ref)
+				h.AssertEq(t, ok, false)
+			}
+		})
+	})
+
+	assertReadable := func(ref string) {
+		subject, err := image.NewArchiveImage(ref)
+		h.AssertNil(t, err)
+		h.AssertEq(t, subject.Found(), true)
+
+		label, err := subject.Label("some-label")
+		h.AssertNil(t, err)
+		h.AssertEq(t, label, "some-value")
+
+		env, err := subject.Env("SOME_KEY")
+		h.AssertNil(t, err)
+		h.AssertEq(t, env, "some-value")
+
+		topLayer, err := subject.TopLayer()
+		h.AssertNil(t, err)
+		h.AssertEq(t, topLayer, diffID)
+
+		identifier, err := subject.Identifier()
+		h.AssertNil(t, err)
+		h.AssertEq(t, identifier.String(), ref)
+
+		rc, err := subject.GetLayer(diffID)
+		h.AssertNil(t, err)
+		defer rc.Close()
+		data, err := ioutil.ReadAll(rc)
+		h.AssertNil(t, err)
+		h.AssertEq(t, data, contents)
+
+		h.AssertError(t, subject.SetLabel("some-label", "other-value"), "is read-only")
+	}
+
+	when("#NewArchiveImage", func() {
+		it("reads an OCI layout", func() {
+			layoutPath := filepath.Join(tmpDir, "layout")
+			p, err := layout.Write(layoutPath, empty.Index)
+			h.AssertNil(t, err)
+			h.AssertNil(t, p.AppendImage(img))
+
+			assertReadable("oci:" + layoutPath)
+		})
+
+		it("reads a docker save tarball", func() {
+			tarPath := filepath.Join(tmpDir, "image.tar")
+			tag, err := name.NewTag("some/image:latest")
+			h.AssertNil(t, err)
+			h.AssertNil(t, tarball.WriteToFile(tarPath, tag, img))
+
+			assertReadable("docker-archive:" + tarPath)
+		})
+
+		it("is not found when the archive does not exist", func() {
+			subject, err := image.NewArchiveImage("oci:" + filepath.Join(tmpDir, "missing"))
+			h.AssertNil(t, err)
+			h.AssertEq(t, subject.Found(), false)
+		})
+
+		it("errors when the layout contains more than one image", func() {
+			layoutPath := filepath.Join(tmpDir, "layout")
+			p, err := layout.Write(layoutPath, empty.Index)
+			h.AssertNil(t, err)
+			h.AssertNil(t, p.AppendImage(img))
+			other, err := random.Image(64, 1)
+			h.AssertNil(t, err)
+			h.AssertNil(t, p.AppendImage(other))
+
+			_, err = image.NewArchiveImage("oci:" + layoutPath)
+			h.AssertError(t, err, "layout contains 2 images, expected 1")
+		})
+	})
+
+	when("#WithPreviousArchive", func() {
+		it("reuses layers by copying them from the archive", func() {
+			tarPath := filepath.Join(tmpDir, "image.tar")
+			tag, err := name.NewTag("some/image:latest")
+			h.AssertNil(t, err)
+			h.AssertNil(t, tarball.WriteToFile(tarPath, tag, img))
+			previous, err := image.NewArchiveImage("docker-archive:" + tarPath)
+			h.AssertNil(t, err)
+
+			fakeImage := fakes.NewImage("some-image", "", nil)
+			defer fakeImage.Cleanup()
+			subject := image.WithPreviousArchive(fakeImage, previous, tmpDir)
+
+			h.AssertNil(t, subject.ReuseLayer(diffID))
+			h.AssertEq(t, fakeImage.NumberOfAddedLayers(), 1)
+			rc, err := fakeImage.GetLayer(diffID)
+			h.AssertNil(t, err)
+			defer rc.Close()
+			data, err := ioutil.ReadAll(rc)
+			h.AssertNil(t, err)
+			h.AssertEq(t, data, contents)
+
+			h.AssertError(t, subject.ReuseLayer("sha256:"+strings.Repeat("0", 64)), "reusing layer from previous image")
+		})
+	})
+}
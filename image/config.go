@@ -0,0 +1,321 @@
+package image
+
+import (
+	"archive/tar"
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"strings"
+
+	"github.com/buildpacks/imgutil"
+	"github.com/buildpacks/imgutil/local"
+	imgremote "github.com/buildpacks/imgutil/remote"
+	"github.com/docker/docker/client"
+	"github.com/docker/docker/pkg/jsonmessage"
+	"github.com/google/go-containerregistry/pkg/authn"
+	"github.com/google/go-containerregistry/pkg/name"
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+	"github.com/google/go-containerregistry/pkg/v1/mutate"
+	"github.com/google/go-containerregistry/pkg/v1/remote"
+	"github.com/pkg/errors"
+)
+
+// ConfigImage records the parts of the image config that imgutil images cannot set: a history entry for each layer,
+// exposed ports, stop signal and user. imgutil zeroes the history when it saves an image and has no setters for the
+// other fields, so they are written to the config of the saved image after Save, and Identifier returns the rewritten image.
+type ConfigImage struct {
+	imgutil.Image
+	writer configWriter
+
+	history      []v1.History
+	exposedPorts []string
+	stopSignal   string
+	user         string
+	id           imgutil.Identifier
+}
+
+// configWriter rewrites the config of the image saved as id under names, returning the identifier of the rewritten image.
+type configWriter interface {
+	writeConfig(id imgutil.Identifier, names []string, edit func(*v1.ConfigFile)) (imgutil.Identifier, error)
+}
+
+// NewLocalConfigImage wraps image, an image in the docker daemon.
+func NewLocalConfigImage(image imgutil.Image, docker client.CommonAPIClient) *ConfigImage {
+	return &ConfigImage{Image: image, writer: localConfigWriter{docker: docker}}
+}
+
+// NewRemoteConfigImage wraps image, an image in a registry.
+func NewRemoteConfigImage(image imgutil.Image, keychain authn.Keychain) *ConfigImage {
+	return &ConfigImage{Image: image, writer: remoteConfigWriter{keychain: keychain}}
+}
+
+func (i *ConfigImage) AddLayer(path string) error {
+	return i.addLayer(func() error { return i.Image.AddLayer(path) }, v1.History{})
+}
+
+func (i *ConfigImage) AddLayerWithDiffID(path, diffID string) error {
+	return i.addLayer(func() error { return i.Image.AddLayerWithDiffID(path, diffID) }, v1.History{})
+}
+
+func (i *ConfigImage) AddLayerWithDiffIDAndHistory(path, diffID string, history v1.History) error {
+	return i.addLayer(func() error { return i.Image.AddLayerWithDiffID(path, diffID) }, history)
+}
+
+func (i *ConfigImage) ReuseLayer(diffID string) error {
+	return i.addLayer(func() error { return i.Image.ReuseLayer(diffID) }, v1.History{})
+}
+
+func (i *ConfigImage) ReuseLayerWithHistory(diffID string, history v1.History) error {
+	return i.addLayer(func() error { return i.Image.ReuseLayer(diffID) }, history)
+}
+
+// addLayer records history for the layer added by add, so that history stays in line with the layers of the image.
+func (i *ConfigImage) addLayer(add func() error, history v1.History) error {
+	if err := add(); err != nil {
+		return err
+	}
+	i.history = append(i.history, history)
+	return nil
+}
+
+func (i *ConfigImage) SetExposedPorts(ports ...string) error {
+	i.exposedPorts = ports
+	return nil
+}
+
+func (i *ConfigImage) SetStopSignal(signal string) error {
+	i.stopSignal = signal
+	return nil
+}
+
+func (i *ConfigImage) SetUser(user string) error {
+	i.user = user
+	return nil
+}
+
+func (i *ConfigImage) Save(additionalNames ...string) error {
+	i.id = nil
+	saveErr := i.Image.Save(additionalNames...)
+	if saveErr != nil {
+		if _, ok := saveErr.(imgutil.SaveError); !ok {
+			return saveErr
+		}
+	}
+	names := savedNames(append([]string{i.Name()}, additionalNames...), saveErr)
+	if len(names) == 0 {
+		return saveErr
+	}
+
+	savedID, err := i.Image.Identifier()
+	if err != nil {
+		return err
+	}
+	if i.id, err = i.writer.writeConfig(savedID, names, i.editConfig); err != nil {
+		return errors.Wrap(err, "writing image config")
+	}
+	return saveErr
+}
+
+func (i *ConfigImage) Identifier() (imgutil.Identifier, error) {
+	if i.id != nil {
+		return i.id, nil
+	}
+	return i.Image.Identifier()
+}
+
+// editConfig writes the recorded config to cfg. Layers that were in the base image keep the history imgutil gave them.
+func (i *ConfigImage) editConfig(cfg *v1.ConfigFile) {
+	if base := len(cfg.History) - len(i.history); base >= 0 {
+		for n, history := range i.history {
+			history.Created = cfg.History[base+n].Created
+			cfg.History[base+n] = history
+		}
+	}
+	if len(i.exposedPorts) > 0 {
+		if cfg.Config.ExposedPorts == nil {
+			cfg.Config.ExposedPorts = map[string]struct{}{}
+		}
+		for _, port := range i.exposedPorts {
+			if !strings.Contains(port, "/") {
+				port += "/tcp"
+			}
+			cfg.Config.ExposedPorts[port] = struct{}{}
+		}
+	}
+	if i.stopSignal != "" {
+		cfg.Config.StopSignal = i.stopSignal
+	}
+	if i.user != "" {
+		cfg.Config.User = i.user
+	}
+}
+
+// savedNames returns the names that were saved without error.
+func savedNames(names []string, saveErr error) []string {
+	failed := map[string]struct{}{}
+	if saveErr, ok := saveErr.(imgutil.SaveError); ok {
+		for _, d := range saveErr.Errors {
+			failed[d.ImageName] = struct{}{}
+		}
+	}
+	var saved []string
+	for _, n := range names {
+		if _, ok := failed[n]; !ok {
+			saved = append(saved, n)
+		}
+	}
+	return saved
+}
+
+type remoteConfigWriter struct {
+	keychain authn.Keychain
+}
+
+// writeConfig reads the saved image by digest and pushes it with the edited config. Only the config and manifest
+// are uploaded, the layers are already in the registry.
+func (w remoteConfigWriter) writeConfig(id imgutil.Identifier, names []string, edit func(*v1.ConfigFile)) (imgutil.Identifier, error) {
+	digestID, ok := id.(imgremote.DigestIdentifier)
+	if !ok {
+		return nil, fmt.Errorf("unexpected identifier '%s' for a registry image", id)
+	}
+	auth, err := w.keychain.Resolve(digestID.Digest.Context().Registry)
+	if err != nil {
+		return nil, err
+	}
+	img, err := remote.Image(digestID.Digest, remote.WithAuth(auth))
+	if err != nil {
+		return nil, errors.Wrap(err, "reading saved image")
+	}
+	cfg, err := img.ConfigFile()
+	if err != nil {
+		return nil, err
+	}
+	cfg = cfg.DeepCopy()
+	edit(cfg)
+	if img, err = mutate.ConfigFile(img, cfg); err != nil {
+		return nil, err
+	}
+
+	for _, n := range names {
+		ref, err := name.ParseReference(n, name.WeakValidation)
+		if err != nil {
+			return nil, err
+		}
+		auth, err := w.keychain.Resolve(ref.Context().Registry)
+		if err != nil {
+			return nil, err
+		}
+		if err := remote.Write(ref, img, remote.WithAuth(auth)); err != nil {
+			return nil, errors.Wrapf(err, "writing image '%s'", n)
+		}
+	}
+	digest, err := img.Digest()
+	if err != nil {
+		return nil, err
+	}
+	return imgremote.DigestIdentifier{Digest: digestID.Digest.Context().Digest(digest.String())}, nil
+}
+
+type localConfigWriter struct {
+	docker client.CommonAPIClient
+}
+
+// writeConfig loads the saved image into the daemon again with the edited config. Like imgutil, it leaves the layers
+// out of the loaded archive as the daemon already has them in the same order.
+func (w localConfigWriter) writeConfig(id imgutil.Identifier, names []string, edit func(*v1.ConfigFile)) (imgutil.Identifier, error) {
+	cfg, err := w.savedConfig(id.String())
+	if err != nil {
+		return nil, errors.Wrap(err, "reading saved image config")
+	}
+	edit(cfg)
+	cfgJSON, err := json.Marshal(cfg)
+	if err != nil {
+		return nil, err
+	}
+	imageID := fmt.Sprintf("%x", sha256.Sum256(cfgJSON))
+
+	var tags []string
+	for _, n := range names {
+		tag, err := name.NewTag(n, name.WeakValidation)
+		if err != nil {
+			return nil, err
+		}
+		tags = append(tags, tag.Name())
+	}
+	manifestJSON, err := json.Marshal([]map[string]interface{}{{
+		"Config":   imageID + ".json",
+		"RepoTags": tags,
+		"Layers":   make([]string, len(cfg.RootFS.DiffIDs)),
+	}})
+	if err != nil {
+		return nil, err
+	}
+
+	var buf bytes.Buffer
+	tw := tar.NewWriter(&buf)
+	for _, file := range []struct {
+		name    string
+		content []byte
+	}{{imageID + ".json", cfgJSON}, {"manifest.json", manifestJSON}} {
+		if err := tw.WriteHeader(&tar.Header{Name: file.name, Mode: 0644, Size: int64(len(file.content))}); err != nil {
+			return nil, err
+		}
+		if _, err := tw.Write(file.content); err != nil {
+			return nil, err
+		}
+	}
+	if err := tw.Close(); err != nil {
+		return nil, err
+	}
+
+	res, err := w.docker.ImageLoad(context.Background(), &buf, true)
+	if err != nil {
+		return nil, errors.Wrap(err, "loading image")
+	}
+	defer res.Body.Close()
+	if err := jsonmessage.DisplayJSONMessagesStream(res.Body, ioutil.Discard, 0, false, nil); err != nil {
+		return nil, errors.Wrap(err, "loading image")
+	}
+	return local.IDIdentifier{ImageID: "sha256:" + imageID}, nil
+}
+
+// savedConfig reads the config of the image with imageID from the daemon, skipping over its layers.
+func (w localConfigWriter) savedConfig(imageID string) (*v1.ConfigFile, error) {
+	rc, err := w.docker.ImageSave(context.Background(), []string{imageID})
+	if err != nil {
+		return nil, err
+	}
+	defer rc.Close()
+
+	var (
+		manifest []struct{ Config string }
+		files    = map[string][]byte{}
+	)
+	tr := tar.NewReader(rc)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		if hdr.Typeflag != tar.TypeReg || strings.Contains(hdr.Name, "/") || !strings.HasSuffix(hdr.Name, ".json") {
+			continue
+		}
+		if files[hdr.Name], err = ioutil.ReadAll(tr); err != nil {
+			return nil, err
+		}
+	}
+	if err := json.Unmarshal(files["manifest.json"], &manifest); err != nil {
+		return nil, errors.Wrap(err, "parsing manifest.json")
+	}
+	if len(manifest) != 1 {
+		return nil, fmt.Errorf("expected 1 image in saved archive, found %d", len(manifest))
+	}
+	return v1.ParseConfigFile(bytes.NewReader(files[manifest[0].Config]))
+}
@@ -0,0 +1,128 @@
+package image_test
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/buildpacks/imgutil"
+	imgremote "github.com/buildpacks/imgutil/remote"
+	"github.com/google/go-containerregistry/pkg/authn"
+	"github.com/google/go-containerregistry/pkg/name"
+	"github.com/google/go-containerregistry/pkg/registry"
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+	"github.com/google/go-containerregistry/pkg/v1/remote"
+	"github.com/sclevine/spec"
+	"github.com/sclevine/spec/report"
+
+	"github.com/buildpacks/lifecycle/image"
+	h "github.com/buildpacks/lifecycle/testhelpers"
+)
+
+func TestConfigImage(t *testing.T) {
+	spec.Run(t, "ConfigImage", testConfigImage, spec.Report(report.Terminal{}))
+}
+
+func testConfigImage(t *testing.T, when spec.G, it spec.S) {
+	var (
+		tmpDir    string
+		server    *httptest.Server
+		imageName string
+		subject   *image.ConfigImage
+	)
+
+	writeLayer := func(contents string) string {
+		t.Helper()
+		path := filepath.Join(tmpDir, contents+".tar")
+		h.AssertNil(t, ioutil.WriteFile(path, []byte(contents), 0600))
+		return path
+	}
+
+	savedConfig := func(imageName string) (*v1.ConfigFile, v1.Hash) {
+		t.Helper()
+		ref, err := name.ParseReference(imageName, name.WeakValidation)
+		h.AssertNil(t, err)
+		img, err := remote.Image(ref)
+		h.AssertNil(t, err)
+		cfg, err := img.ConfigFile()
+		h.AssertNil(t, err)
+		digest, err := img.Digest()
+		h.AssertNil(t, err)
+		return cfg, digest
+	}
+
+	it.Before(func() {
+		var err error
+
+		tmpDir, err = ioutil.TempDir("", "lifecycle.image.config")
+		h.AssertNil(t, err)
+
+		server = httptest.NewServer(registry.New())
+		u, err := url.Parse(server.URL)
+		h.AssertNil(t, err)
+		imageName = fmt.Sprintf("%s/some/app:latest", u.Host)
+
+		remoteImage, err := imgremote.NewImage(imageName, authn.DefaultKeychain)
+		h.AssertNil(t, err)
+		subject = image.NewRemoteConfigImage(remoteImage, authn.DefaultKeychain)
+	})
+
+	it.After(func() {
+		server.Close()
+		os.RemoveAll(tmpDir)
+	})
+
+	it("writes the history of each layer to the saved image", func() {
+		h.AssertNil(t, subject.AddLayerWithDiffIDAndHistory(writeLayer("first"), "", v1.History{CreatedBy: "first layer"}))
+		h.AssertNil(t, subject.AddLayerWithDiffID(writeLayer("second"), ""))
+		h.AssertNil(t, subject.AddLayerWithDiffIDAndHistory(writeLayer("third"), "", v1.History{CreatedBy: "third layer"}))
+
+		h.AssertNil(t, subject.Save())
+
+		cfg, _ := savedConfig(imageName)
+		h.AssertEq(t, len(cfg.History), 3)
+		h.AssertEq(t, cfg.History[0].CreatedBy, "first layer")
+		h.AssertEq(t, cfg.History[1].CreatedBy, "")
+		h.AssertEq(t, cfg.History[2].CreatedBy, "third layer")
+		h.AssertEq(t, cfg.History[2].Created.Time.Equal(imgutil.NormalizedDateTime), true)
+	})
+
+	it("writes exposed ports, stop signal and user to the saved image", func() {
+		h.AssertNil(t, subject.SetExposedPorts("8080", "53/udp"))
+		h.AssertNil(t, subject.SetStopSignal("SIGINT"))
+		h.AssertNil(t, subject.SetUser("cnb"))
+
+		h.AssertNil(t, subject.Save())
+
+		cfg, _ := savedConfig(imageName)
+		h.AssertEq(t, cfg.Config.ExposedPorts, map[string]struct{}{"8080/tcp": {}, "53/udp": {}})
+		h.AssertEq(t, cfg.Config.StopSignal, "SIGINT")
+		h.AssertEq(t, cfg.Config.User, "cnb")
+	})
+
+	it("identifies the image with the rewritten config", func() {
+		h.AssertNil(t, subject.AddLayerWithDiffIDAndHistory(writeLayer("first"), "", v1.History{CreatedBy: "first layer"}))
+		h.AssertNil(t, subject.Save())
+
+		_, digest := savedConfig(imageName)
+		id, err := subject.Identifier()
+		h.AssertNil(t, err)
+		h.AssertEq(t, id.(imgremote.DigestIdentifier).Digest.DigestStr(), digest.String())
+	})
+
+	it("writes the config to the additional names", func() {
+		u, err := url.Parse(server.URL)
+		h.AssertNil(t, err)
+		otherName := fmt.Sprintf("%s/some/app:other", u.Host)
+		h.AssertNil(t, subject.AddLayerWithDiffIDAndHistory(writeLayer("first"), "", v1.History{CreatedBy: "first layer"}))
+
+		h.AssertNil(t, subject.Save(otherName))
+
+		cfg, _ := savedConfig(otherName)
+		h.AssertEq(t, cfg.History[0].CreatedBy, "first layer")
+	})
+}
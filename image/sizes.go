@@ -0,0 +1,84 @@
+package image
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/docker/docker/client"
+	"github.com/google/go-containerregistry/pkg/authn"
+	"github.com/google/go-containerregistry/pkg/name"
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+	"github.com/google/go-containerregistry/pkg/v1/remote"
+	"github.com/pkg/errors"
+)
+
+// RegistryImageSize returns the size of the image ref in a registry and the sizes of its layers by diff ID.
+// Sizes are the compressed sizes of the layers, as listed in the manifest.
+func RegistryImageSize(ref string, keychain authn.Keychain) (int64, map[string]int64, error) {
+	r, err := name.ParseReference(ref, name.WeakValidation)
+	if err != nil {
+		return 0, nil, err
+	}
+	auth, err := keychain.Resolve(r.Context().Registry)
+	if err != nil {
+		return 0, nil, err
+	}
+	img, err := remote.Image(r, remote.WithAuth(auth))
+	if err != nil {
+		return 0, nil, errors.Wrapf(err, "reading image '%s'", ref)
+	}
+	return imageSize(img)
+}
+
+// Size returns the size of the archived image and the sizes of its layers by diff ID.
+func (a *ArchiveImage) Size() (int64, map[string]int64, error) {
+	if a.image == nil {
+		return 0, nil, fmt.Errorf("image archive '%s' does not exist", a.ref)
+	}
+	return imageSize(a.image)
+}
+
+func imageSize(img v1.Image) (int64, map[string]int64, error) {
+	layers, err := img.Layers()
+	if err != nil {
+		return 0, nil, err
+	}
+	var total int64
+	sizes := map[string]int64{}
+	for _, layer := range layers {
+		diffID, err := layer.DiffID()
+		if err != nil {
+			return 0, nil, err
+		}
+		size, err := layer.Size()
+		if err != nil {
+			return 0, nil, err
+		}
+		total += size
+		sizes[diffID.String()] = size
+	}
+	return total, sizes, nil
+}
+
+// DaemonImageSize returns the size of the image ref in the docker daemon and the sizes of its layers by diff ID.
+// The daemon only reports layer sizes through the image history, so the sizes of the layers are only returned
+// when every history entry adds a layer, as in images saved by the exporter.
+func DaemonImageSize(docker client.CommonAPIClient, ref string) (int64, map[string]int64, error) {
+	inspect, _, err := docker.ImageInspectWithRaw(context.Background(), ref)
+	if err != nil {
+		return 0, nil, errors.Wrapf(err, "inspecting image '%s'", ref)
+	}
+	history, err := docker.ImageHistory(context.Background(), ref)
+	if err != nil {
+		return 0, nil, errors.Wrapf(err, "reading history of image '%s'", ref)
+	}
+	diffIDs := inspect.RootFS.Layers
+	if len(history) != len(diffIDs) {
+		return inspect.Size, nil, nil
+	}
+	sizes := map[string]int64{}
+	for i, diffID := range diffIDs {
+		sizes[diffID] = history[len(history)-1-i].Size // history is newest first
+	}
+	return inspect.Size, sizes, nil
+}
@@ -0,0 +1,58 @@
+package image_test
+
+import (
+	"fmt"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+
+	"github.com/google/go-containerregistry/pkg/authn"
+	"github.com/google/go-containerregistry/pkg/name"
+	"github.com/google/go-containerregistry/pkg/registry"
+	"github.com/google/go-containerregistry/pkg/v1/random"
+	"github.com/google/go-containerregistry/pkg/v1/remote"
+	"github.com/sclevine/spec"
+	"github.com/sclevine/spec/report"
+
+	"github.com/buildpacks/lifecycle/image"
+	h "github.com/buildpacks/lifecycle/testhelpers"
+)
+
+func TestSizes(t *testing.T) {
+	spec.Run(t, "Sizes", testSizes, spec.Report(report.Terminal{}))
+}
+
+func testSizes(t *testing.T, when spec.G, it spec.S) {
+	when("#RegistryImageSize", func() {
+		it("returns the sizes of the image layers from its manifest", func() {
+			server := httptest.NewServer(registry.New())
+			defer server.Close()
+			u, err := url.Parse(server.URL)
+			h.AssertNil(t, err)
+			imageName := fmt.Sprintf("%s/some/image:latest", u.Host)
+
+			img, err := random.Image(100, 2)
+			h.AssertNil(t, err)
+			ref, err := name.ParseReference(imageName, name.WeakValidation)
+			h.AssertNil(t, err)
+			h.AssertNil(t, remote.Write(ref, img))
+
+			total, sizes, err := image.RegistryImageSize(imageName, authn.DefaultKeychain)
+			h.AssertNil(t, err)
+
+			manifest, err := img.Manifest()
+			h.AssertNil(t, err)
+			layers, err := img.Layers()
+			h.AssertNil(t, err)
+			h.AssertEq(t, len(sizes), 2)
+			var expected int64
+			for i, layer := range layers {
+				diffID, err := layer.DiffID()
+				h.AssertNil(t, err)
+				h.AssertEq(t, sizes[diffID.String()], manifest.Layers[i].Size)
+				expected += manifest.Layers[i].Size
+			}
+			h.AssertEq(t, total, expected)
+		})
+	})
+}
@@ -0,0 +1,178 @@
+package lifecycle
+
+import (
+	"fmt"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// ImageConfig is the platform-provided configuration applied to the exported image.
+type ImageConfig struct {
+	ExposedPorts []string          `toml:"exposed-ports"`
+	Labels       map[string]string `toml:"labels"`
+	StopSignal   string            `toml:"stop-signal"`
+	User         string            `toml:"user"`
+	WorkingDir   string            `toml:"working-dir"`
+}
+
+// ImageConfigSetter is implemented by images that support config fields not exposed by imgutil.Image, e.g. image.ConfigImage.
+type ImageConfigSetter interface {
+	SetExposedPorts(ports ...string) error
+	SetStopSignal(signal string) error
+	SetUser(user string) error
+}
+
+func (c ImageConfig) isEmpty() bool {
+	return len(c.ExposedPorts) == 0 && len(c.Labels) == 0 && c.StopSignal == "" && c.User == "" && c.WorkingDir == ""
+}
+
+// validate returns an error describing every field that is malformed or that conflicts with the build metadata.
+func (c ImageConfig) validate(buildMD *BuildMetadata) error {
+	var problems []string
+
+	for _, port := range c.ExposedPorts {
+		if err := validatePort(port); err != nil {
+			problems = append(problems, err.Error())
+		}
+	}
+
+	if c.StopSignal != "" && !validSignal(c.StopSignal) {
+		problems = append(problems, fmt.Sprintf("stop-signal '%s' is not a valid signal", c.StopSignal))
+	}
+
+	if c.WorkingDir != "" && !path.IsAbs(c.WorkingDir) {
+		problems = append(problems, fmt.Sprintf("working-dir '%s' must be an absolute path", c.WorkingDir))
+	}
+
+	buildpackLabels := map[string]struct{}{}
+	for _, label := range buildMD.Labels {
+		buildpackLabels[label.Key] = struct{}{}
+	}
+	var keys []string
+	for key := range c.Labels {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		if isLifecycleLabel(key) {
+			problems = append(problems, fmt.Sprintf("label '%s' is reserved by the lifecycle", key))
+			continue
+		}
+		if _, ok := buildpackLabels[key]; ok {
+			problems = append(problems, fmt.Sprintf("label '%s' conflicts with a buildpack-provided label", key))
+		}
+	}
+
+	if len(problems) > 0 {
+		return fmt.Errorf("invalid image config: %s", strings.Join(problems, "; "))
+	}
+	return nil
+}
+
+// setterFields returns the fields that can only be applied to an ImageConfigSetter.
+func (c ImageConfig) setterFields() []string {
+	var fields []string
+	if len(c.ExposedPorts) > 0 {
+		fields = append(fields, "exposed-ports")
+	}
+	if c.StopSignal != "" {
+		fields = append(fields, "stop-signal")
+	}
+	if c.User != "" {
+		fields = append(fields, "user")
+	}
+	return fields
+}
+
+func isLifecycleLabel(key string) bool {
+	switch key {
+	case BuildMetadataLabel, LayerMetadataLabel, ProjectMetadataLabel, StackIDLabel, MixinsLabel:
+		return true
+	}
+	return false
+}
+
+func validatePort(port string) error {
+	number, protocol := port, "tcp"
+	if i := strings.Index(port, "/"); i >= 0 {
+		number, protocol = port[:i], port[i+1:]
+	}
+	n, err := strconv.Atoi(number)
+	if err != nil || n < 1 || n > 65535 {
+		return fmt.Errorf("exposed port '%s' must be a number between 1 and 65535", port)
+	}
+	switch protocol {
+	case "tcp", "udp", "sctp":
+		return nil
+	}
+	return fmt.Errorf("exposed port '%s' has unsupported protocol '%s'", port, protocol)
+}
+
+func validSignal(signal string) bool {
+	if n, err := strconv.Atoi(signal); err == nil {
+		return n > 0
+	}
+	return strings.HasPrefix(signal, "SIG") && len(signal) > len("SIG")
+}
+
+func (e *Exporter) setImageConfig(opts ExportOptions, buildMD *BuildMetadata) error {
+	config := opts.ImageConfig
+	if config.isEmpty() {
+		return nil
+	}
+	if err := config.validate(buildMD); err != nil {
+		return err
+	}
+	setter, ok := opts.WorkingImage.(ImageConfigSetter)
+	if !ok {
+		if fields := config.setterFields(); len(fields) > 0 {
+			return fmt.Errorf("image does not support setting %s", strings.Join(fields, ", "))
+		}
+	}
+
+	var keys []string
+	for key := range config.Labels {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		e.Logger.Infof("Adding platform-provided label '%s'", key)
+		if err := opts.WorkingImage.SetLabel(key, config.Labels[key]); err != nil {
+			return errors.Wrapf(err, "set platform-provided label '%s'", key)
+		}
+	}
+
+	if config.WorkingDir != "" {
+		if config.WorkingDir != opts.AppDir {
+			e.Logger.Warnf("Working dir '%s' differs from app dir '%s', the launcher will run processes from the app dir", config.WorkingDir, opts.AppDir)
+		}
+		e.Logger.Debugf("Setting WORKDIR: '%s'", config.WorkingDir)
+		if err := opts.WorkingImage.SetWorkingDir(config.WorkingDir); err != nil {
+			return errors.Wrap(err, "set working dir")
+		}
+	}
+
+	if len(config.ExposedPorts) > 0 {
+		e.Logger.Debugf("Setting exposed ports: %s", strings.Join(config.ExposedPorts, ", "))
+		if err := setter.SetExposedPorts(config.ExposedPorts...); err != nil {
+			return errors.Wrap(err, "set exposed ports")
+		}
+	}
+	if config.StopSignal != "" {
+		e.Logger.Debugf("Setting stop signal: '%s'", config.StopSignal)
+		if err := setter.SetStopSignal(config.StopSignal); err != nil {
+			return errors.Wrap(err, "set stop signal")
+		}
+	}
+	if config.User != "" {
+		e.Logger.Debugf("Setting user: '%s'", config.User)
+		if err := setter.SetUser(config.User); err != nil {
+			return errors.Wrap(err, "set user")
+		}
+	}
+	return nil
+}
@@ -151,6 +151,9 @@ func (bp *bpLayer) remove() error {
 	if err := os.Remove(bp.path + ".toml"); err != nil && !os.IsNotExist(err) {
 		return err
 	}
+	if err := os.Remove(lazyRestoreMarkerPath(bp.path)); err != nil && !os.IsNotExist(err) {
+		return err
+	}
 	return nil
 }
 
@@ -4,16 +4,19 @@ import (
 	"os"
 	"path/filepath"
 	"strings"
+	"sync"
 
 	"github.com/buildpacks/lifecycle/archive"
 )
 
 type Factory struct {
-	ArtifactsDir string // ArtifactsDir is the directory where layer files are written
-	UID, GID     int    // UID and GID are used to normalize layer entries
+	ArtifactsDir string       // ArtifactsDir is the directory where layer files are written
+	UID, GID     int          // UID and GID are used to normalize layer entries
+	Ignore       *IgnoreRules // Ignore excludes matching files from the layers created by SliceLayers
 	Logger       Logger
 
 	tarHashes map[string]string // tarHases Stores hashes of layer tarballs for reuse between the export and cache steps.
+	mu        sync.Mutex        // mu guards tarHashes, layers may be written concurrently
 }
 
 type Layer struct {
@@ -38,10 +41,7 @@ type Logger interface {
 
 func (f *Factory) writeLayer(id string, addEntries func(tw *archive.NormalizingTarWriter) error) (layer Layer, err error) {
 	tarPath := filepath.Join(f.ArtifactsDir, escape(id)+".tar")
-	if f.tarHashes == nil {
-		f.tarHashes = make(map[string]string)
-	}
-	if sha, ok := f.tarHashes[tarPath]; ok {
+	if sha, ok := f.tarHash(tarPath); ok {
 		f.Logger.Debugf("Reusing tarball for layer %q with SHA: %s\n", id, sha)
 		return Layer{
 			ID:      id,
@@ -67,7 +67,7 @@ func (f *Factory) writeLayer(id string, addEntries func(tw *archive.NormalizingT
 		return Layer{}, err
 	}
 	digest := lw.Digest()
-	f.tarHashes[tarPath] = digest
+	f.setTarHash(tarPath, digest)
 	return Layer{
 		ID:      id,
 		Digest:  digest,
@@ -75,6 +75,22 @@ func (f *Factory) writeLayer(id string, addEntries func(tw *archive.NormalizingT
 	}, err
 }
 
+func (f *Factory) tarHash(tarPath string) (string, bool) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	sha, ok := f.tarHashes[tarPath]
+	return sha, ok
+}
+
+func (f *Factory) setTarHash(tarPath, sha string) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.tarHashes == nil {
+		f.tarHashes = make(map[string]string)
+	}
+	f.tarHashes[tarPath] = sha
+}
+
 func escape(id string) string {
 	return strings.Replace(id, "/", "_", -1)
 }
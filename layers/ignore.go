@@ -0,0 +1,159 @@
+package layers
+
+import (
+	"bufio"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+// IgnoreRules match paths within a directory using the syntax of a .gitignore file.
+// The nil *IgnoreRules matches nothing.
+type IgnoreRules struct {
+	rules []ignoreRule
+}
+
+type ignoreRule struct {
+	segments []string // pattern split on '/', a leading "**" matches the pattern at any depth
+	negate   bool
+	dirOnly  bool
+}
+
+// ReadIgnoreFile reads the rules in the file at path. It returns nil rules when the file does not exist.
+func ReadIgnoreFile(path string) (*IgnoreRules, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	defer f.Close()
+
+	var lines []string
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		lines = append(lines, scanner.Text())
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return NewIgnoreRules(lines), nil
+}
+
+// NewIgnoreRules parses lines of .gitignore syntax. Later rules take precedence over earlier rules.
+func NewIgnoreRules(lines []string) *IgnoreRules {
+	r := &IgnoreRules{}
+	for _, line := range lines {
+		if rule, ok := parseIgnoreRule(line); ok {
+			r.rules = append(r.rules, rule)
+		}
+	}
+	return r
+}
+
+func parseIgnoreRule(line string) (ignoreRule, bool) {
+	line = strings.TrimSuffix(line, "\r")
+	if !strings.HasSuffix(line, `\ `) {
+		line = strings.TrimRight(line, " ")
+	}
+	if line == "" || strings.HasPrefix(line, "#") {
+		return ignoreRule{}, false
+	}
+
+	var rule ignoreRule
+	if strings.HasPrefix(line, "!") {
+		rule.negate = true
+		line = line[1:]
+	} else if strings.HasPrefix(line, `\!`) || strings.HasPrefix(line, `\#`) {
+		line = line[1:]
+	}
+	if strings.HasSuffix(line, "/") {
+		rule.dirOnly = true
+		line = strings.TrimRight(line, "/")
+	}
+	if line == "" {
+		return ignoreRule{}, false
+	}
+
+	// a pattern without a slash matches at any depth, otherwise it is relative to the directory
+	anchored := strings.Contains(line, "/")
+	line = strings.TrimPrefix(line, "/")
+	rule.segments = strings.Split(line, "/")
+	if !anchored {
+		rule.segments = append([]string{"**"}, rule.segments...)
+	}
+	return rule, true
+}
+
+// Ignored returns true if relPath, relative to the directory of the rules, is ignored.
+// As with git, paths within an ignored directory are ignored, even if a later rule would include them.
+func (r *IgnoreRules) Ignored(relPath string, isDir bool) bool {
+	if r == nil {
+		return false
+	}
+	segments := strings.Split(filepath.ToSlash(filepath.Clean(relPath)), "/")
+	for i := 1; i < len(segments); i++ {
+		if r.match(segments[:i], true) {
+			return true
+		}
+	}
+	return r.match(segments, isDir)
+}
+
+func (r *IgnoreRules) match(segments []string, isDir bool) bool {
+	ignored := false
+	for _, rule := range r.rules {
+		if rule.dirOnly && !isDir {
+			continue
+		}
+		if matchSegments(rule.segments, segments) {
+			ignored = !rule.negate
+		}
+	}
+	return ignored
+}
+
+func matchSegments(pattern, segments []string) bool {
+	if len(pattern) == 0 {
+		return len(segments) == 0
+	}
+	if pattern[0] == "**" {
+		if len(pattern) == 1 {
+			// a trailing "/**" matches everything inside, but not the directory itself
+			return len(segments) > 0
+		}
+		for i := 0; i <= len(segments); i++ {
+			if matchSegments(pattern[1:], segments[i:]) {
+				return true
+			}
+		}
+		return false
+	}
+	if len(segments) == 0 {
+		return false
+	}
+	if ok, err := path.Match(pattern[0], segments[0]); err != nil || !ok {
+		return false
+	}
+	return matchSegments(pattern[1:], segments[1:])
+}
+
+// CountFiles returns the number of files, other than directories, at or within path.
+func CountFiles(path string, fi os.FileInfo) (int, error) {
+	if !fi.IsDir() {
+		return 1, nil
+	}
+	count := 0
+	err := filepath.Walk(path, func(_ string, fi os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if !fi.IsDir() {
+			count++
+		}
+		return nil
+	})
+	return count, err
+}
@@ -0,0 +1,117 @@
+package layers_test
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/sclevine/spec"
+	"github.com/sclevine/spec/report"
+
+	"github.com/buildpacks/lifecycle/layers"
+	h "github.com/buildpacks/lifecycle/testhelpers"
+)
+
+func TestIgnoreRules(t *testing.T) {
+	spec.Run(t, "IgnoreRules", testIgnoreRules, spec.Parallel(), spec.Report(report.Terminal{}))
+}
+
+func testIgnoreRules(t *testing.T, when spec.G, it spec.S) {
+	when("#Ignored", func() {
+		it("matches patterns without a slash at any depth", func() {
+			rules := layers.NewIgnoreRules([]string{"*.log", "node_modules"})
+
+			h.AssertEq(t, rules.Ignored("debug.log", false), true)
+			h.AssertEq(t, rules.Ignored(filepath.Join("some", "dir", "debug.log"), false), true)
+			h.AssertEq(t, rules.Ignored(filepath.Join("web", "node_modules"), true), true)
+			h.AssertEq(t, rules.Ignored("debug.txt", false), false)
+		})
+
+		it("matches patterns with a slash relative to the directory", func() {
+			rules := layers.NewIgnoreRules([]string{"/build", "docs/*.md"})
+
+			h.AssertEq(t, rules.Ignored("build", true), true)
+			h.AssertEq(t, rules.Ignored(filepath.Join("src", "build"), true), false)
+			h.AssertEq(t, rules.Ignored(filepath.Join("docs", "index.md"), false), true)
+			h.AssertEq(t, rules.Ignored(filepath.Join("docs", "api", "index.md"), false), false)
+		})
+
+		it("matches double asterisks across directories", func() {
+			rules := layers.NewIgnoreRules([]string{"**/fixtures", "a/**/z", "tmp/**"})
+
+			h.AssertEq(t, rules.Ignored(filepath.Join("test", "fixtures"), true), true)
+			h.AssertEq(t, rules.Ignored(filepath.Join("a", "z"), false), true)
+			h.AssertEq(t, rules.Ignored(filepath.Join("a", "b", "c", "z"), false), true)
+			h.AssertEq(t, rules.Ignored(filepath.Join("tmp", "file"), false), true)
+			h.AssertEq(t, rules.Ignored("tmp", true), false)
+		})
+
+		it("matches patterns with a trailing slash only against directories", func() {
+			rules := layers.NewIgnoreRules([]string{"cache/"})
+
+			h.AssertEq(t, rules.Ignored("cache", true), true)
+			h.AssertEq(t, rules.Ignored("cache", false), false)
+		})
+
+		it("uses the last matching rule", func() {
+			rules := layers.NewIgnoreRules([]string{"*.md", "!README.md", "docs/README.md"})
+
+			h.AssertEq(t, rules.Ignored("CHANGELOG.md", false), true)
+			h.AssertEq(t, rules.Ignored("README.md", false), false)
+			h.AssertEq(t, rules.Ignored(filepath.Join("docs", "README.md"), false), true)
+		})
+
+		it("does not include paths within an ignored directory", func() {
+			rules := layers.NewIgnoreRules([]string{"vendor/", "!vendor/keep.go"})
+
+			h.AssertEq(t, rules.Ignored(filepath.Join("vendor", "keep.go"), false), true)
+		})
+
+		it("skips comments and blank lines and unescapes special characters", func() {
+			rules := layers.NewIgnoreRules([]string{"# comment", "", `\#file`, `\!important`, "trailing   "})
+
+			h.AssertEq(t, rules.Ignored("# comment", false), false)
+			h.AssertEq(t, rules.Ignored("#file", false), true)
+			h.AssertEq(t, rules.Ignored("!important", false), true)
+			h.AssertEq(t, rules.Ignored("trailing", false), true)
+		})
+
+		it("matches nothing when there are no rules", func() {
+			var rules *layers.IgnoreRules
+
+			h.AssertEq(t, rules.Ignored("anything", false), false)
+		})
+	})
+
+	when("#ReadIgnoreFile", func() {
+		var tmpDir string
+
+		it.Before(func() {
+			var err error
+			tmpDir, err = ioutil.TempDir("", "layers.ignore")
+			h.AssertNil(t, err)
+		})
+
+		it.After(func() {
+			os.RemoveAll(tmpDir)
+		})
+
+		it("reads one rule per line", func() {
+			path := filepath.Join(tmpDir, ".cnbignore")
+			h.Mkfile(t, "# dependencies\nnode_modules/\r\n*.log\n", path)
+
+			rules, err := layers.ReadIgnoreFile(path)
+			h.AssertNil(t, err)
+			h.AssertEq(t, rules.Ignored("node_modules", true), true)
+			h.AssertEq(t, rules.Ignored("npm-debug.log", false), true)
+		})
+
+		it("returns no rules when the file does not exist", func() {
+			rules, err := layers.ReadIgnoreFile(filepath.Join(tmpDir, "missing"))
+			h.AssertNil(t, err)
+			h.AssertEq(t, rules == nil, true)
+		})
+	})
+
+}
@@ -22,16 +22,20 @@ type Slice struct {
 // * The first n layers will contain files matched by the any Path in the nth Slice
 // * The final layer will contain any files in dir that were not included in a previous layer
 // Some layers may be empty
+// Files in dir matched by the factory's ignore rules are not included in any layer
 func (f *Factory) SliceLayers(dir string, slices []Slice) ([]Layer, error) {
 	var sliceLayers []Layer
 	dir, err := filepath.Abs(dir)
 	if err != nil {
 		return nil, err
 	}
-	sdir, err := newSlicableDir(dir)
+	sdir, err := newSlicableDir(dir, f.Ignore)
 	if err != nil {
 		return nil, err
 	}
+	if sdir.ignoredFiles > 0 {
+		f.Logger.Infof("Excluding %d app files matching ignore rules", sdir.ignoredFiles)
+	}
 
 	//add one layer per slice
 	for i, slice := range slices {
@@ -110,14 +114,15 @@ func (f *Factory) createLayerFromFiles(layerID string, sdir *sliceableDir, files
 }
 
 type sliceableDir struct {
-	path        string                 // path to slicableDir
-	slicedFiles map[string]bool        // map showing which paths are already sliced
-	pathInfos   map[string]os.FileInfo // map of path to file info
-	subDirs     map[string][]string    // map dirs to children
-	parentDirs  []archive.PathInfo     // parents of the slicableDir
+	path         string                 // path to slicableDir
+	slicedFiles  map[string]bool        // map showing which paths are already sliced
+	pathInfos    map[string]os.FileInfo // map of path to file info
+	subDirs      map[string][]string    // map dirs to children
+	parentDirs   []archive.PathInfo     // parents of the slicableDir
+	ignoredFiles int                    // number of files left out by the ignore rules
 }
 
-func newSlicableDir(appDir string) (*sliceableDir, error) {
+func newSlicableDir(appDir string, ignore *IgnoreRules) (*sliceableDir, error) {
 	sdir := &sliceableDir{
 		path:        appDir,
 		slicedFiles: map[string]bool{},
@@ -128,6 +133,23 @@ func newSlicableDir(appDir string) (*sliceableDir, error) {
 		if err != nil {
 			return err
 		}
+		if path != appDir {
+			relPath, err := filepath.Rel(appDir, path)
+			if err != nil {
+				return err
+			}
+			if ignore.Ignored(relPath, fi.IsDir()) {
+				n, err := CountFiles(path, fi)
+				if err != nil {
+					return err
+				}
+				sdir.ignoredFiles += n
+				if fi.IsDir() {
+					return filepath.SkipDir
+				}
+				return nil
+			}
+		}
 		sdir.slicedFiles[path] = false
 		sdir.pathInfos[path] = fi
 		if fi.IsDir() {
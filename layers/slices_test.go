@@ -8,6 +8,8 @@ import (
 	"runtime"
 	"testing"
 
+	"github.com/apex/log"
+	"github.com/apex/log/handlers/memory"
 	"github.com/sclevine/spec"
 	"github.com/sclevine/spec/report"
 
@@ -391,5 +393,76 @@ func testSlices(t *testing.T, when spec.G, it spec.S) {
 				}...))
 			})
 		})
+
+		when("there are ignore rules", func() {
+			var logHandler *memory.Handler
+
+			it.Before(func() {
+				logHandler = memory.New()
+				factory.Logger = &log.Logger{Handler: logHandler}
+				factory.Ignore = layers.NewIgnoreRules([]string{"other-dir/", "*.md"})
+			})
+
+			it("leaves the ignored files out of every layer", func() {
+				sliceLayers, err := factory.SliceLayers(dirToSlice, []layers.Slice{
+					{Paths: []string{"some-dir"}},
+				})
+				h.AssertNil(t, err)
+				h.AssertEq(t, len(sliceLayers), 2)
+				assertTarEntries(t, sliceLayers[0].TarPath, append(parents(t, dirToSlice), []*tar.Header{
+					{
+						Name:     tarPath(dirToSlice),
+						Uid:      factory.UID,
+						Gid:      factory.GID,
+						Typeflag: tar.TypeDir,
+					},
+					{
+						Name:     tarPath(filepath.Join(dirToSlice, "some-dir")),
+						Uid:      factory.UID,
+						Gid:      factory.GID,
+						Typeflag: tar.TypeDir,
+					},
+					{
+						Name:     tarPath(filepath.Join(dirToSlice, "some-dir", "some-file.txt")),
+						Uid:      factory.UID,
+						Gid:      factory.GID,
+						Typeflag: tar.TypeReg,
+					},
+				}...))
+				assertTarEntries(t, sliceLayers[1].TarPath, append(parents(t, dirToSlice), []*tar.Header{
+					{
+						Name:     tarPath(dirToSlice),
+						Uid:      factory.UID,
+						Gid:      factory.GID,
+						Typeflag: tar.TypeDir,
+					},
+					{
+						Name:     tarPath(filepath.Join(dirToSlice, "dir-link")),
+						Uid:      factory.UID,
+						Gid:      factory.GID,
+						Typeflag: tar.TypeSymlink,
+					},
+					{
+						Name:     tarPath(filepath.Join(dirToSlice, "file-link.txt")),
+						Uid:      factory.UID,
+						Gid:      factory.GID,
+						Typeflag: tar.TypeSymlink,
+					},
+					{
+						Name:     tarPath(filepath.Join(dirToSlice, "file.txt")),
+						Uid:      factory.UID,
+						Gid:      factory.GID,
+						Typeflag: tar.TypeReg,
+					},
+				}...))
+			})
+
+			it("logs the number of excluded files", func() {
+				_, err := factory.SliceLayers(dirToSlice, nil)
+				h.AssertNil(t, err)
+				h.AssertEq(t, len(logHandler.Entries), 1)
+				h.AssertEq(t, logHandler.Entries[0].Message, "Excluding 3 app files matching ignore rules")
+			})
+		})
 	})
 }
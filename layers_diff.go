@@ -0,0 +1,120 @@
+package lifecycle
+
+import (
+	"fmt"
+	"sort"
+)
+
+const (
+	LayerAdded   = "added"
+	LayerChanged = "changed"
+	LayerRemoved = "removed"
+	LayerReused  = "reused"
+)
+
+// LayersDiffReport describes how the layers of the exported image differ from the previous image.
+type LayersDiffReport struct {
+	AppChanged bool        `toml:"app-changed"`
+	Layers     []LayerDiff `toml:"layer"`
+}
+
+// LayerDiff describes a single layer of the exported or previous image.
+// Size is the size of the new layer tarball when it was written by the exporter.
+type LayerDiff struct {
+	ID     string `toml:"id"`
+	Status string `toml:"status"`
+	OldSHA string `toml:"old-sha,omitempty"`
+	NewSHA string `toml:"new-sha,omitempty"`
+	Size   int64  `toml:"size,omitzero"`
+}
+
+func appLayerID(i int) string {
+	return fmt.Sprintf("app:%d", i+1)
+}
+
+func (e *Exporter) diffLayers(orig, meta LayersMetadata) *LayersDiffReport {
+	sizes := map[string]int64{}
+	for _, l := range e.layerSizes {
+		sizes[l.id] = l.size
+	}
+	report := &LayersDiffReport{}
+	add := func(id, oldSHA, newSHA string) {
+		diff := LayerDiff{ID: id, OldSHA: oldSHA, NewSHA: newSHA, Size: sizes[id]}
+		switch {
+		case newSHA == "":
+			diff.Status = LayerRemoved
+		case oldSHA == "":
+			diff.Status = LayerAdded
+		case oldSHA == newSHA:
+			diff.Status = LayerReused
+		default:
+			diff.Status = LayerChanged
+		}
+		report.Layers = append(report.Layers, diff)
+	}
+
+	for _, bp := range meta.Buildpacks {
+		origLayers := orig.MetadataForBuildpack(bp.ID).Layers
+		for _, name := range sortedLayerNames(bp.Layers) {
+			add(bp.ID+":"+name, origLayers[name].SHA, bp.Layers[name].SHA)
+		}
+		for _, name := range sortedLayerNames(origLayers) {
+			if _, ok := bp.Layers[name]; !ok {
+				add(bp.ID+":"+name, origLayers[name].SHA, "")
+			}
+		}
+	}
+	for _, bp := range orig.Buildpacks {
+		if meta.MetadataForBuildpack(bp.ID).ID != "" {
+			continue
+		}
+		for _, name := range sortedLayerNames(bp.Layers) {
+			add(bp.ID+":"+name, bp.Layers[name].SHA, "")
+		}
+	}
+
+	origApp := map[string]bool{}
+	for _, l := range orig.App {
+		origApp[l.SHA] = true
+	}
+	for i, l := range meta.App {
+		var oldSHA string
+		if origApp[l.SHA] {
+			oldSHA = l.SHA
+		} else if i < len(orig.App) {
+			oldSHA = orig.App[i].SHA
+		}
+		if oldSHA != l.SHA {
+			report.AppChanged = true
+		}
+		add(appLayerID(i), oldSHA, l.SHA)
+	}
+	for i := len(meta.App); i < len(orig.App); i++ {
+		report.AppChanged = true
+		add(appLayerID(i), orig.App[i].SHA, "")
+	}
+
+	for _, l := range []struct {
+		id           string
+		orig, latest LayerMetadata
+	}{
+		{"launcher", orig.Launcher, meta.Launcher},
+		{"config", orig.Config, meta.Config},
+		{"process-types", orig.ProcessTypes, meta.ProcessTypes},
+	} {
+		if l.orig.SHA == "" && l.latest.SHA == "" {
+			continue
+		}
+		add(l.id, l.orig.SHA, l.latest.SHA)
+	}
+	return report
+}
+
+func sortedLayerNames(layers map[string]BuildpackLayerMetadata) []string {
+	var names []string
+	for name := range layers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
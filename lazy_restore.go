@@ -0,0 +1,64 @@
+package lifecycle
+
+import (
+	"os"
+
+	"github.com/BurntSushi/toml"
+	"github.com/pkg/errors"
+
+	"github.com/buildpacks/lifecycle/layers"
+)
+
+// LazyRestoreMarker is written next to the metadata of a cached layer whose data was not restored.
+// The layer data can be restored on demand with RestoreLazyLayer.
+type LazyRestoreMarker struct {
+	SHA   string `toml:"sha"`
+	Cache string `toml:"cache"` // Cache is the URL of the cache holding the layer data
+}
+
+func lazyRestoreMarkerPath(layerPath string) string {
+	return layerPath + ".restore"
+}
+
+// ReadLazyRestoreMarker returns the restore marker of the layer at layerPath, if the layer data has not been restored.
+func ReadLazyRestoreMarker(layerPath string) (LazyRestoreMarker, bool, error) {
+	var marker LazyRestoreMarker
+	if _, err := toml.DecodeFile(lazyRestoreMarkerPath(layerPath), &marker); err != nil {
+		if os.IsNotExist(err) {
+			return LazyRestoreMarker{}, false, nil
+		}
+		return LazyRestoreMarker{}, false, errors.Wrapf(err, "reading restore marker for '%s'", layerPath)
+	}
+	return marker, true, nil
+}
+
+// RestoreLazyLayer restores the data of the layer at layerPath from the cache and removes its restore marker.
+// Layers that have already been restored are left untouched.
+func RestoreLazyLayer(layerPath string, cache Cache) error {
+	marker, ok, err := ReadLazyRestoreMarker(layerPath)
+	if err != nil || !ok {
+		return err
+	}
+	rc, err := cache.RetrieveLayer(marker.SHA)
+	if err != nil {
+		return err
+	}
+	defer rc.Close()
+	if err := layers.Extract(rc, ""); err != nil {
+		return errors.Wrapf(err, "restoring '%s'", layerPath)
+	}
+	return os.Remove(lazyRestoreMarkerPath(layerPath))
+}
+
+// notRestored returns the restore marker of the layer if its data was never restored.
+// A layer that the buildpack recreated without restoring it is treated as restored.
+func (bp *bpLayer) notRestored() (LazyRestoreMarker, bool) {
+	if bp.hasLocalContents() {
+		return LazyRestoreMarker{}, false
+	}
+	marker, ok, err := ReadLazyRestoreMarker(bp.path)
+	if err != nil {
+		return LazyRestoreMarker{}, false
+	}
+	return marker, ok
+}
@@ -17,6 +17,7 @@ const (
 
 type BuildMetadata struct {
 	BOM        []BOMEntry       `toml:"bom" json:"bom"`
+	BuildBOM   []BOMEntry       `toml:"build-bom,omitempty" json:"-"`
 	Buildpacks []GroupBuildpack `toml:"buildpacks" json:"buildpacks"`
 	Labels     []Label          `toml:"labels" json:"-"`
 	Launcher   LauncherMetadata `toml:"-" json:"launcher"`
@@ -91,6 +92,7 @@ type LayersMetadataCompat struct {
 type AnalyzedMetadata struct {
 	Image    *ImageIdentifier `toml:"image"`
 	Metadata LayersMetadata   `toml:"metadata"`
+	RunImage *RunImageDrift   `toml:"run-image,omitempty"`
 }
 
 // FIXME: fix key names to be accurate in the daemon case
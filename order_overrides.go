@@ -0,0 +1,149 @@
+package lifecycle
+
+import (
+	"os"
+
+	"github.com/BurntSushi/toml"
+	"github.com/pkg/errors"
+)
+
+// OrderOverrides is the platform's file of per-app changes to the buildpack order.
+// Overrides apply to the groups of the top-level order, not to the orders of meta-buildpacks.
+type OrderOverrides struct {
+	// Include are buildpack IDs that must participate. Groups without them are removed, and they are no longer optional.
+	Include []string `toml:"include"`
+	// Exclude are buildpack IDs that are removed from every group.
+	Exclude []string       `toml:"exclude"`
+	Pin     []BuildpackPin `toml:"pin"`
+}
+
+// BuildpackPin replaces the version of a buildpack wherever it appears in the order.
+type BuildpackPin struct {
+	ID      string `toml:"id"`
+	Version string `toml:"version"`
+}
+
+// ReadOrderOverrides reads the overrides at path. A missing file makes no changes.
+func ReadOrderOverrides(path string) (OrderOverrides, error) {
+	var overrides OrderOverrides
+	if path == "" {
+		return overrides, nil
+	}
+	if _, err := toml.DecodeFile(path, &overrides); err != nil {
+		if os.IsNotExist(err) {
+			return OrderOverrides{}, nil
+		}
+		return OrderOverrides{}, err
+	}
+	return overrides, nil
+}
+
+func (o OrderOverrides) Empty() bool {
+	return len(o.Include) == 0 && len(o.Exclude) == 0 && len(o.Pin) == 0
+}
+
+// Apply returns order with the overrides applied. Every overridden buildpack must be in order,
+// and pinned versions must exist in buildpacksDir.
+func (o OrderOverrides) Apply(order BuildpackOrder, buildpacksDir string) (BuildpackOrder, error) {
+	for _, id := range o.Include {
+		if containsString(o.Exclude, id) {
+			return nil, errors.Errorf("buildpack '%s' is both included and excluded", id)
+		}
+		if !order.hasID(id) {
+			return nil, order.missingIDError("included", id, buildpacksDir)
+		}
+	}
+	for _, id := range o.Exclude {
+		if !order.hasID(id) {
+			return nil, order.missingIDError("excluded", id, buildpacksDir)
+		}
+	}
+	pins := map[string]string{}
+	for _, pin := range o.Pin {
+		if !order.hasID(pin.ID) {
+			return nil, order.missingIDError("pinned", pin.ID, buildpacksDir)
+		}
+		if containsString(o.Exclude, pin.ID) {
+			return nil, errors.Errorf("buildpack '%s' is both pinned and excluded", pin.ID)
+		}
+		bp := GroupBuildpack{ID: pin.ID, Version: pin.Version}
+		if _, err := bp.Lookup(buildpacksDir); err != nil {
+			return nil, errors.Wrapf(err, "pinned buildpack '%s' is not in the buildpacks directory", bp)
+		}
+		pins[pin.ID] = pin.Version
+	}
+
+	var out BuildpackOrder
+	for _, group := range order {
+		if !group.hasIDs(o.Include) {
+			continue
+		}
+		var bps []GroupBuildpack
+		for _, bp := range group.Group {
+			if containsString(o.Exclude, bp.ID) {
+				continue
+			}
+			if containsString(o.Include, bp.ID) {
+				bp.Optional = false
+			}
+			if version, ok := pins[bp.ID]; ok {
+				bp.Version = version
+			}
+			bps = append(bps, bp)
+		}
+		if len(bps) > 0 {
+			out = append(out, BuildpackGroup{Group: bps})
+		}
+	}
+	if len(out) == 0 {
+		return nil, errors.New("no buildpack groups remain after applying order overrides")
+	}
+	return out, nil
+}
+
+func (bo BuildpackOrder) hasID(id string) bool {
+	for _, group := range bo {
+		if hasID(group.Group, id) {
+			return true
+		}
+	}
+	return false
+}
+
+// missingIDError explains why the buildpack with id, which is not in the top-level order, cannot be overridden.
+func (bo BuildpackOrder) missingIDError(kind, id, buildpacksDir string) error {
+	if bo.hasNestedID(id, buildpacksDir, map[string]bool{}) {
+		return errors.Errorf("%s buildpack '%s' is only in the order of a meta-buildpack, which order overrides do not support", kind, id)
+	}
+	return errors.Errorf("%s buildpack '%s' is not in the order", kind, id)
+}
+
+// hasNestedID returns true if id is in the order of a meta-buildpack within bo, at any depth.
+// Buildpacks that cannot be found in buildpacksDir are skipped.
+func (bo BuildpackOrder) hasNestedID(id, buildpacksDir string, seen map[string]bool) bool {
+	for _, group := range bo {
+		for _, bp := range group.Group {
+			if seen[bp.String()] {
+				continue
+			}
+			seen[bp.String()] = true
+			bpTOML, err := bp.Lookup(buildpacksDir)
+			if err != nil {
+				continue
+			}
+			if bpTOML.Order.hasID(id) || bpTOML.Order.hasNestedID(id, buildpacksDir, seen) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func (bg BuildpackGroup) hasIDs(ids []string) bool {
+	for _, id := range ids {
+		if !hasID(bg.Group, id) {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,145 @@
+package lifecycle_test
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/sclevine/spec"
+	"github.com/sclevine/spec/report"
+
+	"github.com/buildpacks/lifecycle"
+	h "github.com/buildpacks/lifecycle/testhelpers"
+)
+
+func TestOrderOverrides(t *testing.T) {
+	spec.Run(t, "OrderOverrides", testOrderOverrides, spec.Report(report.Terminal{}))
+}
+
+func testOrderOverrides(t *testing.T, when spec.G, it spec.S) {
+	var (
+		order         lifecycle.BuildpackOrder
+		buildpacksDir = filepath.Join("testdata", "by-id")
+	)
+
+	it.Before(func() {
+		order = lifecycle.BuildpackOrder{
+			{Group: []lifecycle.GroupBuildpack{{ID: "A", Version: "v1"}, {ID: "B", Version: "v1", Optional: true}}},
+			{Group: []lifecycle.GroupBuildpack{{ID: "B", Version: "v1"}, {ID: "C", Version: "v1"}}},
+			{Group: []lifecycle.GroupBuildpack{{ID: "D", Version: "v1"}}},
+		}
+	})
+
+	when("#ReadOrderOverrides", func() {
+		var tmpDir string
+
+		it.Before(func() {
+			var err error
+			tmpDir, err = ioutil.TempDir("", "order-overrides")
+			h.AssertNil(t, err)
+		})
+
+		it.After(func() {
+			os.RemoveAll(tmpDir)
+		})
+
+		it("reads the overrides", func() {
+			path := filepath.Join(tmpDir, "order-overrides.toml")
+			h.Mkfile(t, `include = ["B"]
+exclude = ["C"]
+
+[[pin]]
+id = "A"
+version = "v2"
+`, path)
+
+			overrides, err := lifecycle.ReadOrderOverrides(path)
+			h.AssertNil(t, err)
+			h.AssertEq(t, overrides, lifecycle.OrderOverrides{
+				Include: []string{"B"},
+				Exclude: []string{"C"},
+				Pin:     []lifecycle.BuildpackPin{{ID: "A", Version: "v2"}},
+			})
+		})
+
+		it("returns empty overrides when the file does not exist", func() {
+			overrides, err := lifecycle.ReadOrderOverrides(filepath.Join(tmpDir, "missing.toml"))
+			h.AssertNil(t, err)
+			h.AssertEq(t, overrides.Empty(), true)
+		})
+	})
+
+	when("#Apply", func() {
+		it("removes excluded buildpacks and groups left empty", func() {
+			out, err := lifecycle.OrderOverrides{Exclude: []string{"C", "D"}}.Apply(order, buildpacksDir)
+			h.AssertNil(t, err)
+			h.AssertEq(t, out, lifecycle.BuildpackOrder{
+				{Group: []lifecycle.GroupBuildpack{{ID: "A", Version: "v1"}, {ID: "B", Version: "v1", Optional: true}}},
+				{Group: []lifecycle.GroupBuildpack{{ID: "B", Version: "v1"}}},
+			})
+		})
+
+		it("keeps only groups with included buildpacks and makes them required", func() {
+			out, err := lifecycle.OrderOverrides{Include: []string{"B"}}.Apply(order, buildpacksDir)
+			h.AssertNil(t, err)
+			h.AssertEq(t, out, lifecycle.BuildpackOrder{
+				{Group: []lifecycle.GroupBuildpack{{ID: "A", Version: "v1"}, {ID: "B", Version: "v1"}}},
+				{Group: []lifecycle.GroupBuildpack{{ID: "B", Version: "v1"}, {ID: "C", Version: "v1"}}},
+			})
+		})
+
+		it("pins versions", func() {
+			out, err := lifecycle.OrderOverrides{Pin: []lifecycle.BuildpackPin{{ID: "B", Version: "v2"}}}.Apply(order, buildpacksDir)
+			h.AssertNil(t, err)
+			h.AssertEq(t, out, lifecycle.BuildpackOrder{
+				{Group: []lifecycle.GroupBuildpack{{ID: "A", Version: "v1"}, {ID: "B", Version: "v2", Optional: true}}},
+				{Group: []lifecycle.GroupBuildpack{{ID: "B", Version: "v2"}, {ID: "C", Version: "v1"}}},
+				{Group: []lifecycle.GroupBuildpack{{ID: "D", Version: "v1"}}},
+			})
+		})
+
+		it("fails when a pinned buildpack is not in the order", func() {
+			_, err := lifecycle.OrderOverrides{Pin: []lifecycle.BuildpackPin{{ID: "E", Version: "v1"}}}.Apply(order, buildpacksDir)
+			h.AssertError(t, err, "pinned buildpack 'E' is not in the order")
+		})
+
+		it("fails when a pinned version is not in the buildpacks directory", func() {
+			_, err := lifecycle.OrderOverrides{Pin: []lifecycle.BuildpackPin{{ID: "B", Version: "v3"}}}.Apply(order, buildpacksDir)
+			h.AssertError(t, err, "pinned buildpack 'B@v3' is not in the buildpacks directory")
+		})
+
+		it("fails when an included buildpack is not in the order", func() {
+			_, err := lifecycle.OrderOverrides{Include: []string{"E"}}.Apply(order, buildpacksDir)
+			h.AssertError(t, err, "included buildpack 'E' is not in the order")
+		})
+
+		it("fails when an excluded buildpack is not in the order", func() {
+			_, err := lifecycle.OrderOverrides{Exclude: []string{"E"}}.Apply(order, buildpacksDir)
+			h.AssertError(t, err, "excluded buildpack 'E' is not in the order")
+		})
+
+		it("fails with a clear error when an overridden buildpack is only in a meta-buildpack", func() {
+			order = lifecycle.BuildpackOrder{{Group: []lifecycle.GroupBuildpack{{ID: "E", Version: "v1"}}}}
+
+			_, err := lifecycle.OrderOverrides{Include: []string{"C"}}.Apply(order, buildpacksDir)
+			h.AssertError(t, err, "included buildpack 'C' is only in the order of a meta-buildpack, which order overrides do not support")
+
+			_, err = lifecycle.OrderOverrides{Pin: []lifecycle.BuildpackPin{{ID: "F", Version: "v1"}}}.Apply(order, buildpacksDir)
+			h.AssertError(t, err, "pinned buildpack 'F' is only in the order of a meta-buildpack, which order overrides do not support")
+
+			_, err = lifecycle.OrderOverrides{Exclude: []string{"C"}}.Apply(order, buildpacksDir)
+			h.AssertError(t, err, "excluded buildpack 'C' is only in the order of a meta-buildpack, which order overrides do not support")
+		})
+
+		it("fails when a buildpack is both included and excluded", func() {
+			_, err := lifecycle.OrderOverrides{Include: []string{"B"}, Exclude: []string{"B"}}.Apply(order, buildpacksDir)
+			h.AssertError(t, err, "buildpack 'B' is both included and excluded")
+		})
+
+		it("fails when no groups remain", func() {
+			_, err := lifecycle.OrderOverrides{Include: []string{"A", "C"}}.Apply(order, buildpacksDir)
+			h.AssertError(t, err, "no buildpack groups remain after applying order overrides")
+		})
+	})
+}
@@ -0,0 +1,313 @@
+package lifecycle
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/buildpacks/imgutil"
+	"github.com/pkg/errors"
+)
+
+const (
+	InTotoStatementType     = "https://in-toto.io/Statement/v0.1"
+	InTotoPayloadType       = "application/vnd.in-toto+json"
+	SLSAProvenancePredicate = "https://slsa.dev/provenance/v0.1"
+	ProvenanceBuildType     = "https://buildpacks.io/lifecycle/export@v1"
+)
+
+type ProvenanceStatement struct {
+	Type          string              `json:"_type"`
+	Subject       []ProvenanceSubject `json:"subject"`
+	PredicateType string              `json:"predicateType"`
+	Predicate     ProvenancePredicate `json:"predicate"`
+}
+
+type ProvenanceSubject struct {
+	Name   string            `json:"name"`
+	Digest map[string]string `json:"digest"`
+}
+
+type ProvenancePredicate struct {
+	Builder   ProvenanceBuilder    `json:"builder"`
+	Recipe    ProvenanceRecipe     `json:"recipe"`
+	Materials []ProvenanceMaterial `json:"materials,omitempty"`
+}
+
+type ProvenanceBuilder struct {
+	ID string `json:"id"`
+}
+
+type ProvenanceRecipe struct {
+	Type        string                  `json:"type"`
+	Arguments   ProvenanceBuildpacks    `json:"arguments"`
+	Environment ProvenanceImageContents `json:"environment"`
+}
+
+type ProvenanceBuildpacks struct {
+	Buildpacks []GroupBuildpack `json:"buildpacks"`
+}
+
+type ProvenanceImageContents struct {
+	BOM    []ProvenanceBOMEntry `json:"bom,omitempty"`
+	Layers map[string]string    `json:"layers"`
+}
+
+const (
+	BOMScopeBuild  = "build"
+	BOMScopeLaunch = "launch"
+)
+
+// ProvenanceBOMEntry is a BOM entry marked with whether the dependency is in the image (launch) or was only used to build it (build).
+type ProvenanceBOMEntry struct {
+	BOMEntry
+	Scope string `json:"scope"`
+}
+
+type ProvenanceMaterial struct {
+	URI    string            `json:"uri"`
+	Digest map[string]string `json:"digest,omitempty"`
+}
+
+// DSSEEnvelope is a signed in-toto statement, see https://github.com/secure-systems-lab/dsse
+type DSSEEnvelope struct {
+	PayloadType string          `json:"payloadType"`
+	Payload     string          `json:"payload"`
+	Signatures  []DSSESignature `json:"signatures"`
+}
+
+type DSSESignature struct {
+	KeyID string `json:"keyid"`
+	Sig   string `json:"sig"`
+}
+
+// NewProvenance builds an in-toto provenance statement for a saved image from the metadata labels the exporter set on it.
+func NewProvenance(image imgutil.Image, report ExportReport) (ProvenanceStatement, error) {
+	var layersMD LayersMetadata
+	if err := DecodeLabel(image, LayerMetadataLabel, &layersMD); err != nil {
+		return ProvenanceStatement{}, err
+	}
+	var buildMD BuildMetadata
+	if err := DecodeLabel(image, BuildMetadataLabel, &buildMD); err != nil {
+		return ProvenanceStatement{}, err
+	}
+	var projectMD ProjectMetadata
+	if err := DecodeLabel(image, ProjectMetadataLabel, &projectMD); err != nil {
+		return ProvenanceStatement{}, err
+	}
+
+	digest := report.Image.Digest
+	if digest == "" {
+		digest = report.Image.ImageID
+	}
+	if digest == "" {
+		return ProvenanceStatement{}, errors.New("image has no digest or ID to attest")
+	}
+	var subjects []ProvenanceSubject
+	for _, tag := range report.Image.Tags {
+		subjects = append(subjects, ProvenanceSubject{Name: tag, Digest: digestMap(digest)})
+	}
+
+	var materials []ProvenanceMaterial
+	if source := projectSourceMaterial(projectMD); source != nil {
+		materials = append(materials, *source)
+	}
+	if ref := layersMD.RunImage.Reference; ref != "" {
+		material := ProvenanceMaterial{URI: ref}
+		if strings.Contains(ref, "@") { // the reference is an image ID when the run image was not pulled from a registry
+			material.Digest = digestMap(referenceDigest(ref))
+		}
+		materials = append(materials, material)
+	}
+
+	return ProvenanceStatement{
+		Type:          InTotoStatementType,
+		Subject:       subjects,
+		PredicateType: SLSAProvenancePredicate,
+		Predicate: ProvenancePredicate{
+			Builder: ProvenanceBuilder{ID: builderID(buildMD.Launcher)},
+			Recipe: ProvenanceRecipe{
+				Type:      ProvenanceBuildType,
+				Arguments: ProvenanceBuildpacks{Buildpacks: buildMD.Buildpacks},
+				Environment: ProvenanceImageContents{
+					BOM:    append(scopedBOM(buildMD.BOM, BOMScopeLaunch), scopedBOM(report.Build.BOM, BOMScopeBuild)...),
+					Layers: layerDigests(layersMD),
+				},
+			},
+			Materials: materials,
+		},
+	}, nil
+}
+
+func scopedBOM(bom []BOMEntry, scope string) []ProvenanceBOMEntry {
+	var out []ProvenanceBOMEntry
+	for _, entry := range bom {
+		out = append(out, ProvenanceBOMEntry{BOMEntry: entry, Scope: scope})
+	}
+	return out
+}
+
+func builderID(launcher LauncherMetadata) string {
+	id := "lifecycle@" + launcher.Version
+	if launcher.Source.Git.Repository != "" {
+		id = launcher.Source.Git.Repository + "@" + launcher.Version
+	}
+	return id
+}
+
+func projectSourceMaterial(projectMD ProjectMetadata) *ProvenanceMaterial {
+	if projectMD.Source == nil {
+		return nil
+	}
+	repository, _ := projectMD.Source.Metadata["repository"].(string)
+	if repository == "" {
+		return nil
+	}
+	material := &ProvenanceMaterial{URI: repository}
+	if commit, ok := projectMD.Source.Version["commit"].(string); ok && commit != "" {
+		material.Digest = map[string]string{"sha1": commit}
+	}
+	return material
+}
+
+func layerDigests(md LayersMetadata) map[string]string {
+	layers := map[string]string{}
+	for _, bp := range md.Buildpacks {
+		for name, layer := range bp.Layers {
+			layers[bp.ID+":"+name] = layer.SHA
+		}
+	}
+	for i, app := range md.App {
+		layers[fmt.Sprintf("app:%d", i+1)] = app.SHA
+	}
+	if md.Config.SHA != "" {
+		layers["config"] = md.Config.SHA
+	}
+	if md.Launcher.SHA != "" {
+		layers["launcher"] = md.Launcher.SHA
+	}
+	if md.ProcessTypes.SHA != "" {
+		layers["process-types"] = md.ProcessTypes.SHA
+	}
+	return layers
+}
+
+func digestMap(digest string) map[string]string {
+	if digest == "" {
+		return nil
+	}
+	parts := strings.SplitN(digest, ":", 2)
+	if len(parts) != 2 {
+		return map[string]string{"sha256": digest}
+	}
+	return map[string]string{parts[0]: parts[1]}
+}
+
+// SignProvenance wraps the statement in a DSSE envelope signed with the PEM encoded PKCS8 private key at keyPath.
+// ECDSA, Ed25519 and RSA keys are supported.
+func SignProvenance(statement ProvenanceStatement, keyPath string) (DSSEEnvelope, error) {
+	payload, err := json.Marshal(statement)
+	if err != nil {
+		return DSSEEnvelope{}, errors.Wrap(err, "marshal provenance statement")
+	}
+	signer, err := readSigningKey(keyPath)
+	if err != nil {
+		return DSSEEnvelope{}, err
+	}
+
+	message := preAuthEncoding(InTotoPayloadType, payload)
+	var sig []byte
+	switch signer.(type) {
+	case ed25519.PrivateKey:
+		sig, err = signer.Sign(rand.Reader, message, crypto.Hash(0))
+	default:
+		hash := sha256.Sum256(message)
+		sig, err = signer.Sign(rand.Reader, hash[:], crypto.SHA256)
+	}
+	if err != nil {
+		return DSSEEnvelope{}, errors.Wrap(err, "sign provenance statement")
+	}
+
+	keyID, err := publicKeyID(signer.Public())
+	if err != nil {
+		return DSSEEnvelope{}, err
+	}
+	return DSSEEnvelope{
+		PayloadType: InTotoPayloadType,
+		Payload:     base64.StdEncoding.EncodeToString(payload),
+		Signatures: []DSSESignature{{
+			KeyID: keyID,
+			Sig:   base64.StdEncoding.EncodeToString(sig),
+		}},
+	}, nil
+}
+
+func readSigningKey(keyPath string) (crypto.Signer, error) {
+	data, err := ioutil.ReadFile(keyPath)
+	if err != nil {
+		return nil, errors.Wrap(err, "read signing key")
+	}
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, fmt.Errorf("signing key '%s' is not PEM encoded", keyPath)
+	}
+	key, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if err != nil {
+		return nil, errors.Wrapf(err, "parse signing key '%s'", keyPath)
+	}
+	switch k := key.(type) {
+	case *ecdsa.PrivateKey:
+		return k, nil
+	case ed25519.PrivateKey:
+		return k, nil
+	case *rsa.PrivateKey:
+		return k, nil
+	}
+	return nil, fmt.Errorf("signing key '%s' has unsupported type %T", keyPath, key)
+}
+
+// publicKeyID is the hex encoded SHA256 of the DER encoded public key
+func publicKeyID(pub crypto.PublicKey) (string, error) {
+	der, err := x509.MarshalPKIXPublicKey(pub)
+	if err != nil {
+		return "", errors.Wrap(err, "marshal public key")
+	}
+	return fmt.Sprintf("%x", sha256.Sum256(der)), nil
+}
+
+// preAuthEncoding is the DSSE v1 pre-authentication encoding of a payload
+func preAuthEncoding(payloadType string, payload []byte) []byte {
+	return []byte(fmt.Sprintf("DSSEv1 %d %s %d %s", len(payloadType), payloadType, len(payload), payload))
+}
+
+// WriteProvenance writes the statement to path, signed when keyPath is provided.
+func WriteProvenance(path string, statement ProvenanceStatement, keyPath string) error {
+	var out interface{} = statement
+	if keyPath != "" {
+		envelope, err := SignProvenance(statement, keyPath)
+		if err != nil {
+			return err
+		}
+		out = envelope
+	}
+	data, err := json.MarshalIndent(out, "", "  ")
+	if err != nil {
+		return errors.Wrap(err, "marshal provenance")
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0777); err != nil {
+		return err
+	}
+	return ioutil.WriteFile(path, data, 0644)
+}
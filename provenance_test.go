@@ -0,0 +1,201 @@
+package lifecycle_test
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/buildpacks/imgutil/fakes"
+	"github.com/sclevine/spec"
+	"github.com/sclevine/spec/report"
+
+	"github.com/buildpacks/lifecycle"
+	h "github.com/buildpacks/lifecycle/testhelpers"
+)
+
+func TestProvenance(t *testing.T) {
+	spec.Run(t, "Provenance", testProvenance, spec.Report(report.Terminal{}))
+}
+
+func testProvenance(t *testing.T, when spec.G, it spec.S) {
+	var (
+		image        *fakes.Image
+		exportReport lifecycle.ExportReport
+		tmpDir       string
+	)
+
+	it.Before(func() {
+		var err error
+		tmpDir, err = ioutil.TempDir("", "lifecycle.provenance")
+		h.AssertNil(t, err)
+
+		image = fakes.NewImage("some-repo/app-image", "", nil)
+		h.AssertNil(t, image.SetLabel(lifecycle.LayerMetadataLabel, `{
+  "app": [{"sha": "sha256:app-sha"}],
+  "buildpacks": [{"key": "some.buildpack", "layers": {"some-layer": {"sha": "sha256:some-layer-sha"}}}],
+  "launcher": {"sha": "sha256:launcher-sha"},
+  "runImage": {"topLayer": "sha256:run-top-layer", "reference": "some-run-image@sha256:run-digest"}
+}`))
+		h.AssertNil(t, image.SetLabel(lifecycle.BuildMetadataLabel, `{
+  "bom": [{"name": "some-dep", "buildpack": {"id": "some.buildpack", "version": "1.2.3"}}],
+  "buildpacks": [{"id": "some.buildpack", "version": "1.2.3"}],
+  "launcher": {"version": "0.10.0", "source": {"git": {"repository": "github.com/buildpacks/lifecycle", "commit": "abcd"}}}
+}`))
+		h.AssertNil(t, image.SetLabel(lifecycle.ProjectMetadataLabel, `{
+  "source": {"type": "git", "version": {"commit": "1234abcd"}, "metadata": {"repository": "github.com/some/app"}}
+}`))
+
+		exportReport = lifecycle.ExportReport{
+			Image: lifecycle.ImageReport{
+				Tags:   []string{"some-repo/app-image", "some-repo/app-image:other"},
+				Digest: "sha256:image-digest",
+			},
+		}
+	})
+
+	it.After(func() {
+		h.AssertNil(t, image.Cleanup())
+		h.AssertNil(t, os.RemoveAll(tmpDir))
+	})
+
+	when("#NewProvenance", func() {
+		it("describes the image from its metadata labels", func() {
+			statement, err := lifecycle.NewProvenance(image, exportReport)
+			h.AssertNil(t, err)
+
+			h.AssertEq(t, statement.Type, "https://in-toto.io/Statement/v0.1")
+			h.AssertEq(t, statement.PredicateType, "https://slsa.dev/provenance/v0.1")
+			h.AssertEq(t, statement.Subject, []lifecycle.ProvenanceSubject{
+				{Name: "some-repo/app-image", Digest: map[string]string{"sha256": "image-digest"}},
+				{Name: "some-repo/app-image:other", Digest: map[string]string{"sha256": "image-digest"}},
+			})
+			h.AssertEq(t, statement.Predicate.Builder.ID, "github.com/buildpacks/lifecycle@0.10.0")
+			h.AssertEq(t, statement.Predicate.Recipe.Arguments.Buildpacks, []lifecycle.GroupBuildpack{{ID: "some.buildpack", Version: "1.2.3"}})
+			h.AssertEq(t, statement.Predicate.Recipe.Environment.BOM[0].Name, "some-dep")
+			h.AssertEq(t, statement.Predicate.Recipe.Environment.BOM[0].Scope, "launch")
+			h.AssertEq(t, statement.Predicate.Recipe.Environment.Layers, map[string]string{
+				"app:1":                     "sha256:app-sha",
+				"some.buildpack:some-layer": "sha256:some-layer-sha",
+				"launcher":                  "sha256:launcher-sha",
+			})
+			h.AssertEq(t, statement.Predicate.Materials, []lifecycle.ProvenanceMaterial{
+				{URI: "github.com/some/app", Digest: map[string]string{"sha1": "1234abcd"}},
+				{URI: "some-run-image@sha256:run-digest", Digest: map[string]string{"sha256": "run-digest"}},
+			})
+		})
+
+		it("marks build-time BOM entries from the report", func() {
+			exportReport.Build.BOM = []lifecycle.BOMEntry{
+				{Require: lifecycle.Require{Name: "some-compiler"}, Buildpack: lifecycle.GroupBuildpack{ID: "some.buildpack", Version: "1.2.3"}},
+			}
+
+			statement, err := lifecycle.NewProvenance(image, exportReport)
+			h.AssertNil(t, err)
+
+			bom := statement.Predicate.Recipe.Environment.BOM
+			h.AssertEq(t, len(bom), 2)
+			h.AssertEq(t, bom[0].Name, "some-dep")
+			h.AssertEq(t, bom[0].Scope, lifecycle.BOMScopeLaunch)
+			h.AssertEq(t, bom[1].Name, "some-compiler")
+			h.AssertEq(t, bom[1].Scope, lifecycle.BOMScopeBuild)
+		})
+
+		it("omits the run image digest when the run image reference has none", func() {
+			h.AssertNil(t, image.SetLabel(lifecycle.LayerMetadataLabel, `{
+  "runImage": {"topLayer": "sha256:run-top-layer", "reference": "sha256:run-image-id"}
+}`))
+
+			statement, err := lifecycle.NewProvenance(image, exportReport)
+			h.AssertNil(t, err)
+
+			h.AssertEq(t, statement.Predicate.Materials[1], lifecycle.ProvenanceMaterial{URI: "sha256:run-image-id"})
+		})
+
+		it("uses the image ID when there is no digest", func() {
+			exportReport.Image.Digest = ""
+			exportReport.Image.ImageID = "sha256:image-id"
+
+			statement, err := lifecycle.NewProvenance(image, exportReport)
+			h.AssertNil(t, err)
+
+			h.AssertEq(t, statement.Subject[0].Digest, map[string]string{"sha256": "image-id"})
+		})
+
+		it("fails when the image has no digest or ID", func() {
+			exportReport.Image.Digest = ""
+
+			_, err := lifecycle.NewProvenance(image, exportReport)
+			h.AssertError(t, err, "image has no digest or ID to attest")
+		})
+	})
+
+	when("#WriteProvenance", func() {
+		var statement lifecycle.ProvenanceStatement
+
+		it.Before(func() {
+			var err error
+			statement, err = lifecycle.NewProvenance(image, exportReport)
+			h.AssertNil(t, err)
+		})
+
+		it("writes the unsigned statement when no key is provided", func() {
+			path := filepath.Join(tmpDir, "provenance.json")
+			h.AssertNil(t, lifecycle.WriteProvenance(path, statement, ""))
+
+			var written lifecycle.ProvenanceStatement
+			readJSON(t, path, &written)
+			h.AssertEq(t, written, statement)
+		})
+
+		it("writes a DSSE envelope signed with the key", func() {
+			pub, priv, err := ed25519.GenerateKey(rand.Reader)
+			h.AssertNil(t, err)
+			der, err := x509.MarshalPKCS8PrivateKey(priv)
+			h.AssertNil(t, err)
+			keyPath := filepath.Join(tmpDir, "key.pem")
+			h.AssertNil(t, ioutil.WriteFile(keyPath, pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der}), 0600))
+
+			path := filepath.Join(tmpDir, "provenance.json")
+			h.AssertNil(t, lifecycle.WriteProvenance(path, statement, keyPath))
+
+			var envelope lifecycle.DSSEEnvelope
+			readJSON(t, path, &envelope)
+			h.AssertEq(t, envelope.PayloadType, "application/vnd.in-toto+json")
+			h.AssertEq(t, len(envelope.Signatures), 1)
+
+			payload, err := base64.StdEncoding.DecodeString(envelope.Payload)
+			h.AssertNil(t, err)
+			var signed lifecycle.ProvenanceStatement
+			h.AssertNil(t, json.Unmarshal(payload, &signed))
+			h.AssertEq(t, signed, statement)
+
+			sig, err := base64.StdEncoding.DecodeString(envelope.Signatures[0].Sig)
+			h.AssertNil(t, err)
+			pae := fmt.Sprintf("DSSEv1 %d %s %d %s", len(envelope.PayloadType), envelope.PayloadType, len(payload), payload)
+			h.AssertEq(t, ed25519.Verify(pub, []byte(pae), sig), true)
+		})
+
+		it("fails when the key is not PEM encoded", func() {
+			keyPath := filepath.Join(tmpDir, "key.pem")
+			h.AssertNil(t, ioutil.WriteFile(keyPath, []byte("not a key"), 0600))
+
+			err := lifecycle.WriteProvenance(filepath.Join(tmpDir, "provenance.json"), statement, keyPath)
+			h.AssertError(t, err, "is not PEM encoded")
+		})
+	})
+}
+
+func readJSON(t *testing.T, path string, v interface{}) {
+	t.Helper()
+	data, err := ioutil.ReadFile(path)
+	h.AssertNil(t, err)
+	h.AssertNil(t, json.Unmarshal(data, v))
+}
@@ -1,6 +1,8 @@
 package lifecycle
 
 import (
+	"io"
+
 	"github.com/pkg/errors"
 	"golang.org/x/sync/errgroup"
 
@@ -8,9 +10,21 @@ import (
 )
 
 type Restorer struct {
-	LayersDir  string
-	Buildpacks []GroupBuildpack
-	Logger     Logger
+	LayersDir          string
+	Buildpacks         []GroupBuildpack
+	CacheInvalidations CacheInvalidations
+	Logger             Logger
+
+	// LazyCacheURL enables lazy restoration when set. Instead of restoring layer data, Restore writes a
+	// LazyRestoreMarker referencing the cache at LazyCacheURL so that the data can be restored on demand.
+	LazyCacheURL string
+
+	cacheStats cacheStatsRecorder
+}
+
+// CacheStats returns the layers restored by Restore, and those removed because they were missing from the cache or stale.
+func (r *Restorer) CacheStats() CacheStats {
+	return r.cacheStats.stats(r.Buildpacks)
 }
 
 // Restore attempts to restore layer data for cache=true layers, removing the layer when unsuccessful.
@@ -31,6 +45,7 @@ func (r *Restorer) Restore(cache Cache) error {
 		r.Logger.Debug("Usable cache not provided, using empty cache metadata.")
 	}
 
+	r.cacheStats.reset()
 	var g errgroup.Group
 	for _, buildpack := range r.Buildpacks {
 		buildpackDir, err := readBuildpackLayersDir(r.LayersDir, buildpack)
@@ -41,12 +56,21 @@ func (r *Restorer) Restore(cache Cache) error {
 		cachedLayers := meta.MetadataForBuildpack(buildpack.ID).Layers
 		for _, bpLayer := range buildpackDir.findLayers(forCached) {
 			name := bpLayer.name()
+			if r.CacheInvalidations.Invalidated(buildpack.ID, name) {
+				r.Logger.Infof("Removing %q, invalidated by platform", bpLayer.Identifier())
+				if err := bpLayer.remove(); err != nil {
+					return errors.Wrapf(err, "removing layer")
+				}
+				r.cacheStats.stale(buildpack)
+				continue
+			}
 			cachedLayer, exists := cachedLayers[name]
 			if !exists {
 				r.Logger.Infof("Removing %q, not in cache", bpLayer.Identifier())
 				if err := bpLayer.remove(); err != nil {
 					return errors.Wrapf(err, "removing layer")
 				}
+				r.cacheStats.miss(buildpack)
 				continue
 			}
 			data, err := bpLayer.read()
@@ -59,10 +83,19 @@ func (r *Restorer) Restore(cache Cache) error {
 				if err := bpLayer.remove(); err != nil {
 					return errors.Wrapf(err, "removing layer")
 				}
+				r.cacheStats.stale(buildpack)
+			} else if r.LazyCacheURL != "" {
+				r.Logger.Infof("Deferring restore of data for %q from cache", bpLayer.Identifier())
+				marker := LazyRestoreMarker{SHA: cachedLayer.SHA, Cache: r.LazyCacheURL}
+				if err := WriteTOML(lazyRestoreMarkerPath(bpLayer.path), marker); err != nil {
+					return errors.Wrapf(err, "writing restore marker")
+				}
+				r.cacheStats.hit(buildpack)
 			} else {
 				r.Logger.Infof("Restoring data for %q from cache", bpLayer.Identifier())
+				buildpack := buildpack
 				g.Go(func() error {
-					return r.restoreLayer(cache, cachedLayer.SHA)
+					return r.restoreLayer(cache, buildpack, cachedLayer.SHA)
 				})
 			}
 		}
@@ -70,10 +103,13 @@ func (r *Restorer) Restore(cache Cache) error {
 	if err := g.Wait(); err != nil {
 		return errors.Wrap(err, "restoring data")
 	}
+	if tc, ok := cache.(TransferStatsCache); ok {
+		r.Logger.Infof("Cache transfer: downloaded %s", humanSize(tc.TransferStats().BytesDownloaded))
+	}
 	return nil
 }
 
-func (r *Restorer) restoreLayer(cache Cache, sha string) error {
+func (r *Restorer) restoreLayer(cache Cache, buildpack GroupBuildpack, sha string) error {
 	// Sanity check to prevent panic.
 	if cache == nil {
 		return errors.New("restoring layer: cache not provided")
@@ -85,5 +121,24 @@ func (r *Restorer) restoreLayer(cache Cache, sha string) error {
 	}
 	defer rc.Close()
 
-	return layers.Extract(rc, "")
+	counter := &countingReader{r: rc}
+	if err := layers.Extract(counter, ""); err != nil {
+		return err
+	}
+	r.cacheStats.record(buildpack, func(s *BuildpackCacheStats) {
+		s.Hit++
+		s.BytesRestored += counter.n
+	})
+	return nil
+}
+
+type countingReader struct {
+	r io.Reader
+	n int64
+}
+
+func (c *countingReader) Read(p []byte) (int, error) {
+	n, err := c.r.Read(p)
+	c.n += int64(n)
+	return n, err
 }
@@ -260,6 +260,13 @@ func testRestorer(t *testing.T, when spec.G, it spec.S) {
 					want := "echo text from cache-only layer\n"
 					h.AssertEq(t, string(got), want)
 				})
+				it("records a cache hit", func() {
+					stats := restorer.CacheStats()
+					h.AssertEq(t, stats.Hit, 1)
+					h.AssertEq(t, stats.Buildpacks[0].ID, "buildpack.id")
+					h.AssertEq(t, stats.Buildpacks[0].Hit, 1)
+					h.AssertEq(t, stats.Buildpacks[0].BytesRestored > 0, true)
+				})
 			})
 
 			when("there is a cache=false layer", func() {
@@ -285,6 +292,38 @@ func testRestorer(t *testing.T, when spec.G, it spec.S) {
 				})
 			})
 
+			when("lazy restore is enabled", func() {
+				var layerPath string
+
+				it.Before(func() {
+					layerPath = filepath.Join(layersDir, "buildpack.id", "cache-only")
+					h.AssertNil(t, writeLayer(layersDir, "buildpack.id", "cache-only", "cache=true", cacheOnlyLayerSHA))
+					restorer.LazyCacheURL = "file://" + cacheDir
+					h.AssertNil(t, restorer.Restore(testCache))
+				})
+
+				it("keeps layer metadata without restoring data", func() {
+					h.AssertPathExists(t, layerPath+".toml")
+					h.AssertPathDoesNotExist(t, layerPath)
+				})
+
+				it("writes a restore marker", func() {
+					marker, ok, err := lifecycle.ReadLazyRestoreMarker(layerPath)
+					h.AssertNil(t, err)
+					h.AssertEq(t, ok, true)
+					h.AssertEq(t, marker.SHA, cacheOnlyLayerSHA)
+					h.AssertEq(t, marker.Cache, "file://"+cacheDir)
+				})
+
+				it("restores data on demand", func() {
+					h.AssertNil(t, lifecycle.RestoreLazyLayer(layerPath, testCache))
+
+					got := h.MustReadFile(t, filepath.Join(layerPath, "file-from-cache-only-layer"))
+					h.AssertEq(t, string(got), "echo text from cache-only layer\n")
+					h.AssertPathDoesNotExist(t, layerPath+".restore")
+				})
+			})
+
 			when("there is a cache=true layer with wrong sha", func() {
 				it.Before(func() {
 					meta := "cache=true"
@@ -301,6 +340,33 @@ func testRestorer(t *testing.T, when spec.G, it spec.S) {
 				})
 			})
 
+			when("there is an invalidated cache=true layer", func() {
+				it.Before(func() {
+					meta := "cache=true"
+					h.AssertNil(t, writeLayer(layersDir, "buildpack.id", "cache-only", meta, cacheOnlyLayerSHA))
+					h.AssertNil(t, writeLayer(layersDir, "escaped_buildpack_id", "escaped-bp-layer", meta, escapedLayerSHA))
+					restorer.CacheInvalidations = lifecycle.CacheInvalidations{Invalidate: []string{"buildpack.id:cache-only"}}
+					h.AssertNil(t, restorer.Restore(testCache))
+				})
+
+				it("removes metadata and sha file", func() {
+					h.AssertPathDoesNotExist(t, filepath.Join(layersDir, "buildpack.id", "cache-only.toml"))
+					h.AssertPathDoesNotExist(t, filepath.Join(layersDir, "buildpack.id", "cache-only.sha"))
+				})
+				it("does not restore layer data", func() {
+					h.AssertPathDoesNotExist(t, filepath.Join(layersDir, "buildpack.id", "cache-only"))
+				})
+				it("restores other layers", func() {
+					h.AssertPathExists(t, filepath.Join(layersDir, "escaped_buildpack_id", "escaped-bp-layer"))
+				})
+				it("records stats per buildpack", func() {
+					stats := restorer.CacheStats()
+					h.AssertEq(t, stats.Buildpacks[0].Stale, 1)
+					h.AssertEq(t, stats.Buildpacks[1].ID, "escaped/buildpack/id")
+					h.AssertEq(t, stats.Buildpacks[1].Hit, 1)
+				})
+			})
+
 			when("there is a cache=true layer not in cache", func() {
 				it.Before(func() {
 					meta := "cache=true"
@@ -315,6 +381,9 @@ func testRestorer(t *testing.T, when spec.G, it spec.S) {
 				it("does not restore layer data", func() {
 					h.AssertPathDoesNotExist(t, filepath.Join(layersDir, "buildpack.id", "cache-layer-not-in-cache"))
 				})
+				it("records a cache miss", func() {
+					h.AssertEq(t, restorer.CacheStats().Miss, 1)
+				})
 			})
 
 			when("there is a cache=true escaped layer", func() {
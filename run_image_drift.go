@@ -0,0 +1,41 @@
+package lifecycle
+
+import (
+	"strings"
+
+	"github.com/buildpacks/imgutil"
+	"github.com/pkg/errors"
+)
+
+// RunImageDrift compares the run image recorded in the previous image with the run image of the current build.
+type RunImageDrift struct {
+	Previous RunImageMetadata `toml:"previous"`
+	Current  RunImageMetadata `toml:"current"`
+	Drifted  bool             `toml:"drifted"`
+}
+
+// DetectRunImageDrift compares previous, the run image recorded in the previous image, with runImage.
+// References are compared by digest, so the same run image pulled from different mirrors has not drifted.
+func DetectRunImageDrift(previous RunImageMetadata, runImage imgutil.Image) (RunImageDrift, error) {
+	topLayer, err := runImage.TopLayer()
+	if err != nil {
+		return RunImageDrift{}, errors.Wrap(err, "get run image top layer")
+	}
+	identifier, err := runImage.Identifier()
+	if err != nil {
+		return RunImageDrift{}, errors.Wrap(err, "get run image reference")
+	}
+	current := RunImageMetadata{TopLayer: topLayer, Reference: identifier.String()}
+	return RunImageDrift{
+		Previous: previous,
+		Current:  current,
+		Drifted:  previous.TopLayer != current.TopLayer || referenceDigest(previous.Reference) != referenceDigest(current.Reference),
+	}, nil
+}
+
+func referenceDigest(ref string) string {
+	if i := strings.LastIndex(ref, "@"); i >= 0 {
+		return ref[i+1:]
+	}
+	return ref
+}
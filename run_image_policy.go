@@ -0,0 +1,156 @@
+package lifecycle
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/BurntSushi/toml"
+	"github.com/google/go-containerregistry/pkg/name"
+	"github.com/pkg/errors"
+)
+
+// RunImagePolicy orders the run image and its mirrors by preference.
+type RunImagePolicy interface {
+	Name() string
+	// Candidates returns every run image reference in the stack metadata, most preferred first,
+	// together with the reason for its position.
+	Candidates(stackMD StackMetadata, registry string) ([]RunImageCandidate, error)
+}
+
+type RunImageCandidate struct {
+	Reference string
+	Reason    string
+}
+
+// RunImageLookup returns the digest of the image at ref, or an error if the image cannot be reached.
+type RunImageLookup func(ref string) (string, error)
+
+// RunImageResolution records which run image was chosen and why. It is included in the export report.
+type RunImageResolution struct {
+	Reference string   `toml:"reference"`
+	Digest    string   `toml:"digest,omitempty"`
+	Policy    string   `toml:"policy,omitempty"`
+	Reasons   []string `toml:"reasons"`
+}
+
+// RunImagePolicyConfig is the platform's run image policy file.
+type RunImagePolicyConfig struct {
+	// PreferredRegistries are registry hosts, e.g. regional registries, to choose mirrors from in order of preference.
+	PreferredRegistries []string `toml:"preferred-registries"`
+	// Verify requires the chosen mirror to be reachable and to have the same digest as the primary run image.
+	Verify bool `toml:"verify"`
+}
+
+// ReadRunImagePolicyConfig reads the policy at path. A missing file selects mirrors by the app image registry.
+func ReadRunImagePolicyConfig(path string) (RunImagePolicyConfig, error) {
+	var config RunImagePolicyConfig
+	if path == "" {
+		return config, nil
+	}
+	if _, err := toml.DecodeFile(path, &config); err != nil {
+		if os.IsNotExist(err) {
+			return RunImagePolicyConfig{}, nil
+		}
+		return RunImagePolicyConfig{}, err
+	}
+	return config, nil
+}
+
+func (c RunImagePolicyConfig) Policy() RunImagePolicy {
+	if len(c.PreferredRegistries) > 0 {
+		return &PreferredRegistriesPolicy{Registries: c.PreferredRegistries}
+	}
+	return &RegistryPolicy{}
+}
+
+// RegistryPolicy prefers mirrors on the registry of the app image, then the primary run image, then the remaining mirrors.
+type RegistryPolicy struct{}
+
+func (p *RegistryPolicy) Name() string {
+	return "registry"
+}
+
+func (p *RegistryPolicy) Candidates(stackMD StackMetadata, registry string) ([]RunImageCandidate, error) {
+	return candidatesByRegistries(stackMD, []string{registry}, "on the registry of the app image")
+}
+
+// PreferredRegistriesPolicy prefers mirrors on the given registries, in order, then the primary run image, then the remaining mirrors.
+type PreferredRegistriesPolicy struct {
+	Registries []string
+}
+
+func (p *PreferredRegistriesPolicy) Name() string {
+	return "preferred-registries"
+}
+
+func (p *PreferredRegistriesPolicy) Candidates(stackMD StackMetadata, registry string) ([]RunImageCandidate, error) {
+	return candidatesByRegistries(stackMD, p.Registries, "on preferred registry")
+}
+
+func candidatesByRegistries(stackMD StackMetadata, registries []string, reason string) ([]RunImageCandidate, error) {
+	if stackMD.RunImage.Image == "" {
+		return nil, errors.New("missing run-image metadata")
+	}
+	all := append([]string{stackMD.RunImage.Image}, stackMD.RunImage.Mirrors...)
+
+	var candidates []RunImageCandidate
+	seen := map[string]bool{}
+	add := func(ref, reason string) {
+		if !seen[ref] {
+			seen[ref] = true
+			candidates = append(candidates, RunImageCandidate{Reference: ref, Reason: reason})
+		}
+	}
+	for _, reg := range registries {
+		for _, img := range all {
+			ref, err := name.ParseReference(img, name.WeakValidation)
+			if err != nil {
+				continue
+			}
+			if reg == ref.Context().RegistryStr() {
+				add(img, fmt.Sprintf("%s '%s'", reason, reg))
+			}
+		}
+	}
+	add(stackMD.RunImage.Image, "primary run image")
+	for _, img := range stackMD.RunImage.Mirrors {
+		add(img, "mirror")
+	}
+	return candidates, nil
+}
+
+// ResolveRunImage chooses the run image with policy. When lookup is provided, candidates that cannot be reached,
+// or whose digest differs from the primary run image, are skipped.
+func ResolveRunImage(stackMD StackMetadata, registry string, policy RunImagePolicy, lookup RunImageLookup) (RunImageResolution, error) {
+	candidates, err := policy.Candidates(stackMD, registry)
+	if err != nil {
+		return RunImageResolution{}, errors.Wrap(err, "failed to find run-image")
+	}
+	resolution := RunImageResolution{Policy: policy.Name()}
+	if lookup == nil {
+		resolution.Reference = candidates[0].Reference
+		resolution.Reasons = []string{fmt.Sprintf("chose '%s': %s", candidates[0].Reference, candidates[0].Reason)}
+		return resolution, nil
+	}
+
+	primaryDigest, err := lookup(stackMD.RunImage.Image)
+	if err != nil {
+		resolution.Reasons = append(resolution.Reasons, fmt.Sprintf("primary run image '%s' is unreachable, digests will not be compared: %s", stackMD.RunImage.Image, err))
+	}
+	for _, c := range candidates {
+		digest, err := lookup(c.Reference)
+		if err != nil {
+			resolution.Reasons = append(resolution.Reasons, fmt.Sprintf("skipped '%s': unreachable: %s", c.Reference, err))
+			continue
+		}
+		if primaryDigest != "" && digest != primaryDigest {
+			resolution.Reasons = append(resolution.Reasons, fmt.Sprintf("skipped '%s': digest '%s' differs from primary run image digest '%s'", c.Reference, digest, primaryDigest))
+			continue
+		}
+		resolution.Reference = c.Reference
+		resolution.Digest = digest
+		resolution.Reasons = append(resolution.Reasons, fmt.Sprintf("chose '%s': %s", c.Reference, c.Reason))
+		return resolution, nil
+	}
+	return resolution, errors.New("failed to find run-image: no reachable run image matches the primary run image")
+}
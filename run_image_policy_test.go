@@ -0,0 +1,130 @@
+package lifecycle_test
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/sclevine/spec"
+	"github.com/sclevine/spec/report"
+
+	"github.com/buildpacks/lifecycle"
+	h "github.com/buildpacks/lifecycle/testhelpers"
+)
+
+func TestRunImagePolicy(t *testing.T) {
+	spec.Run(t, "RunImagePolicy", testRunImagePolicy, spec.Report(report.Terminal{}))
+}
+
+func testRunImagePolicy(t *testing.T, when spec.G, it spec.S) {
+	var stackMD lifecycle.StackMetadata
+
+	it.Before(func() {
+		stackMD = lifecycle.StackMetadata{RunImage: lifecycle.StackRunImageMetadata{
+			Image: "first.com/org/repo",
+			Mirrors: []string{
+				"myorg/myrepo",
+				"us.gcr.io/org/repo",
+				"eu.gcr.io/org/repo",
+			},
+		}}
+	})
+
+	when("#ReadRunImagePolicyConfig", func() {
+		it("selects the registry policy when no file exists", func() {
+			config, err := lifecycle.ReadRunImagePolicyConfig(filepath.Join("testdata", "missing.toml"))
+			h.AssertNil(t, err)
+			h.AssertEq(t, config.Policy().Name(), "registry")
+		})
+
+		it("selects the preferred registries policy", func() {
+			tmpDir, err := ioutil.TempDir("", "run-image-policy")
+			h.AssertNil(t, err)
+			defer os.RemoveAll(tmpDir)
+			path := filepath.Join(tmpDir, "run-image-policy.toml")
+			h.Mkfile(t, "preferred-registries = [\"eu.gcr.io\"]\nverify = true\n", path)
+
+			config, err := lifecycle.ReadRunImagePolicyConfig(path)
+			h.AssertNil(t, err)
+			h.AssertEq(t, config.Verify, true)
+			h.AssertEq(t, config.Policy().Name(), "preferred-registries")
+		})
+	})
+
+	when("#ResolveRunImage", func() {
+		when("without a lookup", func() {
+			it("chooses the mirror on the app image registry", func() {
+				resolution, err := lifecycle.ResolveRunImage(stackMD, "us.gcr.io", &lifecycle.RegistryPolicy{}, nil)
+				h.AssertNil(t, err)
+				h.AssertEq(t, resolution, lifecycle.RunImageResolution{
+					Reference: "us.gcr.io/org/repo",
+					Policy:    "registry",
+					Reasons:   []string{"chose 'us.gcr.io/org/repo': on the registry of the app image 'us.gcr.io'"},
+				})
+			})
+
+			it("chooses the primary run image when no mirror matches", func() {
+				resolution, err := lifecycle.ResolveRunImage(stackMD, "other.com", &lifecycle.RegistryPolicy{}, nil)
+				h.AssertNil(t, err)
+				h.AssertEq(t, resolution.Reference, "first.com/org/repo")
+			})
+
+			it("chooses mirrors on preferred registries in order", func() {
+				policy := &lifecycle.PreferredRegistriesPolicy{Registries: []string{"missing.com", "eu.gcr.io", "us.gcr.io"}}
+				resolution, err := lifecycle.ResolveRunImage(stackMD, "us.gcr.io", policy, nil)
+				h.AssertNil(t, err)
+				h.AssertEq(t, resolution.Reference, "eu.gcr.io/org/repo")
+				h.AssertEq(t, resolution.Policy, "preferred-registries")
+			})
+
+			it("errors when there is no run image metadata", func() {
+				_, err := lifecycle.ResolveRunImage(lifecycle.StackMetadata{}, "us.gcr.io", &lifecycle.RegistryPolicy{}, nil)
+				h.AssertError(t, err, "missing run-image metadata")
+			})
+		})
+
+		when("with a lookup", func() {
+			var digests map[string]string
+
+			lookup := func(ref string) (string, error) {
+				digest, ok := digests[ref]
+				if !ok {
+					return "", errors.New("not found")
+				}
+				return digest, nil
+			}
+
+			it.Before(func() {
+				digests = map[string]string{
+					"first.com/org/repo": "sha256:primary",
+					"us.gcr.io/org/repo": "sha256:stale",
+					"eu.gcr.io/org/repo": "sha256:primary",
+				}
+			})
+
+			it("skips unreachable mirrors and mirrors with a different digest", func() {
+				policy := &lifecycle.PreferredRegistriesPolicy{Registries: []string{"index.docker.io", "us.gcr.io", "eu.gcr.io"}}
+				resolution, err := lifecycle.ResolveRunImage(stackMD, "us.gcr.io", policy, lookup)
+				h.AssertNil(t, err)
+				h.AssertEq(t, resolution, lifecycle.RunImageResolution{
+					Reference: "eu.gcr.io/org/repo",
+					Digest:    "sha256:primary",
+					Policy:    "preferred-registries",
+					Reasons: []string{
+						"skipped 'myorg/myrepo': unreachable: not found",
+						"skipped 'us.gcr.io/org/repo': digest 'sha256:stale' differs from primary run image digest 'sha256:primary'",
+						"chose 'eu.gcr.io/org/repo': on preferred registry 'eu.gcr.io'",
+					},
+				})
+			})
+
+			it("errors when no run image can be used", func() {
+				digests = map[string]string{}
+				_, err := lifecycle.ResolveRunImage(stackMD, "us.gcr.io", &lifecycle.RegistryPolicy{}, lookup)
+				h.AssertError(t, err, "no reachable run image matches the primary run image")
+			})
+		})
+	})
+}
@@ -0,0 +1,136 @@
+package lifecycle
+
+import (
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// SizeBudget limits the size of the exported image and its layers. A zero limit is unlimited.
+type SizeBudget struct {
+	MaxImageSize     int64 // MaxImageSize is the maximum size in bytes of the image, including run image layers and reused layers
+	MaxNewLayersSize int64 // MaxNewLayersSize is the maximum combined size in bytes of the layers written by the exporter
+	MaxLayerSize     int64 // MaxLayerSize is the maximum size in bytes of a single buildpack layer
+	WarnOnly         bool  // WarnOnly logs budget violations instead of failing the export
+}
+
+func (b SizeBudget) enabled() bool {
+	return b.MaxImageSize > 0 || b.MaxNewLayersSize > 0 || b.MaxLayerSize > 0
+}
+
+// BaseLayerSizes are the sizes of the layers of the exported image that the exporter does not write.
+// Sizes read from a registry are the compressed sizes of the layers.
+type BaseLayerSizes struct {
+	RunImage int64            // RunImage is the combined size of the run image layers
+	Previous map[string]int64 // Previous are the sizes of the layers of the previous image, by diff ID
+}
+
+type layerSize struct {
+	id        string
+	size      int64
+	buildpack bool
+	reused    bool // reused is true for layers reused from the previous image without local contents
+}
+
+// recordLayerSize notes the size of a layer tarball written for the working image for the size budget and layer diff.
+// A missing tarball is only an error when the size budget is enabled.
+func (e *Exporter) recordLayerSize(budget SizeBudget, id, tarPath string, buildpack bool) error {
+	fi, err := os.Stat(tarPath)
+	if err != nil {
+		if budget.enabled() {
+			return errors.Wrapf(err, "size of layer '%s'", id)
+		}
+		return nil
+	}
+	e.layerSizes = append(e.layerSizes, layerSize{id: id, size: fi.Size(), buildpack: buildpack})
+	return nil
+}
+
+// recordReusedLayerSize notes the size of a buildpack layer reused from the previous image without local contents.
+func (e *Exporter) recordReusedLayerSize(opts ExportOptions, id, diffID string) {
+	size, ok := opts.BaseLayerSizes.Previous[diffID]
+	if !ok {
+		if opts.SizeBudget.MaxImageSize > 0 {
+			e.Logger.Warnf("Size of reused layer '%s' is unknown, it is not counted towards the size budget", id)
+		}
+		return
+	}
+	e.layerSizes = append(e.layerSizes, layerSize{id: id, size: size, buildpack: true, reused: true})
+}
+
+func (e *Exporter) enforceSizeBudget(budget SizeBudget, base BaseLayerSizes) error {
+	if !budget.enabled() {
+		return nil
+	}
+	sizes := append([]layerSize{}, e.layerSizes...)
+	sort.SliceStable(sizes, func(i, j int) bool {
+		return sizes[i].size > sizes[j].size
+	})
+
+	var problems []string
+	var total, reused int64
+	for _, l := range sizes {
+		if l.reused {
+			reused += l.size
+		} else {
+			total += l.size
+		}
+		if budget.MaxLayerSize > 0 && l.buildpack && l.size > budget.MaxLayerSize {
+			problems = append(problems, fmt.Sprintf("layer '%s' is %s, exceeding the layer limit of %s", l.id, humanSize(l.size), humanSize(budget.MaxLayerSize)))
+		}
+	}
+	if budget.MaxNewLayersSize > 0 && total > budget.MaxNewLayersSize {
+		var largest []string
+		for _, l := range sizes {
+			if len(largest) == 5 {
+				break
+			}
+			if !l.reused {
+				largest = append(largest, fmt.Sprintf("'%s' (%s)", l.id, humanSize(l.size)))
+			}
+		}
+		problems = append(problems, fmt.Sprintf("exported layers total %s, exceeding the new layers limit of %s; largest layers: %s", humanSize(total), humanSize(budget.MaxNewLayersSize), strings.Join(largest, ", ")))
+	}
+	e.Logger.Debugf("Exported layers total %s", humanSize(total))
+
+	imageSize := base.RunImage + reused + total
+	if budget.MaxImageSize > 0 && imageSize > budget.MaxImageSize {
+		var largest []string
+		for i, l := range sizes {
+			if i == 5 {
+				break
+			}
+			largest = append(largest, fmt.Sprintf("'%s' (%s)", l.id, humanSize(l.size)))
+		}
+		problems = append(problems, fmt.Sprintf("image is %s (run image %s, reused layers %s, exported layers %s), exceeding the image limit of %s; largest layers: %s",
+			humanSize(imageSize), humanSize(base.RunImage), humanSize(reused), humanSize(total), humanSize(budget.MaxImageSize), strings.Join(largest, ", ")))
+	}
+	e.Logger.Debugf("Image total %s", humanSize(imageSize))
+
+	if len(problems) == 0 {
+		return nil
+	}
+	if budget.WarnOnly {
+		for _, p := range problems {
+			e.Logger.Warnf("Size budget exceeded: %s", p)
+		}
+		return nil
+	}
+	return fmt.Errorf("size budget exceeded: %s", strings.Join(problems, "; "))
+}
+
+func humanSize(size int64) string {
+	const unit = 1024
+	if size < unit {
+		return fmt.Sprintf("%d B", size)
+	}
+	div, exp := int64(unit), 0
+	for n := size / unit; n >= unit; n /= unit {
+		div *= unit
+		exp++
+	}
+	return fmt.Sprintf("%.1f %ciB", float64(size)/float64(div), "KMGTPE"[exp])
+}
@@ -0,0 +1,279 @@
+package lifecycle
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"reflect"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/BurntSushi/toml"
+)
+
+// SchemaIssue is a problem with a TOML file written by a buildpack.
+type SchemaIssue struct {
+	File      string
+	Line      int // Line is 0 when the key could not be located in the file
+	Buildpack string
+	Message   string
+	// Mismatch is true when the value has the wrong type.
+	Mismatch bool
+}
+
+func (i SchemaIssue) Error() string {
+	location := i.File
+	if i.Line > 0 {
+		location = fmt.Sprintf("%s:%d", i.File, i.Line)
+	}
+	return fmt.Sprintf("%s: %s (buildpack '%s')", location, i.Message, i.Buildpack)
+}
+
+type SchemaIssues []SchemaIssue
+
+func (is SchemaIssues) Error() string {
+	var msgs []string
+	for _, i := range is {
+		msgs = append(msgs, i.Error())
+	}
+	return strings.Join(msgs, "\n")
+}
+
+func (is SchemaIssues) hasMismatch() bool {
+	for _, i := range is {
+		if i.Mismatch {
+			return true
+		}
+	}
+	return false
+}
+
+// checkTOMLSchema reports the keys in the TOML file at path that are not fields of v, or whose values have the wrong type.
+// Keys in excluded are unknown, even if they are fields of v. A missing or unparseable file has no issues.
+func checkTOMLSchema(path, buildpack string, v interface{}, excluded ...string) (SchemaIssues, error) {
+	contents, err := ioutil.ReadFile(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	var data map[string]interface{}
+	if _, err := toml.Decode(string(contents), &data); err != nil {
+		return nil, nil
+	}
+	c := &schemaChecker{
+		file:      path,
+		buildpack: buildpack,
+		lines:     strings.Split(string(contents), "\n"),
+		excluded:  excluded,
+	}
+	c.check(data, reflect.TypeOf(v), "", 0)
+	return c.issues, nil
+}
+
+type schemaChecker struct {
+	file      string
+	buildpack string
+	lines     []string
+	excluded  []string
+	issues    SchemaIssues
+}
+
+func (c *schemaChecker) add(line int, mismatch bool, format string, v ...interface{}) {
+	c.issues = append(c.issues, SchemaIssue{
+		File:      c.file,
+		Line:      line,
+		Buildpack: c.buildpack,
+		Message:   fmt.Sprintf(format, v...),
+		Mismatch:  mismatch,
+	})
+}
+
+// check checks value against t. line is the line of the key of value, where the search for nested keys starts.
+func (c *schemaChecker) check(value interface{}, t reflect.Type, key string, line int) {
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	expected := ""
+	switch t.Kind() {
+	case reflect.Interface:
+		return
+	case reflect.Struct:
+		table, ok := value.(map[string]interface{})
+		if !ok {
+			expected = "table"
+			break
+		}
+		keys := make([]string, 0, len(table))
+		for k := range table {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		for _, k := range keys {
+			path := joinKey(key, k)
+			keyLine := c.findKey(k, line)
+			field, ok := tomlField(t, k)
+			if !ok || containsString(c.excluded, path) {
+				c.add(keyLine, false, "unknown key '%s'", path)
+				continue
+			}
+			if keyLine == 0 {
+				keyLine = line
+			}
+			c.check(table[k], field.Type, path, keyLine)
+		}
+		return
+	case reflect.Map:
+		table, ok := value.(map[string]interface{})
+		if !ok {
+			expected = "table"
+			break
+		}
+		for k, v := range table {
+			c.check(v, t.Elem(), joinKey(key, k), line)
+		}
+		return
+	case reflect.Slice, reflect.Array:
+		switch values := value.(type) {
+		case []map[string]interface{}:
+			for i, v := range values {
+				c.check(v, t.Elem(), fmt.Sprintf("%s[%d]", key, i), c.findTableArray(key, i, line))
+			}
+			return
+		case []interface{}:
+			for i, v := range values {
+				c.check(v, t.Elem(), fmt.Sprintf("%s[%d]", key, i), line)
+			}
+			return
+		}
+		expected = "array"
+	case reflect.String:
+		if _, ok := value.(string); ok {
+			return
+		}
+		expected = "string"
+	case reflect.Bool:
+		if _, ok := value.(bool); ok {
+			return
+		}
+		expected = "boolean"
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		if _, ok := value.(int64); ok {
+			return
+		}
+		expected = "integer"
+	case reflect.Float32, reflect.Float64:
+		switch value.(type) {
+		case float64, int64:
+			return
+		}
+		expected = "float"
+	default:
+		return
+	}
+	c.add(line, true, "invalid type for key '%s': expected %s, found %s", key, expected, tomlTypeName(value))
+}
+
+// findKey returns the line of the first key or table header named k, at or after line from.
+func (c *schemaChecker) findKey(k string, from int) int {
+	for i := maxInt(from-1, 0); i < len(c.lines); i++ {
+		line := strings.TrimSpace(c.lines[i])
+		if strings.HasPrefix(line, "[") {
+			if lastKeySegment(strings.Trim(line, "[] ")) == k {
+				return i + 1
+			}
+			continue
+		}
+		if eq := strings.Index(line, "="); eq > 0 && unquoteKey(strings.TrimSpace(line[:eq])) == k {
+			return i + 1
+		}
+	}
+	return 0
+}
+
+// findTableArray returns the line of the header of element n of the array of tables key, or from if there is none.
+func (c *schemaChecker) findTableArray(key string, n, from int) int {
+	name := lastKeySegment(key)
+	for i := maxInt(from-1, 0); i < len(c.lines); i++ {
+		line := strings.TrimSpace(c.lines[i])
+		if strings.HasPrefix(line, "[[") && lastKeySegment(strings.Trim(line, "[] ")) == name {
+			if n == 0 {
+				return i + 1
+			}
+			n--
+		}
+	}
+	return from
+}
+
+// tomlField returns the field of struct t, or of its embedded structs, that the BurntSushi decoder would decode key into.
+func tomlField(t reflect.Type, key string) (reflect.StructField, bool) {
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		tag := strings.Split(f.Tag.Get("toml"), ",")[0]
+		if tag == "-" {
+			continue
+		}
+		if f.Anonymous && tag == "" && f.Type.Kind() == reflect.Struct {
+			if embedded, ok := tomlField(f.Type, key); ok {
+				return embedded, true
+			}
+			continue
+		}
+		if tag == key || (tag == "" && strings.EqualFold(f.Name, key)) {
+			return f, true
+		}
+	}
+	return reflect.StructField{}, false
+}
+
+func tomlTypeName(value interface{}) string {
+	switch value.(type) {
+	case string:
+		return "string"
+	case bool:
+		return "boolean"
+	case int64:
+		return "integer"
+	case float64:
+		return "float"
+	case time.Time:
+		return "datetime"
+	case map[string]interface{}:
+		return "table"
+	case []map[string]interface{}, []interface{}:
+		return "array"
+	}
+	return fmt.Sprintf("%T", value)
+}
+
+func joinKey(parent, key string) string {
+	if parent == "" {
+		return key
+	}
+	return parent + "." + key
+}
+
+func lastKeySegment(key string) string {
+	if i := strings.LastIndex(key, "."); i >= 0 {
+		key = key[i+1:]
+	}
+	if i := strings.Index(key, "["); i >= 0 {
+		key = key[:i]
+	}
+	return unquoteKey(strings.TrimSpace(key))
+}
+
+func unquoteKey(key string) string {
+	return strings.Trim(key, `"'`)
+}
+
+func maxInt(a, b int) int {
+	if a > b {
+		return a
+	}
+	return b
+}
@@ -0,0 +1,164 @@
+package lifecycle_test
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+
+	"github.com/apex/log"
+	"github.com/apex/log/handlers/memory"
+	"github.com/sclevine/spec"
+	"github.com/sclevine/spec/report"
+
+	"github.com/buildpacks/lifecycle"
+	"github.com/buildpacks/lifecycle/cmd"
+	"github.com/buildpacks/lifecycle/env"
+	h "github.com/buildpacks/lifecycle/testhelpers"
+)
+
+func TestTOMLSchema(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("buildpack executables are shell scripts")
+	}
+	spec.Run(t, "TOMLSchema", testTOMLSchema, spec.Report(report.Terminal{}))
+}
+
+func testTOMLSchema(t *testing.T, when spec.G, it spec.S) {
+	var (
+		bpTOML     *lifecycle.BuildpackTOML
+		config     lifecycle.BuildConfig
+		tmpDir     string
+		layersDir  string
+		logHandler *memory.Handler
+	)
+
+	it.Before(func() {
+		var err error
+		tmpDir, err = ioutil.TempDir("", "toml-schema")
+		h.AssertNil(t, err)
+		appDir := filepath.Join(tmpDir, "app")
+		platformDir := filepath.Join(tmpDir, "platform")
+		layersDir = filepath.Join(tmpDir, "layers")
+		h.Mkdir(t, appDir, filepath.Join(platformDir, "env"), filepath.Join(tmpDir, "buildpack", "bin"))
+
+		bpTOML = &lifecycle.BuildpackTOML{
+			API:       "0.5",
+			Buildpack: lifecycle.BuildpackInfo{ID: "A", Version: "v1"},
+			Dir:       filepath.Join(tmpDir, "buildpack"),
+		}
+		logHandler = memory.New()
+		config = lifecycle.BuildConfig{
+			Env:             env.NewBuildEnv(os.Environ()),
+			AppDir:          appDir,
+			PlatformDir:     platformDir,
+			LayersDir:       layersDir,
+			Out:             &bytes.Buffer{},
+			Err:             &bytes.Buffer{},
+			DeprecationMode: cmd.DeprecationModeError,
+			Logger:          &log.Logger{Handler: logHandler},
+		}
+	})
+
+	it.After(func() {
+		os.RemoveAll(tmpDir)
+	})
+
+	// writes files to the buildpack layers dir from bin/build
+	writeFiles := func(files map[string]string) {
+		t.Helper()
+		script := "#!/usr/bin/env bash\n"
+		for name, contents := range files {
+			script += "cat > \"$1/" + name + "\" <<'EOF'\n" + contents + "\nEOF\n"
+		}
+		h.AssertNil(t, ioutil.WriteFile(filepath.Join(bpTOML.Dir, "bin", "build"), []byte(script), 0755))
+	}
+
+	build := func() error {
+		_, err := bpTOML.Build(lifecycle.BuildpackPlan{}, config)
+		return err
+	}
+
+	it("accepts valid files", func() {
+		writeFiles(map[string]string{
+			"launch.toml": "[[processes]]\ntype = \"web\"\ncommand = \"some-command\"\nargs = [\"some-arg\"]\n\n[[labels]]\nkey = \"some-key\"\nvalue = \"some-value\"",
+			"build.toml":  "[[bom]]\nname = \"some-dep\"\n[bom.metadata]\nversion = \"1.0\"",
+			"layer.toml":  "launch = true\n[metadata]\nanything = 1",
+		})
+
+		h.AssertNil(t, build())
+	})
+
+	it("reports unknown keys with the file, line and buildpack", func() {
+		writeFiles(map[string]string{
+			"launch.toml": "[[processes]]\ntype = \"web\"\ncommand = \"some-command\"\n\n[[processes]]\ntype = \"worker\"\ncomand = \"other-command\"\n\n[[proccesses]]\ntype = \"other\"",
+		})
+
+		err := build()
+		launchPath := filepath.Join(layersDir, "A", "launch.toml")
+		h.AssertError(t, err, launchPath+":7: unknown key 'processes[1].comand' (buildpack 'A@v1')")
+		h.AssertError(t, err, launchPath+":9: unknown key 'proccesses' (buildpack 'A@v1')")
+		lerr, ok := err.(*lifecycle.Error)
+		if !ok || lerr.Type != lifecycle.ErrTypeBuildpack {
+			t.Fatalf("Expected buildpack error, got: %v", err)
+		}
+	})
+
+	it("reports keys from newer buildpack APIs as unknown", func() {
+		bpTOML.API = "0.4"
+		writeFiles(map[string]string{
+			"launch.toml": "[[bom]]\nname = \"some-dep\"",
+		})
+
+		h.AssertError(t, build(), "launch.toml:1: unknown key 'bom' (buildpack 'A@v1')")
+	})
+
+	when("deprecation mode is warn", func() {
+		it.Before(func() {
+			config.DeprecationMode = cmd.DeprecationModeWarn
+		})
+
+		it("warns about unknown keys", func() {
+			writeFiles(map[string]string{
+				"layer.toml": "launch = true\ncahce = true",
+			})
+
+			h.AssertNil(t, build())
+			assertLogEntry(t, logHandler, "layer.toml:2: unknown key 'cahce' (buildpack 'A@v1')")
+		})
+
+		it("warns about values of the wrong type in layer metadata files", func() {
+			writeFiles(map[string]string{
+				"layer.toml": "launch = \"true\"",
+			})
+
+			h.AssertNil(t, build())
+			assertLogEntry(t, logHandler, "layer.toml:1: invalid type for key 'launch': expected boolean, found string (buildpack 'A@v1')")
+		})
+
+		it("fails on values of the wrong type in launch.toml", func() {
+			writeFiles(map[string]string{
+				"launch.toml": "[[processes]]\ntype = \"web\"\ncommand = \"some-command\"\ndirect = \"true\"",
+			})
+
+			h.AssertError(t, build(), "launch.toml:4: invalid type for key 'processes[0].direct': expected boolean, found string (buildpack 'A@v1')")
+		})
+	})
+
+	when("deprecation mode is quiet", func() {
+		it.Before(func() {
+			config.DeprecationMode = cmd.DeprecationModeQuiet
+		})
+
+		it("ignores unknown keys", func() {
+			writeFiles(map[string]string{
+				"build.toml": "[[unmett]]\nname = \"some-dep\"",
+			})
+
+			h.AssertNil(t, build())
+			h.AssertEq(t, len(logHandler.Entries), 0)
+		})
+	})
+}
@@ -107,6 +107,15 @@ func compare(strings1, strings2 []string) (extra []string, missing []string, com
 	return extra, missing, common
 }
 
+func containsString(s []string, v string) bool {
+	for _, e := range s {
+		if e == v {
+			return true
+		}
+	}
+	return false
+}
+
 func syncLabels(sourceImg imgutil.Image, destImage imgutil.Image, test func(string) bool) error {
 	if err := removeLabels(destImage, test); err != nil {
 		return err